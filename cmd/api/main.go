@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -13,15 +14,24 @@ import (
 	"github.com/labstack/echo/v4/middleware"
 	_ "github.com/go-sql-driver/mysql"
 
+	"subscription-management/internal/auth"
+	"subscription-management/internal/bin"
 	"subscription-management/internal/config"
 	"subscription-management/internal/controller"
+	"subscription-management/internal/idempotency"
+	"subscription-management/internal/invoice"
 	"subscription-management/internal/razorpay"
 	"subscription-management/internal/repository"
 	"subscription-management/internal/service"
+	"subscription-management/internal/tax"
+	"subscription-management/internal/vault"
 )
 
 func main() {
 	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
@@ -51,6 +61,15 @@ func main() {
 	
 	cardRepo := repository.NewCardRepository(db)
 	subscriptionRepo := repository.NewSubscriptionRepository(db)
+	paymentAttemptRepo := repository.NewPaymentAttemptRepository(db)
+	refundRepo := repository.NewRefundRepository(db)
+	invoiceRepo := repository.NewInvoiceRepository(db)
+	customerRepo := repository.NewCustomerRepository(db)
+	apiKeyRepo := repository.NewAPIKeyRepository(db)
+	vaultRepo := repository.NewVaultRepository(db)
+	idempotencyRepo := repository.NewIdempotencyRepository(db)
+	outboxRepo := repository.NewOutboxRepository(db)
+	transactor := repository.NewTransactor(db)
 
 	
 	razorpayClient := razorpay.NewClient(razorpay.Config{
@@ -59,16 +78,76 @@ func main() {
 	})
 
 	
-	cardService := service.NewCardService(cardRepo)
+	invoiceRenderer, err := invoice.NewRenderer(cfg.Company)
+	if err != nil {
+		log.Fatalf("Failed to load invoice templates: %v", err)
+	}
+
+	authVerifier, err := auth.NewVerifier(cfg.Auth)
+	if err != nil {
+		log.Fatalf("Failed to load token verification keys: %v", err)
+	}
+
+	cardVault, err := vault.NewLocalVault(vaultRepo, cfg.Vault)
+	if err != nil {
+		log.Fatalf("Failed to initialise card vault: %v", err)
+	}
+
+	binTable := bin.NewTable()
+	if cfg.Cards.BINTableFile != "" {
+		binTable, err = bin.LoadFile(cfg.Cards.BINTableFile)
+		if err != nil {
+			log.Fatalf("Failed to load BIN table: %v", err)
+		}
+	}
+
+	notificationService := service.NewLogNotificationService()
+	cardService := service.NewCardService(cardRepo, cardVault, binTable, notificationService, outboxRepo, transactor, cfg.Cards)
+	customerService := service.NewCustomerService(customerRepo)
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo, cfg.APIKeys)
+	invoiceService := service.NewInvoiceService(
+		invoiceRepo,
+		subscriptionRepo,
+		cardRepo,
+		customerRepo,
+		invoiceRenderer,
+	)
+	dunningService := service.NewDunningService(
+		subscriptionRepo,
+		paymentAttemptRepo,
+		cardService,
+		customerRepo,
+		razorpayClient,
+		notificationService,
+		outboxRepo,
+		transactor,
+		cfg.Dunning,
+	)
 	razorpayService := service.NewRazorpayService(
 		razorpayClient,
 		subscriptionRepo,
+		refundRepo,
+		customerRepo,
+		dunningService,
+		invoiceService,
+		outboxRepo,
+		transactor,
 		cfg.Razorpay.WebhookSecret,
 	)
+	refundService := service.NewRefundService(
+		refundRepo,
+		subscriptionRepo,
+		razorpayService,
+	)
 	subscriptionService := service.NewSubscriptionService(
 		subscriptionRepo,
 		cardRepo,
 		razorpayService,
+		refundService,
+		customerService,
+		outboxRepo,
+		transactor,
+		tax.NewCalculator(cfg.Tax),
 		cfg, 
 	)
 
@@ -77,19 +156,50 @@ func main() {
 	subscriptionController := controller.NewSubscriptionController(
 		subscriptionService,
 		razorpayService, 
+		dunningService,
+		refundService,
 	)
-	webhookController := controller.NewWebhookController(razorpayService)
+	reconciliationService := service.NewReconciliationService(subscriptionRepo, razorpayClient, cfg.Reconciler)
+	outboxRelay := service.NewOutboxRelay(outboxRepo, service.NewEventPublisher(cfg.Outbox), cfg.Outbox)
+	
+	webhookController := controller.NewWebhookController(razorpayService, cfg.Razorpay.WebhookTestMode)
+	invoiceController := controller.NewInvoiceController(invoiceService)
+	customerController := controller.NewCustomerController(customerService)
+	apiKeyController := controller.NewAPIKeyController(apiKeyService)
 
 	
 	e := echo.New()
+	e.HTTPErrorHandler = controller.ErrorHandler
+	e.Validator = controller.NewValidator(subscriptionService)
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 	e.Use(middleware.CORS())
+	e.Use(auth.Middleware(authVerifier, apiKeyService, func(c echo.Context) bool {
+		// Webhooks are authenticated by their signature and /health is public.
+		return !strings.HasPrefix(c.Path(), "/api/")
+	}))
+
+	// Creating and renewing things charges cards, so these requests honour an
+	// Idempotency-Key header and a retried request is not run twice.
+	idempotencyStore := idempotency.NewStore(idempotencyRepo, cfg.Idempotency)
+	idempotentRoutes := map[string]bool{
+		"POST /api/cards":                    true,
+		"POST /api/subscriptions":            true,
+		"PUT /api/subscriptions/:id/renew":   true,
+		"PUT /api/subscriptions/:id/stop":    true,
+		"POST /api/subscriptions/:id/refund": true,
+	}
+	e.Use(idempotency.Middleware(idempotencyStore, func(c echo.Context) bool {
+		return !idempotentRoutes[c.Request().Method+" "+c.Path()]
+	}))
 
 	
 	cardController.RegisterRoutes(e)
 	subscriptionController.RegisterRoutes(e)
 	webhookController.RegisterRoutes(e)
+	invoiceController.RegisterRoutes(e)
+	customerController.RegisterRoutes(e)
+	apiKeyController.RegisterRoutes(e)
 
 	
 	e.GET("/health", func(c echo.Context) error {
@@ -97,6 +207,17 @@ func main() {
 	})
 
 	
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go runPeriodically(jobCtx, "dunning", cfg.Dunning.JobInterval, dunningService.ProcessDueRetries)
+	go runPeriodically(jobCtx, "scheduled-resumes", cfg.Scheduler.Interval, subscriptionService.ProcessScheduledResumes)
+	go runPeriodically(jobCtx, "scheduled-cancellations", cfg.Scheduler.Interval, subscriptionService.ProcessScheduledCancellations)
+	go runPeriodically(jobCtx, "card-expiry", cfg.Cards.ExpiryJobInterval, cardService.ProcessExpiringCards)
+	go runPeriodically(jobCtx, "idempotency-keys", cfg.Idempotency.CleanupInterval, idempotencyStore.PurgeExpired)
+	go runPeriodically(jobCtx, "gateway-reconciliation", cfg.Reconciler.Interval, reconciliationService.ReconcileGatewaySubscriptions)
+	go runPeriodically(jobCtx, "outbox-relay", cfg.Outbox.RelayInterval, outboxRelay.PublishPending)
+
+	
 	go func() {
 		if err := e.Start(":" + cfg.Server.Port); err != nil {
 			log.Printf("Server shutdown: %v", err)
@@ -108,6 +229,7 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
+	stopJobs()
 	
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -132,6 +254,23 @@ func setupDatabase(cfg *config.Config) (*sqlx.DB, error) {
 }
 
 
+func runPeriodically(ctx context.Context, name string, interval time.Duration, job func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := job(ctx); err != nil {
+				log.Printf("Background job %s failed: %v", name, err)
+			}
+		}
+	}
+}
+
+
 func maskString(s string) string {
 	if len(s) <= 2 {
 		return "**"
@@ -0,0 +1,49 @@
+// Command check-catalog reports subscriptions whose product is not the product
+// of their plan, or whose plan or product does not exist. These rows predate
+// the check in subscription creation and must be corrected by hand. It exits
+// with status 1 when any are found, so it can gate deploys.
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+
+	"subscription-management/internal/config"
+	"subscription-management/internal/repository"
+)
+
+func main() {
+	cfg := config.Load()
+
+	db, err := sqlx.Connect("mysql", cfg.DB.GetDSN())
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	mismatches, err := repository.NewSubscriptionRepository(db).GetCatalogMismatches(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to check catalog: %v", err)
+	}
+
+	for _, m := range mismatches {
+		switch {
+		case !m.PlanProductID.Valid:
+			log.Printf("Subscription %s (user %s): plan %s does not exist", m.SubscriptionID, m.UserID, m.PlanID)
+		case !m.ProductExists:
+			log.Printf("Subscription %s (user %s): product %s does not exist, plan %s belongs to %s", m.SubscriptionID, m.UserID, m.ProductID, m.PlanID, m.PlanProductID.String)
+		default:
+			log.Printf("Subscription %s (user %s): product %s, but plan %s belongs to %s", m.SubscriptionID, m.UserID, m.ProductID, m.PlanID, m.PlanProductID.String)
+		}
+	}
+
+	if len(mismatches) > 0 {
+		log.Printf("Found %d subscriptions that disagree with the catalog", len(mismatches))
+		os.Exit(1)
+	}
+	log.Println("All subscriptions match the catalog")
+}
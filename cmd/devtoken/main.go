@@ -0,0 +1,174 @@
+// Command devtoken creates a local signing key and mints bearer tokens for it,
+// so the API can be exercised without an identity provider:
+//
+//	go run ./cmd/devtoken init
+//	AUTH_JWKS_FILE=auth/jwks.json go run ./cmd/api
+//	go run ./cmd/devtoken sign -sub user-123
+//	go run ./cmd/devtoken sign -sub ops-1 -roles admin
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"subscription-management/internal/auth"
+)
+
+const (
+	privateKeyFile = "private.pem"
+	jwksFile       = "jwks.json"
+)
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "init":
+		err = runInit(os.Args[2:])
+	case "sign":
+		err = runSign(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	log.Fatal("usage: devtoken init [-dir auth] | devtoken sign -sub USER [-roles admin] [-ttl 1h] [-iss ISSUER] [-aud AUDIENCE] [-dir auth]")
+}
+
+func runInit(args []string) error {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	dir := flags.String("dir", "auth", "directory to write the key and JWKS to")
+	force := flags.Bool("force", false, "overwrite an existing key")
+	flags.Parse(args)
+
+	keyPath := filepath.Join(*dir, privateKeyFile)
+	if _, err := os.Stat(keyPath); err == nil && !*force {
+		return fmt.Errorf("%s already exists, pass -force to replace it", keyPath)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(*dir, 0o700); err != nil {
+		return err
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(keyPath, keyPEM, 0o600); err != nil {
+		return err
+	}
+
+	jwks, err := json.MarshalIndent(map[string]interface{}{
+		"keys": []map[string]string{publicJWK(&key.PublicKey)},
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	jwksPath := filepath.Join(*dir, jwksFile)
+	if err := os.WriteFile(jwksPath, jwks, 0o644); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %s and %s\n", keyPath, jwksPath)
+	return nil
+}
+
+func runSign(args []string) error {
+	flags := flag.NewFlagSet("sign", flag.ExitOnError)
+	dir := flags.String("dir", "auth", "directory holding the key written by init")
+	subject := flags.String("sub", "", "user ID to put in the token")
+	roles := flags.String("roles", "", "comma-separated roles, e.g. admin")
+	ttl := flags.Duration("ttl", time.Hour, "token lifetime")
+	issuer := flags.String("iss", os.Getenv("AUTH_ISSUER"), "issuer claim")
+	audience := flags.String("aud", os.Getenv("AUTH_AUDIENCE"), "audience claim")
+	flags.Parse(args)
+
+	if *subject == "" {
+		return errors.New("-sub is required")
+	}
+
+	keyPEM, err := os.ReadFile(filepath.Join(*dir, privateKeyFile))
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return errors.New("private key is not PEM encoded")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	claims := auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   *subject,
+			Issuer:    *issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(*ttl)),
+		},
+	}
+	if *audience != "" {
+		claims.Audience = jwt.ClaimStrings{*audience}
+	}
+	if *roles != "" {
+		claims.Roles = strings.Split(*roles, ",")
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = publicJWK(&key.PublicKey)["kid"]
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(signed)
+	return nil
+}
+
+// publicJWK encodes the public key as a JWK whose kid is its RFC 7638
+// thumbprint, so init and sign agree on it without extra state.
+func publicJWK(key *rsa.PublicKey) map[string]string {
+	n := base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+	e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+
+	thumbprint := sha256.Sum256([]byte(fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, e, n)))
+
+	return map[string]string{
+		"kty": "RSA",
+		"use": "sig",
+		"alg": "RS256",
+		"kid": base64.RawURLEncoding.EncodeToString(thumbprint[:]),
+		"n":   n,
+		"e":   e,
+	}
+}
@@ -0,0 +1,54 @@
+// Command refresh-card-bins re-derives the brand, issuer, country and funding
+// type of saved cards from their BIN, using the table in BIN_TABLE_FILE. Run
+// it after loading a new BIN table.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+
+	"subscription-management/internal/bin"
+	"subscription-management/internal/config"
+	"subscription-management/internal/repository"
+	"subscription-management/internal/service"
+	"subscription-management/internal/vault"
+)
+
+func main() {
+	batchSize := flag.Int("batch", 500, "number of cards to read per query")
+	flag.Parse()
+
+	cfg := config.Load()
+
+	if cfg.Cards.BINTableFile == "" {
+		log.Fatal("BIN_TABLE_FILE must be set")
+	}
+	binTable, err := bin.LoadFile(cfg.Cards.BINTableFile)
+	if err != nil {
+		log.Fatalf("Failed to load BIN table: %v", err)
+	}
+
+	db, err := sqlx.Connect("mysql", cfg.DB.GetDSN())
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	cardVault, err := vault.NewLocalVault(repository.NewVaultRepository(db), cfg.Vault)
+	if err != nil {
+		log.Fatalf("Failed to initialise card vault: %v", err)
+	}
+
+	cardService := service.NewCardService(repository.NewCardRepository(db), cardVault, binTable, service.NewLogNotificationService(), repository.NewOutboxRepository(db), repository.NewTransactor(db), cfg.Cards)
+
+	updated, err := cardService.RefreshBINMetadata(context.Background(), *batchSize)
+	if err != nil {
+		log.Fatalf("Updated %d cards before failing: %v", updated, err)
+	}
+
+	log.Printf("Updated %d cards", updated)
+}
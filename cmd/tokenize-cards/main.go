@@ -0,0 +1,56 @@
+// Command tokenize-cards moves raw card numbers saved before card
+// tokenization into the card vault and erases them from the cards table, then
+// fingerprints cards that were saved before fingerprinting. It is safe to
+// re-run; cards that are already done are skipped.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+
+	"subscription-management/internal/bin"
+	"subscription-management/internal/config"
+	"subscription-management/internal/repository"
+	"subscription-management/internal/service"
+	"subscription-management/internal/vault"
+)
+
+func main() {
+	batchSize := flag.Int("batch", 100, "number of cards to tokenize per query")
+	flag.Parse()
+
+	cfg := config.Load()
+
+	db, err := sqlx.Connect("mysql", cfg.DB.GetDSN())
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	cardVault, err := vault.NewLocalVault(repository.NewVaultRepository(db), cfg.Vault)
+	if err != nil {
+		log.Fatalf("Failed to initialise card vault: %v", err)
+	}
+
+	if err := cfg.Cards.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	cardService := service.NewCardService(repository.NewCardRepository(db), cardVault, bin.NewTable(), service.NewLogNotificationService(), repository.NewOutboxRepository(db), repository.NewTransactor(db), cfg.Cards)
+
+	converted, err := cardService.TokenizeLegacyCards(context.Background(), *batchSize)
+	if err != nil {
+		log.Fatalf("Tokenized %d cards before failing: %v", converted, err)
+	}
+	log.Printf("Tokenized %d cards", converted)
+
+	fingerprinted, err := cardService.FingerprintCards(context.Background(), *batchSize)
+	if err != nil {
+		log.Fatalf("Fingerprinted %d cards before failing: %v", fingerprinted, err)
+	}
+	log.Printf("Fingerprinted %d cards", fingerprinted)
+}
@@ -0,0 +1,84 @@
+// Package apperr defines the typed errors the services return. Each error has
+// a stable, machine-readable code that clients can rely on and a kind that
+// decides how the error is reported, so every layer classifies failures the
+// same way.
+package apperr
+
+import "errors"
+
+// Kind is the class of an error. The HTTP layer maps each kind to exactly one
+// status code.
+type Kind int
+
+const (
+	Internal Kind = iota
+	Invalid
+	Unauthenticated
+	Forbidden
+	NotFound
+	Conflict
+	Unavailable
+)
+
+// Error is a domain error. Two errors with the same code are the same error
+// for errors.Is, so a sentinel matches copies of it that carry a cause.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+// FieldError explains why one field of a request was rejected. Field is the
+// name the client used, Code is stable like Error.Code.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func New(kind Kind, code string, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Wrap returns a copy of e caused by err. The cause is kept for logs; clients
+// only see e's code and message.
+func (e *Error) Wrap(err error) *Error {
+	wrapped := *e
+	wrapped.Err = err
+	return &wrapped
+}
+
+// WithFields returns a copy of e that reports which fields were rejected.
+func (e *Error) WithFields(fields []FieldError) *Error {
+	withFields := *e
+	withFields.Fields = fields
+	return &withFields
+}
+
+// From returns the first Error in err's chain, or nil when err is not a
+// domain error.
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+
+	"subscription-management/internal/apperr"
+	"subscription-management/internal/model"
+)
+
+const (
+	principalKey = "auth.principal"
+	userIDKey    = "auth.userID"
+
+	// HeaderAPIKey carries a service-to-service API key.
+	HeaderAPIKey = "X-API-Key"
+)
+
+var (
+	ErrCredentialsRequired = apperr.New(apperr.Unauthenticated, "credentials_required", "bearer token or API key is required")
+	ErrBadCredentials      = apperr.New(apperr.Unauthenticated, "invalid_credentials", "invalid or expired credentials")
+	ErrActingForOtherUser  = apperr.New(apperr.Forbidden, "cannot_act_for_user", "cannot act on behalf of another user")
+	ErrAdminRequired       = apperr.New(apperr.Forbidden, "admin_required", "admin access is required")
+	ErrUserRequired        = apperr.New(apperr.Invalid, "user_required", "user ID is required")
+)
+
+// APIKeyAuthenticator resolves a presented API key to its stored record.
+type APIKeyAuthenticator interface {
+	Authenticate(ctx context.Context, key string) (*model.APIKey, error)
+}
+
+// Middleware authenticates requests with a bearer token or an API key.
+//
+// For a bearer token the subject becomes the user every handler acts for; an
+// admin may act for another user by passing ?userId=, anyone else passing a
+// different userId is rejected. An API key acts for no user of its own, so
+// it names the user with ?userId= and RequireScope limits what it can do.
+func Middleware(v *Verifier, keys APIKeyAuthenticator, skipper middleware.Skipper) echo.MiddlewareFunc {
+	if skipper == nil {
+		skipper = middleware.DefaultSkipper
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if skipper(c) {
+				return next(c)
+			}
+
+			requested := c.QueryParam("userId")
+
+			if apiKey := c.Request().Header.Get(HeaderAPIKey); apiKey != "" {
+				key, err := keys.Authenticate(c.Request().Context(), apiKey)
+				if err != nil {
+					log.Printf("Rejected API key: %v", err)
+					return unauthorized(c, ErrBadCredentials)
+				}
+
+				c.Set(principalKey, &Principal{
+					APIKeyID: key.ID,
+					Scopes:   key.Scopes,
+					Admin:    key.Scopes.Allows(model.ScopeAdminAll),
+				})
+				c.Set(userIDKey, requested)
+				return next(c)
+			}
+
+			token, ok := bearerToken(c.Request().Header.Get(echo.HeaderAuthorization))
+			if !ok {
+				return unauthorized(c, ErrCredentialsRequired)
+			}
+
+			principal, err := v.Verify(token)
+			if err != nil {
+				log.Printf("Rejected bearer token: %v", err)
+				return unauthorized(c, ErrBadCredentials)
+			}
+
+			userID := principal.UserID
+			if requested != "" && requested != principal.UserID {
+				if !principal.Admin {
+					return ErrActingForOtherUser
+				}
+				userID = requested
+			}
+
+			c.Set(principalKey, principal)
+			c.Set(userIDKey, userID)
+			return next(c)
+		}
+	}
+}
+
+// RequireScope restricts an API key to routes its scopes cover. End users are
+// not scoped; ownership checks in the services limit them to their own data.
+func RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			principal := PrincipalFrom(c)
+			if principal == nil {
+				return unauthorized(c, ErrCredentialsRequired)
+			}
+			if principal.IsAPIKey() && !principal.Scopes.Allows(scope) {
+				return apperr.New(apperr.Forbidden, "insufficient_scope", "API key lacks the "+scope+" scope")
+			}
+			return next(c)
+		}
+	}
+}
+
+// RequireUser rejects requests that do not identify a user to act for, which
+// happens when an API key omits ?userId=.
+func RequireUser() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if UserID(c) == "" {
+				return ErrUserRequired
+			}
+			return next(c)
+		}
+	}
+}
+
+// RequireAdmin restricts a route to callers holding the configured admin role
+// or an API key with the admin:* scope.
+func RequireAdmin() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			principal := PrincipalFrom(c)
+			if principal == nil {
+				return unauthorized(c, ErrCredentialsRequired)
+			}
+			if !principal.Admin {
+				return ErrAdminRequired
+			}
+			return next(c)
+		}
+	}
+}
+
+// PrincipalFrom returns the authenticated caller, or nil when the request did
+// not pass through Middleware.
+func PrincipalFrom(c echo.Context) *Principal {
+	principal, _ := c.Get(principalKey).(*Principal)
+	return principal
+}
+
+// UserID returns the user the request acts for: the token subject, or the
+// user an admin or API key named with ?userId=.
+func UserID(c echo.Context) string {
+	userID, _ := c.Get(userIDKey).(string)
+	return userID
+}
+
+// CanAccessUser reports whether the caller may read or change userID's data.
+// API keys may access any user; the route's scope decides what they can do.
+func CanAccessUser(c echo.Context, userID string) bool {
+	principal := PrincipalFrom(c)
+	if principal == nil {
+		return false
+	}
+	return principal.Admin || principal.IsAPIKey() || principal.UserID == userID
+}
+
+func bearerToken(header string) (string, bool) {
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+func unauthorized(c echo.Context, err error) error {
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="api"`)
+	return err
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"subscription-management/internal/config"
+	"subscription-management/internal/model"
+)
+
+var (
+	ErrInvalidToken   = errors.New("invalid bearer token")
+	ErrMissingSubject = errors.New("token has no subject")
+)
+
+// signingMethods are the asymmetric algorithms a token may be signed with.
+// HMAC is deliberately excluded: a JWKS only carries public keys.
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// Claims are the token claims the service relies on. The subject is the user
+// ID; roles grant access to admin routes.
+type Claims struct {
+	jwt.RegisteredClaims
+	Roles []string `json:"roles,omitempty"`
+}
+
+// Principal is the authenticated caller of a request: an end user identified
+// by a bearer token, or a backend service identified by an API key.
+type Principal struct {
+	UserID   string
+	Roles    []string
+	APIKeyID string
+	Scopes   model.Scopes
+	Admin    bool
+}
+
+func (p *Principal) IsAPIKey() bool {
+	return p.APIKeyID != ""
+}
+
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type Verifier struct {
+	keys      *KeySet
+	parser    *jwt.Parser
+	adminRole string
+}
+
+// NewVerifier loads the signing keys described by cfg. A local JWKS file takes
+// precedence, which lets tokens be verified offline in development and tests.
+func NewVerifier(cfg config.AuthConfig) (*Verifier, error) {
+	var (
+		keys *KeySet
+		err  error
+	)
+	switch {
+	case cfg.JWKSFile != "":
+		keys, err = NewFileKeySet(cfg.JWKSFile)
+	case cfg.JWKSURL != "":
+		keys, err = NewRemoteKeySet(cfg.JWKSURL)
+	case cfg.Issuer != "":
+		var url string
+		url, err = discoverJWKSURL(cfg.Issuer)
+		if err == nil {
+			keys, err = NewRemoteKeySet(url)
+		}
+	default:
+		err = errors.New("one of AUTH_JWKS_FILE, AUTH_JWKS_URL or AUTH_ISSUER must be set")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+
+	return &Verifier{
+		keys:      keys,
+		parser:    jwt.NewParser(options...),
+		adminRole: cfg.AdminRole,
+	}, nil
+}
+
+// Verify checks the token's signature and registered claims and returns the
+// caller it identifies.
+func (v *Verifier) Verify(tokenString string) (*Principal, error) {
+	claims := &Claims{}
+	_, err := v.parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return v.keys.Key(kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if claims.Subject == "" {
+		return nil, ErrMissingSubject
+	}
+
+	principal := &Principal{
+		UserID: claims.Subject,
+		Roles:  claims.Roles,
+	}
+	principal.Admin = v.adminRole != "" && principal.HasRole(v.adminRole)
+	return principal, nil
+}
+
+// discoverJWKSURL reads jwks_uri from the issuer's OpenID Connect discovery
+// document.
+func discoverJWKSURL(issuer string) (string, error) {
+	data, err := fetch(strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return "", fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+
+	var discovery struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.Unmarshal(data, &discovery); err != nil {
+		return "", fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+	if discovery.JWKSURI == "" {
+		return "", errors.New("OIDC discovery document has no jwks_uri")
+	}
+	return discovery.JWKSURI, nil
+}
@@ -0,0 +1,209 @@
+package bin
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Card brands, as stored in cards.card_type.
+const (
+	BrandVisa       = "VISA"
+	BrandMastercard = "MASTERCARD"
+	BrandAmex       = "AMEX"
+	BrandDiscover   = "DISCOVER"
+	BrandRuPay      = "RUPAY"
+	BrandMaestro    = "MAESTRO"
+	BrandDiners     = "DINERS"
+	BrandJCB        = "JCB"
+	BrandUnknown    = "UNKNOWN"
+)
+
+// Funding types of a card.
+const (
+	FundingCredit  = "credit"
+	FundingDebit   = "debit"
+	FundingPrepaid = "prepaid"
+)
+
+var ErrInvalidRange = errors.New("invalid BIN range")
+
+// Info is what is known about a card from its leading digits. Fields other
+// than Brand are empty when the BIN table has no entry for the card.
+type Info struct {
+	Brand   string
+	Issuer  string
+	Country string
+	Funding string
+}
+
+// Range covers the card numbers whose leading digits fall between Start and
+// End inclusive. Start and End have the same number of digits.
+type Range struct {
+	Start string
+	End   string
+	Info  Info
+}
+
+func (r Range) matches(number string) bool {
+	if len(number) < len(r.Start) {
+		return false
+	}
+	prefix := number[:len(r.Start)]
+	return prefix >= r.Start && prefix <= r.End
+}
+
+// Table resolves card numbers to brand and issuer details. The most specific
+// range wins, and ranges loaded from a file win over the built-in brand
+// ranges of the same length.
+type Table struct {
+	ranges []Range
+}
+
+// NewTable returns a table holding only the built-in brand ranges.
+func NewTable() *Table {
+	return &Table{}
+}
+
+// LoadFile reads a BIN table from CSV with the header
+// start,end,brand,issuer,country,funding. Country is an ISO 3166 alpha-2 code
+// and funding is credit, debit or prepaid; both may be empty.
+func LoadFile(path string) (*Table, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Load(file)
+}
+
+func Load(r io.Reader) (*Table, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 6
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read BIN table: %w", err)
+	}
+
+	table := NewTable()
+	for i, record := range records {
+		if i == 0 && strings.EqualFold(record[0], "start") {
+			continue
+		}
+
+		rng := Range{
+			Start: record[0],
+			End:   record[1],
+			Info: Info{
+				Brand:   strings.ToUpper(record[2]),
+				Issuer:  record[3],
+				Country: strings.ToUpper(record[4]),
+				Funding: strings.ToLower(record[5]),
+			},
+		}
+		if err := validateRange(rng); err != nil {
+			return nil, fmt.Errorf("BIN table line %d: %w", i+1, err)
+		}
+		table.ranges = append(table.ranges, rng)
+	}
+
+	return table, nil
+}
+
+// Lookup describes the card whose number or BIN is given.
+func (t *Table) Lookup(number string) Info {
+	var best *Range
+	for i := range t.ranges {
+		rng := &t.ranges[i]
+		if rng.matches(number) && (best == nil || len(rng.Start) > len(best.Start)) {
+			best = rng
+		}
+	}
+
+	brand := detectBrand(number)
+	if best == nil {
+		return Info{Brand: brand.name}
+	}
+
+	info := best.Info
+	if info.Brand == "" || len(best.Start) < brand.length {
+		info.Brand = brand.name
+	}
+	return info
+}
+
+func validateRange(rng Range) error {
+	if rng.Start == "" || len(rng.Start) != len(rng.End) || rng.Start > rng.End {
+		return fmt.Errorf("%w: %s-%s", ErrInvalidRange, rng.Start, rng.End)
+	}
+	for _, digits := range []string{rng.Start, rng.End} {
+		for _, ch := range digits {
+			if ch < '0' || ch > '9' {
+				return fmt.Errorf("%w: %s-%s", ErrInvalidRange, rng.Start, rng.End)
+			}
+		}
+	}
+	switch rng.Info.Funding {
+	case "", FundingCredit, FundingDebit, FundingPrepaid:
+	default:
+		return fmt.Errorf("unknown funding type %q", rng.Info.Funding)
+	}
+	return nil
+}
+
+type brandMatch struct {
+	name   string
+	length int
+}
+
+// brandRanges are the network-assigned prefixes of each brand. Longer,
+// more specific prefixes take precedence, which is how RuPay's ranges
+// inside the Discover and Maestro space are told apart.
+var brandRanges = []struct {
+	brand      string
+	start, end string
+}{
+	{BrandVisa, "4", "4"},
+	{BrandMastercard, "51", "55"},
+	{BrandMastercard, "2221", "2720"},
+	{BrandAmex, "34", "34"},
+	{BrandAmex, "37", "37"},
+	{BrandDiscover, "6011", "6011"},
+	{BrandDiscover, "644", "649"},
+	{BrandDiscover, "65", "65"},
+	{BrandDiners, "300", "305"},
+	{BrandDiners, "3095", "3095"},
+	{BrandDiners, "36", "36"},
+	{BrandDiners, "38", "39"},
+	{BrandJCB, "3528", "3589"},
+	{BrandMaestro, "5018", "5018"},
+	{BrandMaestro, "5020", "5020"},
+	{BrandMaestro, "5038", "5038"},
+	{BrandMaestro, "5893", "5893"},
+	{BrandMaestro, "56", "58"},
+	{BrandMaestro, "6304", "6304"},
+	{BrandMaestro, "6759", "6759"},
+	{BrandMaestro, "6761", "6763"},
+	{BrandRuPay, "508500", "508999"},
+	{BrandRuPay, "606985", "607984"},
+	{BrandRuPay, "608001", "608500"},
+	{BrandRuPay, "652150", "653149"},
+	{BrandRuPay, "817200", "820199"},
+}
+
+func detectBrand(number string) brandMatch {
+	best := brandMatch{name: BrandUnknown}
+	for _, rng := range brandRanges {
+		r := Range{Start: rng.start, End: rng.end}
+		if r.matches(number) && len(rng.start) > best.length {
+			best = brandMatch{name: rng.brand, length: len(rng.start)}
+		}
+	}
+	return best
+}
@@ -2,14 +2,29 @@ package config
 
 import (
 	"fmt"
+	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 
 type Config struct {
-	Server   ServerConfig
-	DB       DBConfig
-	Razorpay RazorpayConfig
+	Server      ServerConfig
+	DB          DBConfig
+	Razorpay    RazorpayConfig
+	Dunning     DunningConfig
+	Scheduler   SchedulerConfig
+	Company     CompanyConfig
+	Tax         TaxConfig
+	Auth        AuthConfig
+	APIKeys     APIKeyConfig
+	Vault       VaultConfig
+	Cards       CardConfig
+	Idempotency IdempotencyConfig
+	Reconciler  ReconcilerConfig
+	Outbox      OutboxConfig
 }
 
 
@@ -28,10 +43,218 @@ type DBConfig struct {
 }
 
 
+// RazorpayConfig holds the API keys and the secret webhooks are signed with.
+// WebhookTestMode lets ?test_mode=true webhooks skip signature verification
+// and is only meant for local testing.
 type RazorpayConfig struct {
 	KeyID     string
 	KeySecret string
 	WebhookSecret string
+	WebhookTestMode bool
+}
+
+
+// DunningConfig schedules payment retries. RetryScheduleDays are days after
+// the first failed payment, all inside the grace period.
+type DunningConfig struct {
+	GracePeriodDays   int
+	RetryScheduleDays []int
+	JobInterval       time.Duration
+}
+
+
+type SchedulerConfig struct {
+	Interval         time.Duration
+	CancellationLead time.Duration
+}
+
+
+type CompanyConfig struct {
+	Name    string
+	Address string
+	GSTIN   string
+	Email   string
+	Phone   string
+	LogoURL string
+}
+
+
+// TaxConfig describes the seller's tax registration. GSTRate and VATRates are
+// percentages; VATRates is keyed by ISO country code.
+type TaxConfig struct {
+	SellerCountry    string
+	SellerState      string
+	GSTRate          float64
+	PricesIncludeTax bool
+	VATRates         map[string]float64
+}
+
+
+// AuthConfig describes how bearer tokens are verified. Keys come from
+// JWKSFile when set, otherwise from JWKSURL, otherwise from the issuer's
+// OpenID Connect discovery document.
+type AuthConfig struct {
+	Issuer    string
+	Audience  string
+	JWKSFile  string
+	JWKSURL   string
+	AdminRole string
+	Leeway    time.Duration
+}
+
+
+// APIKeyConfig controls service-to-service API keys. A rotated key keeps
+// working for RotationGracePeriod so callers can switch over.
+type APIKeyConfig struct {
+	RotationGracePeriod time.Duration
+}
+
+
+// VaultConfig holds the master keys of the local card vault, base64-encoded
+// AES-256 keys by key ID. New entries are sealed with ActiveKeyID; the other
+// keys only need to stay until entries sealed with them are re-wrapped.
+type VaultConfig struct {
+	MasterKeys  map[string]string
+	ActiveKeyID string
+}
+
+
+// CardConfig holds the HMAC key card fingerprints are computed with, the
+// number of accounts sharing one card at which it is reported as suspicious,
+// the optional CSV of BIN ranges used to describe cards, how far ahead
+// customers are warned about cards that are about to expire, and the order in
+// which a user's other cards are tried after the default card.
+type CardConfig struct {
+	FingerprintKey      string
+	SharedCardThreshold int
+	BINTableFile        string
+	ExpiryNoticeDays    int
+	ExpiryJobInterval   time.Duration
+	FallbackOrder       string
+}
+
+
+// IdempotencyConfig controls how long Idempotency-Key responses are kept for
+// replay and how often expired ones are purged. A running request keeps its
+// key however long it takes by refreshing it a few times per LockTimeout, so
+// LockTimeout only bounds how long the key of a request whose server went away
+// keeps blocking retries.
+type IdempotencyConfig struct {
+	KeyTTL          time.Duration
+	LockTimeout     time.Duration
+	CleanupInterval time.Duration
+}
+
+
+// ReconcilerConfig controls the job that cancels Razorpay subscriptions no
+// saved subscription refers to. It looks at those created in the last Window
+// and leaves the ones younger than Grace alone, as they may still be saving.
+type ReconcilerConfig struct {
+	Interval time.Duration
+	Window   time.Duration
+	Grace    time.Duration
+}
+
+
+// OutboxConfig controls the relay that publishes domain events. Events are
+// POSTed to PublishURL, signed with SigningSecret when it is set, and only
+// logged when no URL is configured. A batch is claimed for ClaimTimeout, and
+// an event that has failed MaxAttempts times is dead-lettered.
+type OutboxConfig struct {
+	RelayInterval  time.Duration
+	BatchSize      int
+	MaxAttempts    int
+	ClaimTimeout   time.Duration
+	PublishURL     string
+	SigningSecret  string
+	PublishTimeout time.Duration
+}
+
+
+// Validate reports settings that load but cannot work together.
+func (c *Config) Validate() error {
+	if err := c.Dunning.Validate(); err != nil {
+		return err
+	}
+	if err := c.Cards.Validate(); err != nil {
+		return err
+	}
+	if err := c.Idempotency.Validate(); err != nil {
+		return err
+	}
+	if err := c.Outbox.Validate(); err != nil {
+		return err
+	}
+	return nil
+}
+
+
+// Validate checks that every retry in the schedule runs before the grace
+// period ends. Retry days are counted from the first failed payment.
+func (c *DunningConfig) Validate() error {
+	if c.GracePeriodDays <= 0 {
+		return fmt.Errorf("DUNNING_GRACE_PERIOD_DAYS must be positive, got %d", c.GracePeriodDays)
+	}
+	previous := 0
+	for _, day := range c.RetryScheduleDays {
+		if day <= previous {
+			return fmt.Errorf("DUNNING_RETRY_SCHEDULE_DAYS must be positive and increasing, got %v", c.RetryScheduleDays)
+		}
+		if day >= c.GracePeriodDays {
+			return fmt.Errorf("DUNNING_RETRY_SCHEDULE_DAYS %v has retries after the %d day grace period", c.RetryScheduleDays, c.GracePeriodDays)
+		}
+		previous = day
+	}
+	return nil
+}
+
+
+// minFingerprintKeyLength keeps the fingerprint key out of reach of a brute
+// force: with a short key, the few card numbers of a known BIN could be
+// matched against leaked fingerprints.
+const minFingerprintKeyLength = 32
+
+// Validate checks that card fingerprints are keyed. Without a key they are a
+// plain hash of the card number, which is cheap to reverse.
+func (c *CardConfig) Validate() error {
+	if c.FingerprintKey == "" {
+		return fmt.Errorf("CARD_FINGERPRINT_KEY must be set")
+	}
+	if len(c.FingerprintKey) < minFingerprintKeyLength {
+		return fmt.Errorf("CARD_FINGERPRINT_KEY must be at least %d bytes, got %d", minFingerprintKeyLength, len(c.FingerprintKey))
+	}
+	return nil
+}
+
+
+// Validate checks that a running request can refresh its key comfortably
+// within the lock timeout, and that an abandoned key is freed before it would
+// expire anyway.
+func (c *IdempotencyConfig) Validate() error {
+	if c.LockTimeout < time.Minute {
+		return fmt.Errorf("IDEMPOTENCY_LOCK_TIMEOUT must be at least 1m, got %s", c.LockTimeout)
+	}
+	if c.LockTimeout > c.KeyTTL {
+		return fmt.Errorf("IDEMPOTENCY_LOCK_TIMEOUT %s is longer than IDEMPOTENCY_KEY_TTL %s", c.LockTimeout, c.KeyTTL)
+	}
+	return nil
+}
+
+
+// Validate checks that the relay makes progress: a batch holds at least one
+// event, a failing event is eventually set aside, and a claim outlasts the
+// publish of an event.
+func (c *OutboxConfig) Validate() error {
+	if c.BatchSize <= 0 {
+		return fmt.Errorf("OUTBOX_BATCH_SIZE must be positive, got %d", c.BatchSize)
+	}
+	if c.MaxAttempts <= 0 {
+		return fmt.Errorf("OUTBOX_MAX_ATTEMPTS must be positive, got %d", c.MaxAttempts)
+	}
+	if c.ClaimTimeout <= c.PublishTimeout {
+		return fmt.Errorf("OUTBOX_CLAIM_TIMEOUT %s must be longer than OUTBOX_PUBLISH_TIMEOUT %s", c.ClaimTimeout, c.PublishTimeout)
+	}
+	return nil
 }
 
 
@@ -58,7 +281,74 @@ func Load() *Config {
 		Razorpay: RazorpayConfig{
 			KeyID:         "rzp_test_vwhPl6Bttiko87",
 			KeySecret:     "SxUsGLn9WAarMLSGrXBFB08o",
-			WebhookSecret: "webhook123",
+			WebhookSecret: getEnv("RAZORPAY_WEBHOOK_SECRET", "webhook123"),
+			WebhookTestMode: getEnvBool("RAZORPAY_WEBHOOK_TEST_MODE", false),
+		},
+		Dunning: DunningConfig{
+			GracePeriodDays:   getEnvInt("DUNNING_GRACE_PERIOD_DAYS", 7),
+			RetryScheduleDays: getEnvIntList("DUNNING_RETRY_SCHEDULE_DAYS", []int{1, 3, 5}),
+			JobInterval:       getEnvDuration("DUNNING_JOB_INTERVAL", time.Hour),
+		},
+		Scheduler: SchedulerConfig{
+			Interval:         getEnvDuration("SCHEDULER_INTERVAL", 15*time.Minute),
+			CancellationLead: getEnvDuration("CANCELLATION_LEAD", 24*time.Hour),
+		},
+		Company: CompanyConfig{
+			Name:    getEnv("COMPANY_NAME", "Subscription Management Pvt. Ltd."),
+			Address: getEnv("COMPANY_ADDRESS", ""),
+			GSTIN:   getEnv("COMPANY_GSTIN", ""),
+			Email:   getEnv("COMPANY_EMAIL", ""),
+			Phone:   getEnv("COMPANY_PHONE", ""),
+			LogoURL: getEnv("COMPANY_LOGO_URL", ""),
+		},
+		Tax: TaxConfig{
+			SellerCountry:    strings.ToUpper(getEnv("TAX_SELLER_COUNTRY", "IN")),
+			SellerState:      strings.ToUpper(getEnv("TAX_SELLER_STATE", "KA")),
+			GSTRate:          getEnvFloat("TAX_GST_RATE", 18),
+			PricesIncludeTax: getEnvBool("TAX_PRICES_INCLUDE_TAX", false),
+			VATRates:         getEnvRateMap("TAX_VAT_RATES", map[string]float64{}),
+		},
+		Auth: AuthConfig{
+			Issuer:    getEnv("AUTH_ISSUER", ""),
+			Audience:  getEnv("AUTH_AUDIENCE", ""),
+			JWKSFile:  getEnv("AUTH_JWKS_FILE", ""),
+			JWKSURL:   getEnv("AUTH_JWKS_URL", ""),
+			AdminRole: getEnv("AUTH_ADMIN_ROLE", "admin"),
+			Leeway:    getEnvDuration("AUTH_LEEWAY", 30*time.Second),
+		},
+		APIKeys: APIKeyConfig{
+			RotationGracePeriod: getEnvDuration("API_KEY_ROTATION_GRACE_PERIOD", 24*time.Hour),
+		},
+		Vault: VaultConfig{
+			MasterKeys:  getEnvSecretMap("VAULT_MASTER_KEYS"),
+			ActiveKeyID: getEnv("VAULT_ACTIVE_KEY_ID", "v1"),
+		},
+		Cards: CardConfig{
+			FingerprintKey:      getEnv("CARD_FINGERPRINT_KEY", ""),
+			SharedCardThreshold: getEnvInt("CARD_SHARED_THRESHOLD", 3),
+			BINTableFile:        getEnv("BIN_TABLE_FILE", ""),
+			ExpiryNoticeDays:    getEnvInt("CARD_EXPIRY_NOTICE_DAYS", 30),
+			ExpiryJobInterval:   getEnvDuration("CARD_EXPIRY_JOB_INTERVAL", 24*time.Hour),
+			FallbackOrder:       getEnv("CARD_FALLBACK_ORDER", "newest"),
+		},
+		Idempotency: IdempotencyConfig{
+			KeyTTL:          getEnvDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+			LockTimeout:     getEnvDuration("IDEMPOTENCY_LOCK_TIMEOUT", 10*time.Minute),
+			CleanupInterval: getEnvDuration("IDEMPOTENCY_CLEANUP_INTERVAL", time.Hour),
+		},
+		Reconciler: ReconcilerConfig{
+			Interval: getEnvDuration("RECONCILER_INTERVAL", time.Hour),
+			Window:   getEnvDuration("RECONCILER_WINDOW", 72*time.Hour),
+			Grace:    getEnvDuration("RECONCILER_GRACE", 30*time.Minute),
+		},
+		Outbox: OutboxConfig{
+			RelayInterval:  getEnvDuration("OUTBOX_RELAY_INTERVAL", 5*time.Second),
+			BatchSize:      getEnvInt("OUTBOX_BATCH_SIZE", 100),
+			MaxAttempts:    getEnvInt("OUTBOX_MAX_ATTEMPTS", 10),
+			ClaimTimeout:   getEnvDuration("OUTBOX_CLAIM_TIMEOUT", 2*time.Minute),
+			PublishURL:     getEnv("OUTBOX_PUBLISH_URL", ""),
+			SigningSecret:  getEnv("OUTBOX_SIGNING_SECRET", ""),
+			PublishTimeout: getEnvDuration("OUTBOX_PUBLISH_TIMEOUT", 10*time.Second),
 		},
 	}
 }
@@ -69,4 +359,122 @@ func getEnv(key, defaultValue string) string {
 		return value
 	}
 	return defaultValue
+}
+
+
+func getEnvInt(key string, defaultValue int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid integer for %s: %q, using default %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Invalid number for %s: %q, using default %v", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid boolean for %s: %q, using default %t", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+
+// getEnvRateMap parses "GB:20,DE:19" into a map of upper-cased keys to rates.
+func getEnvRateMap(key string, defaultValue map[string]float64) map[string]float64 {
+	value, exists := os.LookupEnv(key)
+	if !exists || strings.TrimSpace(value) == "" {
+		return defaultValue
+	}
+	result := make(map[string]float64)
+	for _, part := range strings.Split(value, ",") {
+		pair := strings.SplitN(part, ":", 2)
+		if len(pair) != 2 {
+			log.Printf("Invalid rate map for %s: %q, using default %v", key, value, defaultValue)
+			return defaultValue
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(pair[1]), 64)
+		if err != nil {
+			log.Printf("Invalid rate map for %s: %q, using default %v", key, value, defaultValue)
+			return defaultValue
+		}
+		result[strings.ToUpper(strings.TrimSpace(pair[0]))] = rate
+	}
+	return result
+}
+
+
+// getEnvSecretMap parses "v1:secret,v2:secret" into a map. Values are secrets,
+// so they are never logged.
+func getEnvSecretMap(key string) map[string]string {
+	result := make(map[string]string)
+	value, exists := os.LookupEnv(key)
+	if !exists || strings.TrimSpace(value) == "" {
+		return result
+	}
+	for _, part := range strings.Split(value, ",") {
+		pair := strings.SplitN(part, ":", 2)
+		if len(pair) != 2 {
+			log.Printf("Invalid entry in %s, ignoring it", key)
+			continue
+		}
+		result[strings.TrimSpace(pair[0])] = strings.TrimSpace(pair[1])
+	}
+	return result
+}
+
+
+func getEnvIntList(key string, defaultValue []int) []int {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	var result []int
+	for _, part := range strings.Split(value, ",") {
+		parsed, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			log.Printf("Invalid integer list for %s: %q, using default %v", key, value, defaultValue)
+			return defaultValue
+		}
+		result = append(result, parsed)
+	}
+	return result
+}
+
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration for %s: %q, using default %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
 }
\ No newline at end of file
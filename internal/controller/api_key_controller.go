@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"subscription-management/internal/auth"
+	"subscription-management/internal/service"
+)
+
+
+type APIKeyController struct {
+	apiKeyService service.APIKeyService
+}
+
+
+func NewAPIKeyController(apiKeyService service.APIKeyService) *APIKeyController {
+	return &APIKeyController{
+		apiKeyService: apiKeyService,
+	}
+}
+
+
+func (kc *APIKeyController) RegisterRoutes(e *echo.Echo) {
+	keys := e.Group("/api/admin/api-keys", auth.RequireAdmin())
+
+	keys.GET("", kc.ListKeys)
+	keys.POST("", kc.CreateKey)
+	keys.POST("/:id/rotate", kc.RotateKey)
+	keys.DELETE("/:id", kc.RevokeKey)
+}
+
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" validate:"required"`
+	Scopes []string `json:"scopes" validate:"required,min=1"`
+}
+
+
+func (kc *APIKeyController) ListKeys(c echo.Context) error {
+	keys, err := kc.apiKeyService.ListKeys(c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, keys)
+}
+
+
+func (kc *APIKeyController) CreateKey(c echo.Context) error {
+	var req CreateAPIKeyRequest
+	if err := bind(c, &req); err != nil {
+		return err
+	}
+
+	issued, err := kc.apiKeyService.CreateKey(c.Request().Context(), req.Name, req.Scopes)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, issued)
+}
+
+
+func (kc *APIKeyController) RotateKey(c echo.Context) error {
+	issued, err := kc.apiKeyService.RotateKey(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, issued)
+}
+
+
+func (kc *APIKeyController) RevokeKey(c echo.Context) error {
+	if err := kc.apiKeyService.RevokeKey(c.Request().Context(), c.Param("id")); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "API key revoked successfully"})
+}
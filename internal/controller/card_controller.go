@@ -2,10 +2,12 @@ package controller
 
 import (
 	"net/http"
+	"strconv"
 	
 
 	"github.com/labstack/echo/v4"
 
+	"subscription-management/internal/auth"
 	"subscription-management/internal/model"
 	"subscription-management/internal/service"
 )
@@ -25,20 +27,27 @@ func NewCardController(cardService service.CardService) *CardController {
 
 func (cc *CardController) RegisterRoutes(e *echo.Echo) {
 	cards := e.Group("/api/cards")
+	user := auth.RequireUser()
+	read := auth.RequireScope(model.ScopeCardsRead)
+	write := auth.RequireScope(model.ScopeCardsWrite)
 	
 	
-	cards.POST("", cc.CreateCard)
-	cards.GET("", cc.GetUserCards)
-	cards.GET("/:id", cc.GetCard)
-	cards.PUT("/:id", cc.UpdateCard)
-	cards.DELETE("/:id", cc.DeleteCard)
-	cards.PUT("/:id/default", cc.SetDefaultCard)
-	cards.DELETE("/all", cc.DeleteAllUserCards)
+	cards.POST("", cc.CreateCard, write, user)
+	cards.GET("", cc.GetUserCards, read, user)
+	cards.GET("/expiring", cc.GetExpiringCards, read, user)
+	cards.GET("/:id", cc.GetCard, read, user)
+	cards.PUT("/:id", cc.UpdateCard, write, user)
+	cards.DELETE("/:id", cc.DeleteCard, write, user)
+	cards.PUT("/:id/default", cc.SetDefaultCard, write, user)
+	cards.DELETE("/all", cc.DeleteAllUserCards, write, user)
+	
+	
+	admin := e.Group("/api/admin/cards", auth.RequireAdmin())
+	admin.GET("/shared", cc.GetSharedCards)
 }
 
 
 type CreateCardRequest struct {
-	UserID         string `json:"userId" validate:"required"`
 	CardNumber     string `json:"cardNumber" validate:"required"`
 	CardHolderName string `json:"cardHolderName" validate:"required"`
 	ExpiryMonth    int    `json:"expiryMonth" validate:"required,min=1,max=12"`
@@ -48,12 +57,12 @@ type CreateCardRequest struct {
 
 func (cc *CardController) CreateCard(c echo.Context) error {
 	var req CreateCardRequest
-	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	if err := bind(c, &req); err != nil {
+		return err
 	}
 	
 	card := &model.Card{
-		UserID:         req.UserID,
+		UserID:         auth.UserID(c),
 		CardNumber:     req.CardNumber,
 		CardHolderName: req.CardHolderName,
 		ExpiryMonth:    req.ExpiryMonth,
@@ -61,20 +70,8 @@ func (cc *CardController) CreateCard(c echo.Context) error {
 	}
 	
 	if err := cc.cardService.CreateCard(c.Request().Context(), card); err != nil {
-        switch err {
-        case service.ErrInvalidCardNumber:
-            return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid card number"})
-        case service.ErrInvalidExpiryDate:
-            return c.JSON(http.StatusBadRequest, map[string]string{"error": "Card has expired or has an invalid expiry date"})
-        case service.ErrInvalidCardHolderName:
-            return c.JSON(http.StatusBadRequest, map[string]string{"error": "Card holder name is required"})
-        default:
-            if err.Error() == "card already exists for this user" {
-                return c.JSON(http.StatusConflict, map[string]string{"error": "This card is already registered for this user"})
-            }
-            return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create card"})
-        }
-    }
+		return err
+	}
 	
 	
 	card.CardNumber = "XXXX-XXXX-XXXX-" + card.LastFourDigits
@@ -84,14 +81,11 @@ func (cc *CardController) CreateCard(c echo.Context) error {
 
 
 func (cc *CardController) GetUserCards(c echo.Context) error {
-	userID := c.QueryParam("userId")
-	if userID == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "User ID is required"})
-	}
+	userID := auth.UserID(c)
 	
 	cards, err := cc.cardService.GetUserCards(c.Request().Context(), userID)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve cards"})
+		return err
 	}
 	
 	
@@ -103,24 +97,39 @@ func (cc *CardController) GetUserCards(c echo.Context) error {
 }
 
 
-func (cc *CardController) GetCard(c echo.Context) error {
-	id := c.Param("id")
-	userID := c.QueryParam("userId")
+func (cc *CardController) GetExpiringCards(c echo.Context) error {
+	userID := auth.UserID(c)
 	
-	if userID == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "User ID is required"})
+	days := 0
+	if value := c.QueryParam("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return errInvalidDays
+		}
+		days = parsed
 	}
 	
+	cards, err := cc.cardService.GetExpiringCards(c.Request().Context(), userID, days)
+	if err != nil {
+		return err
+	}
+	
+	
+	for i := range cards {
+		cards[i].CardNumber = "XXXX-XXXX-XXXX-" + cards[i].LastFourDigits
+	}
+	
+	return c.JSON(http.StatusOK, cards)
+}
+
+
+func (cc *CardController) GetCard(c echo.Context) error {
+	id := c.Param("id")
+	userID := auth.UserID(c)
+	
 	card, err := cc.cardService.GetCard(c.Request().Context(), id, userID)
 	if err != nil {
-		switch err {
-		case service.ErrCardNotFound:
-			return c.JSON(http.StatusNotFound, map[string]string{"error": "Card not found"})
-		case service.ErrUnauthorized:
-			return c.JSON(http.StatusForbidden, map[string]string{"error": "Unauthorized access to this card"})
-		default:
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve card"})
-		}
+		return err
 	}
 	
 	
@@ -131,7 +140,6 @@ func (cc *CardController) GetCard(c echo.Context) error {
 
 
 type UpdateCardRequest struct {
-	UserID         string `json:"userId" validate:"required"`
 	CardHolderName string `json:"cardHolderName" validate:"required"`
 	ExpiryMonth    int    `json:"expiryMonth" validate:"required,min=1,max=12"`
 	ExpiryYear     int    `json:"expiryYear" validate:"required"`
@@ -142,31 +150,20 @@ func (cc *CardController) UpdateCard(c echo.Context) error {
 	id := c.Param("id")
 	
 	var req UpdateCardRequest
-	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	if err := bind(c, &req); err != nil {
+		return err
 	}
 	
 	card := &model.Card{
 		ID:             id,
-		UserID:         req.UserID,
+		UserID:         auth.UserID(c),
 		CardHolderName: req.CardHolderName,
 		ExpiryMonth:    req.ExpiryMonth,
 		ExpiryYear:     req.ExpiryYear,
 	}
 	
 	if err := cc.cardService.UpdateCard(c.Request().Context(), card); err != nil {
-		switch err {
-		case service.ErrCardNotFound:
-			return c.JSON(http.StatusNotFound, map[string]string{"error": "Card not found"})
-		case service.ErrUnauthorized:
-			return c.JSON(http.StatusForbidden, map[string]string{"error": "Unauthorized access to this card"})
-		case service.ErrInvalidExpiryDate:
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Card has expired or has an invalid expiry date"})
-		case service.ErrInvalidCardHolderName:
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Card holder name is required"})
-		default:
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update card"})
-		}
+		return err
 	}
 	
 	return c.JSON(http.StatusOK, map[string]string{"message": "Card updated successfully"})
@@ -175,21 +172,12 @@ func (cc *CardController) UpdateCard(c echo.Context) error {
 
 func (cc *CardController) DeleteCard(c echo.Context) error {
 	id := c.Param("id")
-	userID := c.QueryParam("userId")
+	userID := auth.UserID(c)
 	
-	if userID == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "User ID is required"})
-	}
+	replacementID := c.QueryParam("replacementCardId")
 	
-	if err := cc.cardService.DeleteCard(c.Request().Context(), id, userID); err != nil {
-		switch err {
-		case service.ErrCardNotFound:
-			return c.JSON(http.StatusNotFound, map[string]string{"error": "Card not found"})
-		case service.ErrUnauthorized:
-			return c.JSON(http.StatusForbidden, map[string]string{"error": "Unauthorized access to this card"})
-		default:
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete card"})
-		}
+	if err := cc.cardService.DeleteCard(c.Request().Context(), id, userID, replacementID); err != nil {
+		return err
 	}
 	
 	return c.JSON(http.StatusOK, map[string]string{"message": "Card deleted successfully"})
@@ -198,21 +186,10 @@ func (cc *CardController) DeleteCard(c echo.Context) error {
 
 func (cc *CardController) SetDefaultCard(c echo.Context) error {
 	id := c.Param("id")
-	userID := c.QueryParam("userId")
-	
-	if userID == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "User ID is required"})
-	}
+	userID := auth.UserID(c)
 	
 	if err := cc.cardService.SetDefaultCard(c.Request().Context(), userID, id); err != nil {
-		switch err {
-		case service.ErrCardNotFound:
-			return c.JSON(http.StatusNotFound, map[string]string{"error": "Card not found"})
-		case service.ErrUnauthorized:
-			return c.JSON(http.StatusForbidden, map[string]string{"error": "Unauthorized access to this card"})
-		default:
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to set card as default"})
-		}
+		return err
 	}
 	
 	return c.JSON(http.StatusOK, map[string]string{"message": "Card set as default successfully"})
@@ -221,15 +198,21 @@ func (cc *CardController) SetDefaultCard(c echo.Context) error {
 
 
 func (cc *CardController) DeleteAllUserCards(c echo.Context) error {
-    userID := c.QueryParam("userId")
-    
-    if userID == "" {
-        return c.JSON(http.StatusBadRequest, map[string]string{"error": "User ID is required"})
-    }
+    userID := auth.UserID(c)
     
     if err := cc.cardService.DeleteAllUserCards(c.Request().Context(), userID); err != nil {
-        return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete cards"})
+        return err
     }
     
     return c.JSON(http.StatusOK, map[string]string{"message": "All cards deleted successfully"})
+}
+
+
+func (cc *CardController) GetSharedCards(c echo.Context) error {
+	shared, err := cc.cardService.GetSharedCards(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	
+	return c.JSON(http.StatusOK, shared)
 }
\ No newline at end of file
@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"subscription-management/internal/auth"
+	"subscription-management/internal/model"
+	"subscription-management/internal/service"
+)
+
+
+type CustomerController struct {
+	customerService service.CustomerService
+}
+
+
+func NewCustomerController(customerService service.CustomerService) *CustomerController {
+	return &CustomerController{
+		customerService: customerService,
+	}
+}
+
+
+func (cc *CustomerController) RegisterRoutes(e *echo.Echo) {
+	customers := e.Group("/api/customers")
+
+	customers.GET("/:id", cc.GetCustomer, auth.RequireScope(model.ScopeCustomersRead))
+	customers.PUT("/:id", cc.UpdateCustomer, auth.RequireScope(model.ScopeCustomersWrite))
+}
+
+
+type UpdateCustomerRequest struct {
+	Name     string `json:"name"`
+	Email    string `json:"email" validate:"omitempty,email"`
+	Phone    string `json:"phone" validate:"omitempty,phone"`
+	Currency string `json:"currency"`
+}
+
+
+func (cc *CustomerController) GetCustomer(c echo.Context) error {
+	if !auth.CanAccessUser(c, c.Param("id")) {
+		return service.ErrUnauthorized
+	}
+
+	customer, err := cc.customerService.GetCustomer(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, customer)
+}
+
+
+func (cc *CustomerController) UpdateCustomer(c echo.Context) error {
+	if !auth.CanAccessUser(c, c.Param("id")) {
+		return service.ErrUnauthorized
+	}
+
+	var req UpdateCustomerRequest
+	if err := bind(c, &req); err != nil {
+		return err
+	}
+
+	customer := &model.UserInfo{
+		ID:       c.Param("id"),
+		Name:     req.Name,
+		Email:    req.Email,
+		Phone:    req.Phone,
+		Currency: req.Currency,
+	}
+
+	updated, err := cc.customerService.UpdateCustomer(c.Request().Context(), customer)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, updated)
+}
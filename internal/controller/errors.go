@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"subscription-management/internal/apperr"
+)
+
+// MIMEProblemJSON is the media type of RFC 7807 problem details.
+const MIMEProblemJSON = "application/problem+json"
+
+var (
+	errInvalidBody = apperr.New(apperr.Invalid, "invalid_request_body", "request body is malformed")
+	errInternal    = apperr.New(apperr.Internal, "internal_error", "an unexpected error occurred")
+
+	errInvalidDays          = apperr.New(apperr.Invalid, "invalid_days", "days must be a positive integer")
+	errNoActiveSubscription = apperr.New(apperr.NotFound, "subscription_not_found", "no active subscription found")
+	errMissingSignature     = apperr.New(apperr.Unauthenticated, "missing_webhook_signature", "X-Razorpay-Signature header is required")
+)
+
+// Problem is an RFC 7807 problem details document. Code is a stable,
+// machine-readable identifier of the error that clients should branch on
+// instead of Detail.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+
+	Errors []apperr.FieldError `json:"errors,omitempty"`
+}
+
+var kindStatus = map[apperr.Kind]int{
+	apperr.Internal:        http.StatusInternalServerError,
+	apperr.Invalid:         http.StatusBadRequest,
+	apperr.Unauthenticated: http.StatusUnauthorized,
+	apperr.Forbidden:       http.StatusForbidden,
+	apperr.NotFound:        http.StatusNotFound,
+	apperr.Conflict:        http.StatusConflict,
+	apperr.Unavailable:     http.StatusBadGateway,
+}
+
+// httpStatusCodes name the errors Echo raises itself, such as unknown routes
+// or unreadable bodies.
+var httpStatusCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusRequestEntityTooLarge: "request_too_large",
+	http.StatusUnsupportedMediaType:  "unsupported_media_type",
+	http.StatusTooManyRequests:       "too_many_requests",
+	http.StatusServiceUnavailable:    "service_unavailable",
+}
+
+// ErrorHandler is the Echo HTTPErrorHandler. Handlers and middleware return
+// errors and it renders all of them as problem+json: domain errors with their
+// own code and message, Echo's HTTP errors by status, and anything else as an
+// opaque 500 whose cause is only logged.
+func ErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	problem := problemFor(err)
+	problem.Instance = c.Request().URL.Path
+	if problem.Status >= http.StatusInternalServerError {
+		log.Printf("%s %s failed: %v", c.Request().Method, c.Request().URL.Path, err)
+	}
+
+	var sendErr error
+	if c.Request().Method == http.MethodHead {
+		sendErr = c.NoContent(problem.Status)
+	} else {
+		c.Response().Header().Set(echo.HeaderContentType, MIMEProblemJSON)
+		sendErr = c.JSON(problem.Status, problem)
+	}
+	if sendErr != nil {
+		log.Printf("Failed to send error response: %v", sendErr)
+	}
+}
+
+func problemFor(err error) *Problem {
+	if e := apperr.From(err); e != nil {
+		status := kindStatus[e.Kind]
+		if e.Kind == apperr.Internal {
+			e = errInternal
+		}
+		problem := newProblem(status, e.Code, e.Message)
+		problem.Errors = e.Fields
+		return problem
+	}
+
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		code, ok := httpStatusCodes[he.Code]
+		if !ok {
+			code = fmt.Sprintf("http_%d", he.Code)
+		}
+		detail := ""
+		if he.Code < http.StatusInternalServerError {
+			detail = fmt.Sprint(he.Message)
+		}
+		return newProblem(he.Code, code, detail)
+	}
+
+	return newProblem(http.StatusInternalServerError, errInternal.Code, errInternal.Message)
+}
+
+func newProblem(status int, code string, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
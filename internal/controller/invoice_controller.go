@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"subscription-management/internal/auth"
+	"subscription-management/internal/model"
+	"subscription-management/internal/service"
+)
+
+
+type InvoiceController struct {
+	invoiceService service.InvoiceService
+}
+
+
+func NewInvoiceController(invoiceService service.InvoiceService) *InvoiceController {
+	return &InvoiceController{
+		invoiceService: invoiceService,
+	}
+}
+
+
+func (ic *InvoiceController) RegisterRoutes(e *echo.Echo) {
+	invoices := e.Group("/api/invoices", auth.RequireScope(model.ScopeInvoicesRead), auth.RequireUser())
+
+	invoices.GET("", ic.GetUserInvoices)
+	invoices.GET("/:id", ic.GetInvoice)
+	invoices.GET("/:id/verify", ic.VerifyInvoice)
+}
+
+
+func (ic *InvoiceController) GetUserInvoices(c echo.Context) error {
+	userID := auth.UserID(c)
+
+	invoices, err := ic.invoiceService.GetUserInvoices(c.Request().Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, invoices)
+}
+
+
+func (ic *InvoiceController) GetInvoice(c echo.Context) error {
+	id := c.Param("id")
+	userID := auth.UserID(c)
+
+	// /api/invoices/:id.pdf and /api/invoices/:id.html download the rendered document
+	if dot := strings.LastIndex(id, "."); dot > 0 {
+		return ic.renderInvoice(c, id[:dot], userID, id[dot+1:])
+	}
+
+	invoice, err := ic.invoiceService.GetInvoice(c.Request().Context(), id, userID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, invoice)
+}
+
+
+func (ic *InvoiceController) renderInvoice(c echo.Context, id string, userID string, format string) error {
+	content, err := ic.invoiceService.RenderInvoice(c.Request().Context(), id, userID, format)
+	if err != nil {
+		return err
+	}
+
+	if format == "pdf" {
+		c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", id+".pdf"))
+		return c.Blob(http.StatusOK, "application/pdf", content)
+	}
+
+	return c.Blob(http.StatusOK, echo.MIMETextHTMLCharsetUTF8, content)
+}
+
+
+func (ic *InvoiceController) VerifyInvoice(c echo.Context) error {
+	id := c.Param("id")
+	userID := auth.UserID(c)
+
+	verification, err := ic.invoiceService.VerifyInvoice(c.Request().Context(), id, userID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, verification)
+}
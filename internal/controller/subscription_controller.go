@@ -1,11 +1,16 @@
 package controller
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"log"
+	"time"
 
 	"github.com/labstack/echo/v4"
 
+	"subscription-management/internal/apperr"
+	"subscription-management/internal/auth"
 	"subscription-management/internal/model"
 	"subscription-management/internal/service"
 )
@@ -14,41 +19,57 @@ import (
 type SubscriptionController struct {
 	subscriptionService service.SubscriptionService
 	razorpayService     service.RazorpayService
+	dunningService      service.DunningService
+	refundService       service.RefundService
 }
 
 
 func NewSubscriptionController(
 	subscriptionService service.SubscriptionService,
 	razorpayService service.RazorpayService,
+	dunningService service.DunningService,
+	refundService service.RefundService,
 ) *SubscriptionController {
 	return &SubscriptionController{
 		subscriptionService: subscriptionService,
 		razorpayService:     razorpayService,
+		dunningService:      dunningService,
+		refundService:       refundService,
 	}
 }
 
 
 func (sc *SubscriptionController) RegisterRoutes(e *echo.Echo) {
 	subscriptions := e.Group("/api/subscriptions")
+	user := auth.RequireUser()
+	read := auth.RequireScope(model.ScopeSubscriptionsRead)
+	write := auth.RequireScope(model.ScopeSubscriptionsWrite)
 	
 	
 	subscriptions.GET("/plans", sc.GetPlans)
-	subscriptions.GET("/active", sc.GetActiveSubscription)
-	subscriptions.GET("/history", sc.GetSubscriptionHistory)
-	subscriptions.POST("", sc.CreateSubscription)
-	subscriptions.PUT("/:id/renew", sc.RenewSubscription)
-	subscriptions.PUT("/:id/stop", sc.StopSubscription)
+	subscriptions.GET("/active", sc.GetActiveSubscription, read, user)
+	subscriptions.GET("/history", sc.GetSubscriptionHistory, read, user)
+	subscriptions.POST("", sc.CreateSubscription, write, user)
+	subscriptions.PUT("/:id/renew", sc.RenewSubscription, write, user)
+	subscriptions.PUT("/:id/stop", sc.StopSubscription, write, user)
+	subscriptions.PUT("/:id/undo-cancel", sc.UndoCancellation, write, user)
+	subscriptions.PUT("/:id/pause", sc.PauseSubscription, write, user)
+	subscriptions.PUT("/:id/resume", sc.ResumeSubscription, write, user)
+	subscriptions.PUT("/:id/card", sc.ChangeCard, write, user)
+	subscriptions.GET("/:id/payment-attempts", sc.GetPaymentAttempts, read, user)
+	subscriptions.POST("/:id/refund", sc.CreateRefund, write, user)
+	subscriptions.GET("/:id/refunds", sc.GetRefunds, read, user)
 	
 	
-	subscriptions.GET("/test-razorpay", sc.TestRazorpay)
-	subscriptions.POST("/verify-payment", sc.VerifyPayment)
+	subscriptions.GET("/test-razorpay", sc.TestRazorpay, auth.RequireAdmin())
+	subscriptions.POST("/verify-payment", sc.VerifyPayment, write)
 }
 
 
 func (sc *SubscriptionController) GetPlans(c echo.Context) error {
 	plans, err := sc.subscriptionService.GetAvailablePlans(c.Request().Context())
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve plans"})
+		return err
 	}
 	
 	return c.JSON(http.StatusOK, plans)
@@ -56,18 +77,15 @@ func (sc *SubscriptionController) GetPlans(c echo.Context) error {
 
 
 func (sc *SubscriptionController) GetActiveSubscription(c echo.Context) error {
-	userID := c.QueryParam("userId")
-	if userID == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "User ID is required"})
-	}
+	userID := auth.UserID(c)
 	
 	subscription, err := sc.subscriptionService.GetActiveSubscription(c.Request().Context(), userID)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve active subscription"})
+		return err
 	}
 	
 	if subscription == nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "No active subscription found"})
+		return errNoActiveSubscription
 	}
 	
 	return c.JSON(http.StatusOK, subscription)
@@ -75,14 +93,11 @@ func (sc *SubscriptionController) GetActiveSubscription(c echo.Context) error {
 
 
 func (sc *SubscriptionController) GetSubscriptionHistory(c echo.Context) error {
-	userID := c.QueryParam("userId")
-	if userID == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "User ID is required"})
-	}
+	userID := auth.UserID(c)
 	
 	history, err := sc.subscriptionService.GetSubscriptionHistory(c.Request().Context(), userID)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve subscription history"})
+		return err
 	}
 	
 	return c.JSON(http.StatusOK, history)
@@ -90,31 +105,66 @@ func (sc *SubscriptionController) GetSubscriptionHistory(c echo.Context) error {
 
 
 type CreateSubscriptionRequest struct {
-    UserID      string `json:"userId" validate:"required"`
-    ProductID   string `json:"productId" validate:"required"`
+    ProductID   string `json:"productId"`
     PlanID      string `json:"planId" validate:"required"`
     CardID      string `json:"cardId" validate:"required"`
-    PaymentType string `json:"paymentType" validate:"required"` 
+    PaymentType string `json:"paymentType" validate:"required,oneof=monthly yearly"`
     AutoRenewal bool   `json:"autoRenewal"`                   
     
    
     Name        string `json:"name"`
-    Email       string `json:"email"`
-    Phone       string `json:"phone"`
+    Email       string `json:"email" validate:"omitempty,email"`
+    Phone       string `json:"phone" validate:"omitempty,phone"`
+
+    BillingCountry string `json:"billingCountry"`
+    BillingState   string `json:"billingState"`
+    Currency       string `json:"currency"`
+}
+
+
+// validateFields checks that the plan exists and belongs to the product, so
+// a mismatched pair is rejected before any card or gateway work is done. The
+// product may be omitted, in which case the service takes it from the plan.
+func (r *CreateSubscriptionRequest) validateFields(ctx context.Context, v *Validator) ([]apperr.FieldError, error) {
+	if v.plans == nil {
+		return nil, nil
+	}
+	
+	plan, err := v.plans.GetPlan(ctx, r.PlanID)
+	if errors.Is(err, service.ErrInvalidPlan) {
+		return []apperr.FieldError{{
+			Field:   "planId",
+			Code:    "unknown_plan",
+			Message: "planId does not name an existing plan",
+		}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	
+	if r.ProductID != "" && plan.ProductID != r.ProductID {
+		return []apperr.FieldError{{
+			Field:   "productId",
+			Code:    service.ErrPlanProductMismatch.Code,
+			Message: "plan " + r.PlanID + " does not belong to product " + r.ProductID,
+		}}, nil
+	}
+	return nil, nil
 }
 
 
 func (sc *SubscriptionController) CreateSubscription(c echo.Context) error {
 	var req CreateSubscriptionRequest
-	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	if err := bind(c, &req); err != nil {
+		return err
 	}
 	
 	log.Printf("Received subscription request: %+v", req)
 	
+	userID := auth.UserID(c)
 	
 	userInfo := &model.UserInfo{
-		ID:    req.UserID,
+		ID:    userID,
 		Name:  req.Name,
 		Email: req.Email,
 		Phone: req.Phone,
@@ -122,28 +172,21 @@ func (sc *SubscriptionController) CreateSubscription(c echo.Context) error {
 	
 	
 	subscriptionReq := &model.SubscriptionRequest{
-		UserID:      req.UserID,
-		ProductID:   req.ProductID,
-		PlanID:      req.PlanID,
-		CardID:      req.CardID,
-		PaymentType: req.PaymentType,
-		AutoRenewal: req.AutoRenewal,
+		UserID:         userID,
+		ProductID:      req.ProductID,
+		PlanID:         req.PlanID,
+		CardID:         req.CardID,
+		PaymentType:    req.PaymentType,
+		AutoRenewal:    req.AutoRenewal,
+		BillingCountry: req.BillingCountry,
+		BillingState:   req.BillingState,
+		Currency:       req.Currency,
 	}
 	
 	
 	subscription, err := sc.subscriptionService.CreateSubscription(c.Request().Context(), subscriptionReq, userInfo)
 	if err != nil {
-		log.Printf("Error creating subscription: %v", err)
-		switch err {
-		case service.ErrInvalidPlan:
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid subscription plan"})
-		case service.ErrInvalidCard:
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid card"})
-		case service.ErrInvalidPaymentType:
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Payment type must be 'monthly' or 'yearly'"})
-		default:
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create subscription: " + err.Error()})
-		}
+		return err
 	}
 	
 	
@@ -163,54 +206,174 @@ func (sc *SubscriptionController) CreateSubscription(c echo.Context) error {
 
 func (sc *SubscriptionController) RenewSubscription(c echo.Context) error {
 	id := c.Param("id")
-	userID := c.QueryParam("userId")
-	
-	if userID == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "User ID is required"})
-	}
+	userID := auth.UserID(c)
 	
 	subscription, err := sc.subscriptionService.RenewSubscription(c.Request().Context(), id, userID)
 	if err != nil {
-		switch err {
-		case service.ErrSubscriptionNotFound:
-			return c.JSON(http.StatusNotFound, map[string]string{"error": "Subscription not found"})
-		default:
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to renew subscription"})
-		}
+		return err
 	}
 	
 	return c.JSON(http.StatusOK, subscription)
 }
 
 
+type StopSubscriptionRequest struct {
+	Mode   string `json:"mode" validate:"omitempty,oneof=immediate period_end"`
+	Refund bool   `json:"refund"`
+}
+
+
 func (sc *SubscriptionController) StopSubscription(c echo.Context) error {
 	id := c.Param("id")
-	userID := c.QueryParam("userId")
+	userID := auth.UserID(c)
+	
+	var req StopSubscriptionRequest
+	if err := bind(c, &req); err != nil {
+		return err
+	}
+	
+	result, err := sc.subscriptionService.StopSubscription(c.Request().Context(), id, userID, model.CancelOptions{
+		Mode:   req.Mode,
+		Refund: req.Refund,
+	})
+	if err != nil {
+		return err
+	}
+	
+	message := "Subscription stopped successfully"
+	if result.Subscription != nil && result.Subscription.CancelAtPeriodEnd {
+		message = "Subscription will be cancelled at the end of the current period"
+	}
+	
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":      message,
+		"subscription": result.Subscription,
+		"refundAmount": result.RefundAmount,
+		"refundId":     result.RefundID,
+	})
+}
+
+
+func (sc *SubscriptionController) UndoCancellation(c echo.Context) error {
+	id := c.Param("id")
+	userID := auth.UserID(c)
+	
+	subscription, err := sc.subscriptionService.UndoCancellation(c.Request().Context(), id, userID)
+	if err != nil {
+		return err
+	}
+	
+	return c.JSON(http.StatusOK, subscription)
+}
+
+
+type PauseSubscriptionRequest struct {
+	ResumeDate *time.Time `json:"resumeDate"`
+}
+
+
+func (sc *SubscriptionController) PauseSubscription(c echo.Context) error {
+	id := c.Param("id")
+	userID := auth.UserID(c)
 	
-	if userID == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "User ID is required"})
+	var req PauseSubscriptionRequest
+	if err := bind(c, &req); err != nil {
+		return err
+	}
+	
+	subscription, err := sc.subscriptionService.PauseSubscription(c.Request().Context(), id, userID, req.ResumeDate)
+	if err != nil {
+		return err
 	}
 	
-	if err := sc.subscriptionService.StopSubscription(c.Request().Context(), id, userID); err != nil {
-		switch err {
-		case service.ErrSubscriptionNotFound:
-			return c.JSON(http.StatusNotFound, map[string]string{"error": "Subscription not found or already inactive"})
-		default:
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to stop subscription"})
-		}
+	return c.JSON(http.StatusOK, subscription)
+}
+
+
+func (sc *SubscriptionController) ResumeSubscription(c echo.Context) error {
+	id := c.Param("id")
+	userID := auth.UserID(c)
+	
+	subscription, err := sc.subscriptionService.ResumeSubscription(c.Request().Context(), id, userID)
+	if err != nil {
+		return err
+	}
+	
+	return c.JSON(http.StatusOK, subscription)
+}
+
+
+type ChangeCardRequest struct {
+	CardID string `json:"cardId" validate:"required"`
+}
+
+
+func (sc *SubscriptionController) ChangeCard(c echo.Context) error {
+	id := c.Param("id")
+	userID := auth.UserID(c)
+	
+	var req ChangeCardRequest
+	if err := bind(c, &req); err != nil {
+		return err
+	}
+	
+	result, err := sc.subscriptionService.ChangeCard(c.Request().Context(), id, userID, req.CardID)
+	if err != nil {
+		return err
+	}
+	
+	return c.JSON(http.StatusOK, result)
+}
+
+
+func (sc *SubscriptionController) GetPaymentAttempts(c echo.Context) error {
+	id := c.Param("id")
+	userID := auth.UserID(c)
+	
+	attempts, err := sc.dunningService.GetPaymentAttempts(c.Request().Context(), id, userID)
+	if err != nil {
+		return err
+	}
+	
+	return c.JSON(http.StatusOK, attempts)
+}
+
+
+func (sc *SubscriptionController) CreateRefund(c echo.Context) error {
+	id := c.Param("id")
+	userID := auth.UserID(c)
+	
+	var req model.RefundRequest
+	if err := bind(c, &req); err != nil {
+		return err
+	}
+	
+	refund, err := sc.refundService.CreateRefund(c.Request().Context(), id, userID, &req)
+	if err != nil {
+		return err
+	}
+	
+	return c.JSON(http.StatusCreated, refund)
+}
+
+
+func (sc *SubscriptionController) GetRefunds(c echo.Context) error {
+	id := c.Param("id")
+	userID := auth.UserID(c)
+	
+	refunds, err := sc.refundService.GetRefunds(c.Request().Context(), id, userID)
+	if err != nil {
+		return err
 	}
 	
-	return c.JSON(http.StatusOK, map[string]string{"message": "Subscription stopped successfully"})
+	return c.JSON(http.StatusOK, refunds)
 }
 
 
 func (sc *SubscriptionController) TestRazorpay(c echo.Context) error {
 	result, err := sc.razorpayService.TestConnection(c.Request().Context())
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"status": "error",
-			"message": err.Error(),
-		})
+		return err
 	}
 	
 	return c.JSON(http.StatusOK, map[string]interface{}{
@@ -221,17 +384,17 @@ func (sc *SubscriptionController) TestRazorpay(c echo.Context) error {
 
 
 type VerifyPaymentRequest struct {
-	RazorpayPaymentID    string `json:"razorpay_payment_id"`
+	RazorpayPaymentID    string `json:"razorpay_payment_id" validate:"required"`
 	RazorpayOrderID      string `json:"razorpay_order_id"`
-	RazorpaySignature    string `json:"razorpay_signature"`
+	RazorpaySignature    string `json:"razorpay_signature" validate:"required"`
 	RazorpaySubscriptionID string `json:"razorpay_subscription_id"`
 }
 
 
 func (sc *SubscriptionController) VerifyPayment(c echo.Context) error {
 	var req VerifyPaymentRequest
-	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	if err := bind(c, &req); err != nil {
+		return err
 	}
 	
 	log.Printf("Verifying payment: %+v", req)
@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+
+	"subscription-management/internal/apperr"
+	"subscription-management/internal/model"
+)
+
+var errValidation = apperr.New(apperr.Invalid, "validation_failed", "request has invalid fields")
+
+// phonePattern accepts the contact numbers Razorpay takes for customers: up
+// to 15 digits with an optional leading +.
+var phonePattern = regexp.MustCompile(`^\+?[0-9]{8,15}$`)
+
+// PlanCatalog looks up the plans that subscription requests refer to.
+type PlanCatalog interface {
+	GetPlan(ctx context.Context, planID string) (*model.SubscriptionPlan, error)
+}
+
+// crossFieldRules is implemented by requests whose fields constrain each other
+// or must agree with stored data. The rules only run once every field passes
+// its own validate tags.
+type crossFieldRules interface {
+	validateFields(ctx context.Context, v *Validator) ([]apperr.FieldError, error)
+}
+
+// Validator checks bound requests against their validate tags and cross-field
+// rules. It is installed as the Echo validator and reports every rejected
+// field at once, named as the client sent it.
+type Validator struct {
+	validate *validator.Validate
+	plans    PlanCatalog
+}
+
+func NewValidator(plans PlanCatalog) *Validator {
+	validate := validator.New()
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	validate.RegisterValidation("phone", func(fl validator.FieldLevel) bool {
+		return phonePattern.MatchString(fl.Field().String())
+	})
+
+	return &Validator{
+		validate: validate,
+		plans:    plans,
+	}
+}
+
+// Validate implements echo.Validator.
+func (v *Validator) Validate(i interface{}) error {
+	return v.ValidateContext(context.Background(), i)
+}
+
+func (v *Validator) ValidateContext(ctx context.Context, i interface{}) error {
+	if err := v.validate.StructCtx(ctx, i); err != nil {
+		var invalid validator.ValidationErrors
+		if !errors.As(err, &invalid) {
+			return err
+		}
+		fields := make([]apperr.FieldError, 0, len(invalid))
+		for _, fe := range invalid {
+			fields = append(fields, fieldError(fe))
+		}
+		return errValidation.WithFields(fields)
+	}
+
+	rules, ok := i.(crossFieldRules)
+	if !ok {
+		return nil
+	}
+	fields, err := rules.validateFields(ctx, v)
+	if err != nil {
+		return err
+	}
+	if len(fields) > 0 {
+		return errValidation.WithFields(fields)
+	}
+	return nil
+}
+
+// bind decodes the request into req and validates it.
+func bind(c echo.Context, req interface{}) error {
+	if err := c.Bind(req); err != nil {
+		return errInvalidBody.Wrap(err)
+	}
+	if v, ok := c.Echo().Validator.(*Validator); ok {
+		return v.ValidateContext(c.Request().Context(), req)
+	}
+	return c.Validate(req)
+}
+
+func fieldError(fe validator.FieldError) apperr.FieldError {
+	var message string
+	switch fe.Tag() {
+	case "required":
+		message = "is required"
+	case "email":
+		message = "must be a valid email address"
+	case "phone":
+		message = "must be a phone number of 8 to 15 digits, optionally starting with +"
+	case "oneof":
+		message = "must be one of " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "min":
+		message = "must be at least " + fe.Param()
+		if unit := lengthUnit(fe.Kind()); unit != "" {
+			message = "must have at least " + fe.Param() + " " + unit
+		}
+	case "max":
+		message = "must be at most " + fe.Param()
+		if unit := lengthUnit(fe.Kind()); unit != "" {
+			message = "must have at most " + fe.Param() + " " + unit
+		}
+	default:
+		message = "is invalid"
+	}
+
+	return apperr.FieldError{
+		Field:   fe.Field(),
+		Code:    fe.Tag(),
+		Message: fe.Field() + " " + message,
+	}
+}
+
+// lengthUnit names what min and max count for fields that have a length, and
+// is empty for numbers, where they bound the value.
+func lengthUnit(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return "characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return "entries"
+	}
+	return ""
+}
@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"subscription-management/internal/apperr"
+	"subscription-management/internal/model"
+	"subscription-management/internal/service"
+)
+
+// memPlanCatalog serves plans from a map and counts lookups.
+type memPlanCatalog struct {
+	plans   map[string]*model.SubscriptionPlan
+	lookups int
+}
+
+func (c *memPlanCatalog) GetPlan(ctx context.Context, planID string) (*model.SubscriptionPlan, error) {
+	c.lookups++
+	if plan, ok := c.plans[planID]; ok {
+		return plan, nil
+	}
+	return nil, service.ErrInvalidPlan
+}
+
+func newTestValidator() (*Validator, *memPlanCatalog) {
+	plans := &memPlanCatalog{plans: map[string]*model.SubscriptionPlan{
+		"plan-basic": {ID: "plan-basic", ProductID: "prod-streaming"},
+	}}
+	return NewValidator(plans), plans
+}
+
+func validSubscriptionRequest() *CreateSubscriptionRequest {
+	return &CreateSubscriptionRequest{
+		ProductID:   "prod-streaming",
+		PlanID:      "plan-basic",
+		CardID:      "card-1",
+		PaymentType: "monthly",
+		Email:       "asha@example.test",
+		Phone:       "+919876543210",
+	}
+}
+
+// fieldCodes flattens a validation error into field → code.
+func fieldCodes(t *testing.T, err error) map[string]string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var appErr *apperr.Error
+	if !errors.As(err, &appErr) || !errors.Is(err, errValidation) {
+		t.Fatalf("error = %v, want a validation error", err)
+	}
+	codes := map[string]string{}
+	for _, field := range appErr.Fields {
+		codes[field.Field] = field.Code
+	}
+	return codes
+}
+
+func TestValidateCreateSubscriptionRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		edit        func(req *CreateSubscriptionRequest)
+		want        map[string]string
+		wantLookups int
+	}{
+		{"valid", func(req *CreateSubscriptionRequest) {}, nil, 1},
+		{"product may be omitted", func(req *CreateSubscriptionRequest) { req.ProductID = "" }, nil, 1},
+		{"contact details may be omitted", func(req *CreateSubscriptionRequest) { req.Email, req.Phone = "", "" }, nil, 1},
+		{"phone without +", func(req *CreateSubscriptionRequest) { req.Phone = "9876543210" }, nil, 1},
+		{"unknown payment type", func(req *CreateSubscriptionRequest) { req.PaymentType = "weekly" }, map[string]string{"paymentType": "oneof"}, 0},
+		{"missing payment type", func(req *CreateSubscriptionRequest) { req.PaymentType = "" }, map[string]string{"paymentType": "required"}, 0},
+		{"bad email", func(req *CreateSubscriptionRequest) { req.Email = "asha@" }, map[string]string{"email": "email"}, 0},
+		{"phone with letters", func(req *CreateSubscriptionRequest) { req.Phone = "+91-98765" }, map[string]string{"phone": "phone"}, 0},
+		{"phone too long", func(req *CreateSubscriptionRequest) { req.Phone = "+1234567890123456" }, map[string]string{"phone": "phone"}, 0},
+		{"every bad field is reported", func(req *CreateSubscriptionRequest) {
+			req.PlanID, req.CardID, req.Email = "", "", "nope"
+		}, map[string]string{"planId": "required", "cardId": "required", "email": "email"}, 0},
+		{"unknown plan", func(req *CreateSubscriptionRequest) { req.PlanID = "plan-gone" }, map[string]string{"planId": "unknown_plan"}, 1},
+		{"plan from another product", func(req *CreateSubscriptionRequest) { req.ProductID = "prod-music" }, map[string]string{"productId": service.ErrPlanProductMismatch.Code}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, plans := newTestValidator()
+			req := validSubscriptionRequest()
+			tt.edit(req)
+
+			got := fieldCodes(t, v.ValidateContext(context.Background(), req))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fields = %v, want %v", got, tt.want)
+			}
+			if plans.lookups != tt.wantLookups {
+				t.Errorf("plan looked up %d times, want %d", plans.lookups, tt.wantLookups)
+			}
+		})
+	}
+}
+
+func TestValidateWithoutPlanCatalog(t *testing.T) {
+	req := validSubscriptionRequest()
+	req.PlanID = "plan-gone"
+	if err := NewValidator(nil).Validate(req); err != nil {
+		t.Errorf("Validate = %v, want the plan rules skipped", err)
+	}
+}
+
+func TestValidateCreateCardRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		req         CreateCardRequest
+		wantField   string
+		wantCode    string
+		wantMessage string
+	}{
+		{"valid", CreateCardRequest{"4111111111111111", "Asha Rao", 12, 2030}, "", "", ""},
+		{"month above range", CreateCardRequest{"4111111111111111", "Asha Rao", 13, 2030}, "expiryMonth", "max", "expiryMonth must be at most 12"},
+		{"missing holder", CreateCardRequest{"4111111111111111", "", 12, 2030}, "cardHolderName", "required", "cardHolderName is required"},
+	}
+
+	v, _ := newTestValidator()
+	for _, tt := range tests {
+		err := v.Validate(&tt.req)
+		if tt.wantField == "" {
+			if err != nil {
+				t.Errorf("%s: Validate = %v", tt.name, err)
+			}
+			continue
+		}
+
+		var appErr *apperr.Error
+		if !errors.As(err, &appErr) || len(appErr.Fields) != 1 {
+			t.Fatalf("%s: Validate = %v, want one field error", tt.name, err)
+		}
+		if got := appErr.Fields[0]; got != (apperr.FieldError{Field: tt.wantField, Code: tt.wantCode, Message: tt.wantMessage}) {
+			t.Errorf("%s: field error = %+v", tt.name, got)
+		}
+	}
+}
+
+func TestFieldErrorMessages(t *testing.T) {
+	type request struct {
+		Scopes []string `json:"scopes" validate:"min=1"`
+		Name   string   `json:"name" validate:"max=3"`
+		Mode   string   `json:"mode" validate:"oneof=immediate period_end"`
+		Secret string   `json:"-" validate:"required"`
+	}
+
+	err := NewValidator(nil).Validate(&request{Scopes: []string{}, Name: "toolong", Mode: "later"})
+	var appErr *apperr.Error
+	if !errors.As(err, &appErr) {
+		t.Fatalf("Validate = %v, want a validation error", err)
+	}
+
+	want := map[string]string{
+		"scopes": "scopes must have at least 1 entries",
+		"name":   "name must have at most 3 characters",
+		"mode":   "mode must be one of immediate, period_end",
+		"Secret": "Secret is required",
+	}
+	got := map[string]string{}
+	for _, field := range appErr.Fields {
+		got[field.Field] = field.Message
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("messages = %v, want %v", got, want)
+	}
+}
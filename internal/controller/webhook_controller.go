@@ -12,13 +12,18 @@ import (
 )
 
 
+// WebhookController receives Razorpay webhooks. Webhooks move money, so their
+// signature is always verified unless allowTestMode is set, in which case a
+// ?test_mode=true request skips it. Never enable that in production.
 type WebhookController struct {
 	razorpayService service.RazorpayService
+	allowTestMode   bool
 }
 
-func NewWebhookController(razorpayService service.RazorpayService) *WebhookController {
+func NewWebhookController(razorpayService service.RazorpayService, allowTestMode bool) *WebhookController {
 	return &WebhookController{
 		razorpayService: razorpayService,
+		allowTestMode:   allowTestMode,
 	}
 }
 
@@ -29,23 +34,23 @@ func (wc *WebhookController) RegisterRoutes(e *echo.Echo) {
 func (wc *WebhookController) HandleRazorpayWebhook(c echo.Context) error {
 	body, err := ioutil.ReadAll(c.Request().Body)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Failed to read request body",
-		})
+		return errInvalidBody.Wrap(err)
 	}
 	
 	signature := c.Request().Header.Get("X-Razorpay-Signature")
 	
 	testMode := c.QueryParam("test_mode") == "true"
+	if testMode && !wc.allowTestMode {
+		log.Println("Webhook asked for TEST MODE, which is disabled - verifying its signature")
+		testMode = false
+	}
 	if testMode {
 		log.Println("Webhook received in TEST MODE - signature verification will be skipped")
 		if signature == "" {
 			signature = "test_signature"
 		}
 	} else if signature == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Missing Razorpay signature",
-		})
+		return errMissingSignature
 	}
 	
 	ctx := c.Request().Context()
@@ -55,9 +60,7 @@ func (wc *WebhookController) HandleRazorpayWebhook(c echo.Context) error {
 	
 	if err := wc.razorpayService.HandleWebhook(ctx, body, signature); err != nil {
 		log.Printf("Webhook error: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to process webhook: " + err.Error(),
-		})
+		return err
 	}
 	
 	return c.JSON(http.StatusOK, map[string]string{
@@ -0,0 +1,261 @@
+// Package idempotency makes mutating endpoints safe to retry. A request sent
+// with an Idempotency-Key header runs once; repeats of it with the same key
+// are answered with the stored response instead of running again.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+
+	"subscription-management/internal/apperr"
+	"subscription-management/internal/auth"
+	"subscription-management/internal/config"
+	"subscription-management/internal/model"
+	"subscription-management/internal/repository"
+)
+
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+)
+
+var (
+	ErrInvalidKey        = apperr.New(apperr.Invalid, "invalid_idempotency_key", "Idempotency-Key must be at most 255 characters")
+	ErrKeyReused         = apperr.New(apperr.Conflict, "idempotency_key_reused", "Idempotency-Key was already used for a different request")
+	ErrRequestInProgress = apperr.New(apperr.Conflict, "idempotency_request_in_progress", "a request with this Idempotency-Key is still being processed")
+)
+
+// Store keeps idempotency keys and their responses for KeyTTL. A request keeps
+// its key alive with heartbeats while it runs; a key whose heartbeat stopped
+// for LockTimeout belonged to a server that went away and is taken over.
+type Store struct {
+	repo        repository.IdempotencyRepository
+	ttl         time.Duration
+	lockTimeout time.Duration
+}
+
+func NewStore(repo repository.IdempotencyRepository, cfg config.IdempotencyConfig) *Store {
+	return &Store{
+		repo:        repo,
+		ttl:         cfg.KeyTTL,
+		lockTimeout: cfg.LockTimeout,
+	}
+}
+
+// PurgeExpired deletes the keys that are older than the TTL, after which a
+// key can be used again for any request.
+func (s *Store) PurgeExpired(ctx context.Context) error {
+	purged, err := s.repo.DeleteCreatedBefore(ctx, time.Now().Add(-s.ttl))
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		log.Printf("Purged %d expired idempotency keys", purged)
+	}
+	return nil
+}
+
+// claim records that record's request is running. When the owner already
+// used the key it returns the earlier record instead, unless that record has
+// expired, in which case it is replaced. A completed record expires after the
+// TTL; one still in progress when its heartbeat stops.
+func (s *Store) claim(ctx context.Context, record *model.IdempotencyKey) (*model.IdempotencyKey, error) {
+	for {
+		created, err := s.repo.Create(ctx, record)
+		if err != nil || created {
+			return nil, err
+		}
+
+		existing, err := s.repo.Get(ctx, record.Owner, record.Key)
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			// Purged between the insert and the lookup.
+			continue
+		}
+		if !s.expired(existing) {
+			return existing, nil
+		}
+		if err := s.repo.Delete(ctx, existing.ID); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (s *Store) expired(record *model.IdempotencyKey) bool {
+	if record.Completed() {
+		return record.CreatedAt.Before(time.Now().Add(-s.ttl))
+	}
+	return record.LastSeen().Before(time.Now().Add(-s.lockTimeout))
+}
+
+// heartbeat refreshes record until the returned stop is called, so the key is
+// held for as long as its request runs, however slow the gateway is.
+func (s *Store) heartbeat(ctx context.Context, record *model.IdempotencyKey) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(s.lockTimeout / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				if err := s.repo.Heartbeat(ctx, record.ID, now); err != nil {
+					log.Printf("Failed to refresh idempotency key %s: %v", record.ID, err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// release gives up a key whose response was not stored, so the client can
+// retry with it.
+func (s *Store) release(ctx context.Context, record *model.IdempotencyKey) {
+	if err := s.repo.Delete(ctx, record.ID); err != nil {
+		log.Printf("Failed to release idempotency key %s: %v", record.ID, err)
+	}
+}
+
+// Middleware runs requests that carry an Idempotency-Key header at most once
+// per caller and key. Requests without the header run as usual. It must run
+// after auth.Middleware, since keys belong to the authenticated caller.
+//
+// Responses below 500 are stored and replayed with an Idempotent-Replayed
+// header. A 5xx response, a panic or a response that could not be stored
+// releases the key, so the client can retry with the same key. Reusing a key
+// for a different method, path, query or body, or while the first request is
+// still running, is a 409.
+func Middleware(store *Store, skipper middleware.Skipper) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(HeaderKey)
+			if key == "" || (skipper != nil && skipper(c)) {
+				return next(c)
+			}
+			if len(key) > maxKeyLength {
+				return ErrInvalidKey
+			}
+			principal := auth.PrincipalFrom(c)
+			if principal == nil {
+				return next(c)
+			}
+
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return err
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+			record := &model.IdempotencyKey{
+				Owner:       owner(principal),
+				Key:         key,
+				RequestHash: requestHash(c.Request(), body),
+				Method:      c.Request().Method,
+				Path:        c.Request().URL.Path,
+			}
+
+			// The outcome must be recorded even if the client goes away.
+			ctx := context.WithoutCancel(c.Request().Context())
+
+			existing, err := store.claim(ctx, record)
+			if err != nil {
+				return err
+			}
+			if existing != nil {
+				return replay(c, existing, record.RequestHash)
+			}
+
+			stored := false
+			stopHeartbeat := store.heartbeat(ctx, record)
+			recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+			defer func() {
+				stopHeartbeat()
+				c.Response().Writer = recorder.ResponseWriter
+				if !stored {
+					store.release(ctx, record)
+				}
+			}()
+
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			status := c.Response().Status
+			if status >= http.StatusInternalServerError {
+				return nil
+			}
+
+			contentType := c.Response().Header().Get(echo.HeaderContentType)
+			if err := store.repo.Complete(ctx, record.ID, status, contentType, recorder.body.Bytes(), time.Now()); err != nil {
+				log.Printf("Failed to store response for idempotency key %s: %v", record.ID, err)
+				return nil
+			}
+			stored = true
+			return nil
+		}
+	}
+}
+
+func replay(c echo.Context, existing *model.IdempotencyKey, requestHash string) error {
+	if existing.RequestHash != requestHash {
+		return ErrKeyReused
+	}
+	if !existing.Completed() {
+		return ErrRequestInProgress
+	}
+
+	c.Response().Header().Set(HeaderReplayed, "true")
+	status := int(existing.StatusCode.Int64)
+	if len(existing.ResponseBody) == 0 {
+		return c.NoContent(status)
+	}
+	return c.Blob(status, existing.ContentType.String, existing.ResponseBody)
+}
+
+// owner names the caller a key belongs to. Keys of an API key are shared by
+// every user it acts for; the user is part of the request hash instead.
+func owner(principal *auth.Principal) string {
+	if principal.IsAPIKey() {
+		return "key:" + principal.APIKeyID
+	}
+	return "user:" + principal.UserID
+}
+
+// requestHash identifies a request by its method, path, query and body.
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+"\n"+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder copies the response body as it is written.
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
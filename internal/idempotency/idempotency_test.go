@@ -0,0 +1,334 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+
+	"subscription-management/internal/auth"
+	"subscription-management/internal/config"
+	"subscription-management/internal/controller"
+	"subscription-management/internal/model"
+)
+
+// memIdempotencyRepository keeps keys in memory for tests. It is locked since
+// heartbeats arrive from another goroutine.
+type memIdempotencyRepository struct {
+	mu      sync.Mutex
+	records map[string]*model.IdempotencyKey
+}
+
+func newMemIdempotencyRepository() *memIdempotencyRepository {
+	return &memIdempotencyRepository{records: map[string]*model.IdempotencyKey{}}
+}
+
+func (r *memIdempotencyRepository) Create(ctx context.Context, key *model.IdempotencyKey) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.records[key.Owner+"/"+key.Key]; ok {
+		return false, nil
+	}
+	if key.ID == "" {
+		key.ID = uuid.New().String()
+	}
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+	stored := *key
+	r.records[key.Owner+"/"+key.Key] = &stored
+	return true, nil
+}
+
+func (r *memIdempotencyRepository) Get(ctx context.Context, owner string, key string) (*model.IdempotencyKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if record, ok := r.records[owner+"/"+key]; ok {
+		found := *record
+		return &found, nil
+	}
+	return nil, nil
+}
+
+func (r *memIdempotencyRepository) Heartbeat(ctx context.Context, id string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, record := range r.records {
+		if record.ID == id && !record.Completed() {
+			record.HeartbeatAt.Time, record.HeartbeatAt.Valid = at, true
+		}
+	}
+	return nil
+}
+
+func (r *memIdempotencyRepository) Complete(ctx context.Context, id string, statusCode int, contentType string, body []byte, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, record := range r.records {
+		if record.ID == id {
+			record.StatusCode.Int64, record.StatusCode.Valid = int64(statusCode), true
+			record.ContentType.String, record.ContentType.Valid = contentType, true
+			record.ResponseBody = append([]byte(nil), body...)
+			record.CompletedAt.Time, record.CompletedAt.Valid = at, true
+		}
+	}
+	return nil
+}
+
+func (r *memIdempotencyRepository) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, record := range r.records {
+		if record.ID == id {
+			delete(r.records, name)
+		}
+	}
+	return nil
+}
+
+func (r *memIdempotencyRepository) DeleteCreatedBefore(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var purged int64
+	for name, record := range r.records {
+		if record.CreatedAt.Before(before) {
+			delete(r.records, name)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// idKeys accepts every API key and uses it as the key's ID, so each test
+// caller is told apart by the key it sends.
+type idKeys struct{}
+
+func (idKeys) Authenticate(ctx context.Context, key string) (*model.APIKey, error) {
+	return &model.APIKey{ID: key}, nil
+}
+
+// newTestServer serves the routes below behind auth and idempotency the way
+// cmd/api does, and counts how often a handler ran.
+//
+//	POST /api/charges  201 with the number of calls
+//	POST /api/rejects  400
+//	POST /api/flaky    503 the first time, then 201
+//	POST /api/panics   panics the first time, then 201
+//	POST /api/slow     201 after three lock timeouts
+func newTestServer(repo *memIdempotencyRepository, lockTimeout time.Duration) (*echo.Echo, *int) {
+	calls := 0
+	e := echo.New()
+	e.HTTPErrorHandler = controller.ErrorHandler
+	e.Use(middleware.Recover())
+	e.Use(auth.Middleware(nil, idKeys{}, nil))
+	e.Use(Middleware(NewStore(repo, config.IdempotencyConfig{KeyTTL: 24 * time.Hour, LockTimeout: lockTimeout}), nil))
+
+	created := func(c echo.Context) error {
+		return c.JSON(http.StatusCreated, map[string]int{"call": calls})
+	}
+	e.POST("/api/charges", func(c echo.Context) error {
+		calls++
+		return created(c)
+	})
+	e.POST("/api/rejects", func(c echo.Context) error {
+		calls++
+		return echo.NewHTTPError(http.StatusBadRequest, "rejected")
+	})
+	e.POST("/api/flaky", func(c echo.Context) error {
+		calls++
+		if calls == 1 {
+			return echo.NewHTTPError(http.StatusServiceUnavailable)
+		}
+		return created(c)
+	})
+	e.POST("/api/panics", func(c echo.Context) error {
+		calls++
+		if calls == 1 {
+			panic("handler failed")
+		}
+		return created(c)
+	})
+	e.POST("/api/slow", func(c echo.Context) error {
+		calls++
+		time.Sleep(3 * lockTimeout)
+		return created(c)
+	})
+	return e, &calls
+}
+
+type step struct {
+	path         string
+	caller       string
+	key          string
+	body         string
+	wantStatus   int
+	wantReplayed bool
+	wantCode     string
+}
+
+func (s step) run(t *testing.T, e *echo.Echo) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, s.path, strings.NewReader(s.body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(auth.HeaderAPIKey, s.caller)
+	if s.key != "" {
+		req.Header.Set(HeaderKey, s.key)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != s.wantStatus {
+		t.Fatalf("POST %s with key %q: status = %d, want %d (%s)", s.path, s.key, rec.Code, s.wantStatus, rec.Body)
+	}
+	if replayed := rec.Header().Get(HeaderReplayed) == "true"; replayed != s.wantReplayed {
+		t.Errorf("POST %s with key %q: replayed = %v, want %v", s.path, s.key, replayed, s.wantReplayed)
+	}
+	if s.wantCode != "" {
+		var problem controller.Problem
+		if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil || problem.Code != s.wantCode {
+			t.Errorf("POST %s with key %q: body = %s, want code %q", s.path, s.key, rec.Body, s.wantCode)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	longKey := strings.Repeat("k", maxKeyLength+1)
+
+	tests := []struct {
+		name      string
+		steps     []step
+		wantCalls int
+	}{
+		{"repeat is replayed", []step{
+			{path: "/api/charges", caller: "a", key: "k1", body: `{"amount":100}`, wantStatus: 201},
+			{path: "/api/charges", caller: "a", key: "k1", body: `{"amount":100}`, wantStatus: 201, wantReplayed: true},
+		}, 1},
+		{"requests without a key always run", []step{
+			{path: "/api/charges", caller: "a", wantStatus: 201},
+			{path: "/api/charges", caller: "a", wantStatus: 201},
+		}, 2},
+		{"keys belong to their caller", []step{
+			{path: "/api/charges", caller: "a", key: "k1", wantStatus: 201},
+			{path: "/api/charges", caller: "b", key: "k1", wantStatus: 201},
+		}, 2},
+		{"key reused with another body", []step{
+			{path: "/api/charges", caller: "a", key: "k1", body: `{"amount":100}`, wantStatus: 201},
+			{path: "/api/charges", caller: "a", key: "k1", body: `{"amount":200}`, wantStatus: 409, wantCode: ErrKeyReused.Code},
+		}, 1},
+		{"key reused on another path", []step{
+			{path: "/api/charges", caller: "a", key: "k1", wantStatus: 201},
+			{path: "/api/rejects", caller: "a", key: "k1", wantStatus: 409, wantCode: ErrKeyReused.Code},
+		}, 1},
+		{"client errors are stored", []step{
+			{path: "/api/rejects", caller: "a", key: "k1", wantStatus: 400},
+			{path: "/api/rejects", caller: "a", key: "k1", wantStatus: 400, wantReplayed: true},
+		}, 1},
+		{"server errors release the key", []step{
+			{path: "/api/flaky", caller: "a", key: "k1", wantStatus: 503},
+			{path: "/api/flaky", caller: "a", key: "k1", wantStatus: 201},
+			{path: "/api/flaky", caller: "a", key: "k1", wantStatus: 201, wantReplayed: true},
+		}, 2},
+		{"panics release the key", []step{
+			{path: "/api/panics", caller: "a", key: "k1", wantStatus: 500},
+			{path: "/api/panics", caller: "a", key: "k1", wantStatus: 201},
+			{path: "/api/panics", caller: "a", key: "k1", wantStatus: 201, wantReplayed: true},
+		}, 2},
+		{"overlong key", []step{
+			{path: "/api/charges", caller: "a", key: longKey, wantStatus: 400, wantCode: ErrInvalidKey.Code},
+		}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemIdempotencyRepository()
+			e, calls := newTestServer(repo, 2*time.Minute)
+			for _, s := range tt.steps {
+				s.run(t, e)
+			}
+			if *calls != tt.wantCalls {
+				t.Errorf("handler ran %d times, want %d", *calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestMiddlewareEarlierRecord(t *testing.T) {
+	body := `{"amount":100}`
+	hash := requestHash(httptest.NewRequest(http.MethodPost, "/api/charges", nil), []byte(body))
+
+	tests := []struct {
+		name      string
+		age       time.Duration
+		heartbeat time.Duration
+		completed bool
+		want      step
+		wantCalls int
+	}{
+		{"still running", time.Minute, 0, false, step{wantStatus: 409, wantCode: ErrRequestInProgress.Code}, 0},
+		{"running past the lock timeout with a recent heartbeat", time.Hour, time.Minute, false, step{wantStatus: 409, wantCode: ErrRequestInProgress.Code}, 0},
+		{"heartbeat stopped", time.Hour, 3 * time.Minute, false, step{wantStatus: 201}, 1},
+		{"no heartbeat since the lock timeout", 3 * time.Minute, 0, false, step{wantStatus: 201}, 1},
+		{"completed within the TTL", 3 * time.Minute, 0, true, step{wantStatus: 200, wantReplayed: true}, 0},
+		{"completed before the TTL", 25 * time.Hour, 0, true, step{wantStatus: 201}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemIdempotencyRepository()
+			earlier := &model.IdempotencyKey{
+				Owner:       "key:a",
+				Key:         "k1",
+				RequestHash: hash,
+				Method:      http.MethodPost,
+				Path:        "/api/charges",
+				CreatedAt:   time.Now().Add(-tt.age),
+			}
+			if tt.heartbeat > 0 {
+				earlier.HeartbeatAt.Time, earlier.HeartbeatAt.Valid = time.Now().Add(-tt.heartbeat), true
+			}
+			repo.Create(context.Background(), earlier)
+			if tt.completed {
+				repo.Complete(context.Background(), earlier.ID, http.StatusOK, echo.MIMEApplicationJSON, []byte(`{"call":0}`), earlier.CreatedAt)
+			}
+
+			e, calls := newTestServer(repo, 2*time.Minute)
+			s := tt.want
+			s.path, s.caller, s.key, s.body = "/api/charges", "a", "k1", body
+			s.run(t, e)
+			if *calls != tt.wantCalls {
+				t.Errorf("handler ran %d times, want %d", *calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestMiddlewareHoldsKeyWhileRunning(t *testing.T) {
+	const lockTimeout = 40 * time.Millisecond
+	e, calls := newTestServer(newMemIdempotencyRepository(), lockTimeout)
+	first := step{path: "/api/slow", caller: "a", key: "k1", wantStatus: 201}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		first.run(t, e)
+	}()
+
+	// The first request has outlived the lock timeout but is still running.
+	time.Sleep(2 * lockTimeout)
+	step{path: "/api/slow", caller: "a", key: "k1", wantStatus: 409, wantCode: ErrRequestInProgress.Code}.run(t, e)
+	wg.Wait()
+
+	step{path: "/api/slow", caller: "a", key: "k1", wantStatus: 201, wantReplayed: true}.run(t, e)
+	if *calls != 1 {
+		t.Errorf("handler ran %d times, want 1", *calls)
+	}
+}
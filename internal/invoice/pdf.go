@@ -0,0 +1,132 @@
+package invoice
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const (
+	pageWidth    = 595.0 // A4 in points
+	pageHeight   = 842.0
+	pageMargin   = 50.0
+	bodyFontSize = 9.0
+)
+
+type pdfLine struct {
+	text string
+	size float64
+	bold bool
+	rule bool
+}
+
+// writePDF lays out pre-rendered text lines on A4 pages and serialises them as
+// a minimal PDF 1.4 document. Lines prefixed with "# " or "## " are set as
+// headings, "---" draws a horizontal rule and everything else is monospaced so
+// the template can align columns with padding.
+func writePDF(text string) ([]byte, error) {
+	var lines []pdfLine
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		raw := strings.TrimRight(scanner.Text(), " \t\r")
+		switch {
+		case strings.HasPrefix(raw, "## "):
+			lines = append(lines, pdfLine{text: raw[3:], size: 11, bold: true})
+		case strings.HasPrefix(raw, "# "):
+			lines = append(lines, pdfLine{text: raw[2:], size: 16, bold: true})
+		case raw == "---":
+			lines = append(lines, pdfLine{rule: true, size: bodyFontSize})
+		default:
+			lines = append(lines, pdfLine{text: raw, size: bodyFontSize})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var pages []string
+	var content bytes.Buffer
+	y := pageHeight - pageMargin
+	for _, line := range lines {
+		lineHeight := line.size * 1.5
+		if y-lineHeight < pageMargin {
+			pages = append(pages, content.String())
+			content.Reset()
+			y = pageHeight - pageMargin
+		}
+		y -= lineHeight
+
+		if line.rule {
+			fmt.Fprintf(&content, "0.5 w %.2f %.2f m %.2f %.2f l S\n",
+				pageMargin, y+line.size/2, pageWidth-pageMargin, y+line.size/2)
+			continue
+		}
+		if line.text == "" {
+			continue
+		}
+
+		font := "F2"
+		if line.bold {
+			font = "F1"
+		}
+		fmt.Fprintf(&content, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n",
+			font, line.size, pageMargin, y, escapePDFText(line.text))
+	}
+	pages = append(pages, content.String())
+
+	var out bytes.Buffer
+	var offsets []int
+	writeObject := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+
+	// Objects 1-4 are fixed; each page then takes a page object and a
+	// content stream, starting at object 5.
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+i*2)
+	}
+
+	writeObject("<< /Type /Catalog /Pages 2 0 R >>")
+	writeObject(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	writeObject("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	writeObject("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range pages {
+		writeObject(fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, 6+i*2))
+		writeObject(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(page), page))
+	}
+
+	xrefOffset := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xrefOffset)
+
+	return out.Bytes(), nil
+}
+
+// escapePDFText escapes PDF string delimiters and replaces characters outside
+// printable ASCII, which the standard Type1 fonts cannot show reliably.
+func escapePDFText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32 || r > 126:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,118 @@
+package invoice
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"subscription-management/internal/config"
+	"subscription-management/internal/model"
+	"subscription-management/internal/money"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+type Renderer struct {
+	company config.CompanyConfig
+	html    *htmltemplate.Template
+	text    *texttemplate.Template
+}
+
+type invoiceView struct {
+	Invoice      *model.Invoice
+	Company      config.CompanyConfig
+	ChargeItems  []model.InvoiceLineItem
+	TaxItems     []model.InvoiceLineItem
+	TaxableValue money.Money
+}
+
+func NewRenderer(company config.CompanyConfig) (*Renderer, error) {
+	funcs := map[string]interface{}{
+		"money": func(amount money.Money) string { return amount.Decimal() },
+		"date":  func(t time.Time) string { return t.Format("02 Jan 2006") },
+		"title": capitalize,
+		"pad":   func(s string, width int) string { return fmt.Sprintf("%*s", width, s) },
+		"rpad":  func(s string, width int) string { return fmt.Sprintf("%-*s", width, truncate(s, width-1)) },
+	}
+
+	html, err := htmltemplate.New("invoice.html.tmpl").Funcs(funcs).ParseFS(templateFS, "templates/invoice.html.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse invoice HTML template: %w", err)
+	}
+
+	text, err := texttemplate.New("invoice.pdf.tmpl").Funcs(funcs).ParseFS(templateFS, "templates/invoice.pdf.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse invoice PDF template: %w", err)
+	}
+
+	return &Renderer{
+		company: company,
+		html:    html,
+		text:    text,
+	}, nil
+}
+
+func (r *Renderer) HTML(invoice *model.Invoice) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := r.html.Execute(&buf, r.view(invoice)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (r *Renderer) PDF(invoice *model.Invoice) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := r.text.Execute(&buf, r.view(invoice)); err != nil {
+		return nil, err
+	}
+	return writePDF(buf.String())
+}
+
+// ContentHash returns the hex SHA-256 of the invoice's HTML rendering. It is
+// stored at issue time so later re-renders can be checked against it.
+func (r *Renderer) ContentHash(invoice *model.Invoice) (string, error) {
+	html, err := r.HTML(invoice)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(html)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (r *Renderer) view(invoice *model.Invoice) invoiceView {
+	view := invoiceView{
+		Invoice:      invoice,
+		Company:      r.company,
+		TaxableValue: money.Zero(invoice.Currency),
+	}
+	for _, item := range invoice.LineItems {
+		if item.Kind == model.LineItemKindTax {
+			view.TaxItems = append(view.TaxItems, item)
+			continue
+		}
+		view.ChargeItems = append(view.ChargeItems, item)
+		view.TaxableValue = view.TaxableValue.Add(item.Amount)
+	}
+	return view
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+func truncate(s string, width int) string {
+	if len(s) <= width {
+		return s
+	}
+	return s[:width-3] + "..."
+}
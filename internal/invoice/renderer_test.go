@@ -0,0 +1,140 @@
+package invoice
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"subscription-management/internal/config"
+	"subscription-management/internal/model"
+	"subscription-management/internal/money"
+)
+
+func testRenderer(t *testing.T) *Renderer {
+	t.Helper()
+	r, err := NewRenderer(config.CompanyConfig{
+		Name:    "Acme Subscriptions",
+		Address: "1 MG Road, Bengaluru",
+		GSTIN:   "29ABCDE1234F1Z5",
+		Email:   "billing@acme.test",
+	})
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+	return r
+}
+
+func testInvoice() *model.Invoice {
+	issued := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	return &model.Invoice{
+		ID:             "inv-1",
+		InvoiceNumber:  "INV-2024-000001",
+		TransactionID:  "txn-1",
+		UserID:         "user-1",
+		CustomerName:   "Asha Rao",
+		CustomerEmail:  "asha@example.test",
+		BillingCountry: sql.NullString{String: "IN", Valid: true},
+		BillingState:   sql.NullString{String: "KA", Valid: true},
+		ProductName:    "Streaming",
+		PlanName:       "Premium",
+		PlanAttributes: model.InvoiceAttributes{{Name: "screens", Value: "4"}},
+		PaymentType:    "monthly",
+		PeriodStart:    issued,
+		PeriodEnd:      issued.AddDate(0, 1, 0),
+		Currency:       "INR",
+		Subtotal:       money.New(99900, "INR"),
+		DiscountTotal:  money.Zero("INR"),
+		TaxTotal:       money.New(17982, "INR"),
+		Total:          money.New(117882, "INR"),
+		IssuedAt:       issued,
+		CreatedAt:      issued,
+		LineItems: []model.InvoiceLineItem{
+			{Kind: model.LineItemKindPlan, Description: "Streaming Premium", Quantity: 1, UnitAmount: money.New(99900, "INR"), Amount: money.New(99900, "INR")},
+			{Kind: model.LineItemKindTax, Description: "CGST 9%", Quantity: 1, UnitAmount: money.New(8991, "INR"), Amount: money.New(8991, "INR")},
+			{Kind: model.LineItemKindTax, Description: "SGST 9%", Quantity: 1, UnitAmount: money.New(8991, "INR"), Amount: money.New(8991, "INR")},
+		},
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	r := testRenderer(t)
+
+	base, err := r.ContentHash(testInvoice())
+	if err != nil {
+		t.Fatalf("ContentHash: %v", err)
+	}
+	if decoded, err := hex.DecodeString(base); err != nil || len(decoded) != 32 {
+		t.Fatalf("ContentHash = %q, want a hex SHA-256", base)
+	}
+
+	tests := []struct {
+		name    string
+		edit    func(inv *model.Invoice)
+		changed bool
+	}{
+		{"unchanged", func(inv *model.Invoice) {}, false},
+		{"total", func(inv *model.Invoice) { inv.Total = money.New(117883, "INR") }, true},
+		{"tax total", func(inv *model.Invoice) { inv.TaxTotal = money.New(0, "INR") }, true},
+		{"invoice number", func(inv *model.Invoice) { inv.InvoiceNumber = "INV-2024-000002" }, true},
+		{"customer name", func(inv *model.Invoice) { inv.CustomerName = "Asha R" }, true},
+		{"billing state", func(inv *model.Invoice) { inv.BillingState = sql.NullString{String: "MH", Valid: true} }, true},
+		{"period end", func(inv *model.Invoice) { inv.PeriodEnd = inv.PeriodEnd.AddDate(0, 0, 1) }, true},
+		{"payment id added", func(inv *model.Invoice) { inv.RazorpayPaymentID = sql.NullString{String: "pay_1", Valid: true} }, true},
+		{"line item amount", func(inv *model.Invoice) { inv.LineItems[1].Amount = money.New(8992, "INR") }, true},
+		{"line item removed", func(inv *model.Invoice) { inv.LineItems = inv.LineItems[:2] }, true},
+		{"plan attribute", func(inv *model.Invoice) { inv.PlanAttributes[0].Value = "2" }, true},
+		{"stored hash is not part of the content", func(inv *model.Invoice) { inv.ContentHash = sql.NullString{String: base, Valid: true} }, false},
+		{"row ids are not part of the content", func(inv *model.Invoice) { inv.ID = "inv-2"; inv.TransactionID = "txn-2" }, false},
+		{"created at is not part of the content", func(inv *model.Invoice) { inv.CreatedAt = inv.CreatedAt.Add(time.Hour) }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv := testInvoice()
+			tt.edit(inv)
+
+			got, err := r.ContentHash(inv)
+			if err != nil {
+				t.Fatalf("ContentHash: %v", err)
+			}
+			if (got != base) != tt.changed {
+				t.Errorf("hash changed = %v, want %v", got != base, tt.changed)
+			}
+		})
+	}
+}
+
+func TestContentHashMatchesHTML(t *testing.T) {
+	r := testRenderer(t)
+	inv := testInvoice()
+
+	first, err := r.HTML(inv)
+	if err != nil {
+		t.Fatalf("HTML: %v", err)
+	}
+	second, err := r.HTML(inv)
+	if err != nil {
+		t.Fatalf("HTML: %v", err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Fatal("rendering the same invoice twice gave different HTML")
+	}
+
+	for _, want := range []string{"INV-2024-000001", "Asha Rao", "1178.82", "CGST 9%"} {
+		if !bytes.Contains(first, []byte(want)) {
+			t.Errorf("HTML does not contain %q", want)
+		}
+	}
+}
+
+func TestPDF(t *testing.T) {
+	pdf, err := testRenderer(t).PDF(testInvoice())
+	if err != nil {
+		t.Fatalf("PDF: %v", err)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF-")) {
+		t.Errorf("PDF starts with %q, want %%PDF-", pdf[:8])
+	}
+}
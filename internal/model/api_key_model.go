@@ -0,0 +1,96 @@
+package model
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// API key scopes. A "<resource>:*" scope grants every action on the resource
+// and ScopeAdminAll grants everything.
+const (
+	ScopeCardsRead          = "cards:read"
+	ScopeCardsWrite         = "cards:write"
+	ScopeSubscriptionsRead  = "subscriptions:read"
+	ScopeSubscriptionsWrite = "subscriptions:write"
+	ScopeInvoicesRead       = "invoices:read"
+	ScopeCustomersRead      = "customers:read"
+	ScopeCustomersWrite     = "customers:write"
+	ScopeAdminAll           = "admin:*"
+)
+
+var knownScopes = map[string]bool{
+	ScopeCardsRead:          true,
+	ScopeCardsWrite:         true,
+	ScopeSubscriptionsRead:  true,
+	ScopeSubscriptionsWrite: true,
+	ScopeInvoicesRead:       true,
+	ScopeCustomersRead:      true,
+	ScopeCustomersWrite:     true,
+	ScopeAdminAll:           true,
+	"cards:*":               true,
+	"subscriptions:*":       true,
+	"invoices:*":            true,
+	"customers:*":           true,
+}
+
+func IsKnownScope(scope string) bool {
+	return knownScopes[scope]
+}
+
+// Scopes is stored as a comma-separated list.
+type Scopes []string
+
+// Allows reports whether the scopes grant scope, directly or by wildcard.
+func (s Scopes) Allows(scope string) bool {
+	resource, _, _ := strings.Cut(scope, ":")
+	for _, granted := range s {
+		if granted == scope || granted == ScopeAdminAll || granted == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Scopes) Value() (driver.Value, error) {
+	return strings.Join(s, ","), nil
+}
+
+func (s *Scopes) Scan(src interface{}) error {
+	list, err := scanList(src)
+	if err != nil {
+		return fmt.Errorf("cannot scan %T into Scopes", src)
+	}
+	*s = list
+	return nil
+}
+
+// APIKey identifies a backend service calling the API. Only a SHA-256 hash
+// of the key is stored; the key itself is shown once, when it is created.
+type APIKey struct {
+	ID          string         `json:"id" db:"id"`
+	Name        string         `json:"name" db:"name"`
+	Prefix      string         `json:"prefix" db:"prefix"`
+	KeyHash     string         `json:"-" db:"key_hash"`
+	Scopes      Scopes         `json:"scopes" db:"scopes"`
+	RotatedFrom sql.NullString `json:"rotatedFrom" db:"rotated_from"`
+	LastUsedAt  sql.NullTime   `json:"lastUsedAt" db:"last_used_at"`
+	RevokedAt   sql.NullTime   `json:"revokedAt" db:"revoked_at"`
+	CreatedAt   time.Time      `json:"createdAt" db:"created_at"`
+	UpdatedAt   time.Time      `json:"updatedAt" db:"updated_at"`
+}
+
+// IsActiveAt reports whether the key authenticates at t. A rotated key keeps
+// working until the revocation time set at rotation.
+func (k *APIKey) IsActiveAt(t time.Time) bool {
+	return !k.RevokedAt.Valid || t.Before(k.RevokedAt.Time)
+}
+
+// IssuedAPIKey is returned when a key is created or rotated. Key is the
+// plaintext secret and cannot be retrieved again.
+type IssuedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Domain event types published through the outbox.
+const (
+	EventSubscriptionCreated   = "SubscriptionCreated"
+	EventSubscriptionRenewed   = "SubscriptionRenewed"
+	EventSubscriptionCancelled = "SubscriptionCancelled"
+	EventPaymentFailed         = "PaymentFailed"
+	EventCardAdded             = "CardAdded"
+	EventCardExpiring          = "CardExpiring"
+)
+
+// Aggregates that events are about.
+const (
+	AggregateSubscription = "subscription"
+	AggregateCard         = "card"
+)
+
+// OutboxEvent is a domain event waiting in the outbox or already published.
+// Its JSON form is the envelope consumers receive; EventID is stable across
+// redeliveries and Data holds the event-specific fields.
+type OutboxEvent struct {
+	ID             int64           `json:"-" db:"id"`
+	EventID        string          `json:"id" db:"event_id"`
+	Type           string          `json:"type" db:"event_type"`
+	AggregateType  string          `json:"aggregateType" db:"aggregate_type"`
+	AggregateID    string          `json:"aggregateId" db:"aggregate_id"`
+	UserID         string          `json:"userId" db:"user_id"`
+	Data           json.RawMessage `json:"data" db:"payload"`
+	OccurredAt     time.Time       `json:"occurredAt" db:"occurred_at"`
+	PublishedAt    sql.NullTime    `json:"-" db:"published_at"`
+	ClaimedUntil   sql.NullTime    `json:"-" db:"claimed_until"`
+	DeadLetteredAt sql.NullTime    `json:"-" db:"dead_lettered_at"`
+	Attempts       int             `json:"-" db:"attempts"`
+	LastError      sql.NullString  `json:"-" db:"last_error"`
+}
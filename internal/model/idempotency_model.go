@@ -0,0 +1,39 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// IdempotencyKey records a mutating request sent with an Idempotency-Key
+// header. Owner is the caller the key belongs to, so two callers may pick the
+// same key. The response fields stay empty while the request is running, and
+// HeartbeatAt is refreshed for as long as it does.
+type IdempotencyKey struct {
+	ID           string         `db:"id"`
+	Owner        string         `db:"owner"`
+	Key          string         `db:"idempotency_key"`
+	RequestHash  string         `db:"request_hash"`
+	Method       string         `db:"method"`
+	Path         string         `db:"path"`
+	StatusCode   sql.NullInt64  `db:"status_code"`
+	ContentType  sql.NullString `db:"content_type"`
+	ResponseBody []byte         `db:"response_body"`
+	CreatedAt    time.Time      `db:"created_at"`
+	HeartbeatAt  sql.NullTime   `db:"heartbeat_at"`
+	CompletedAt  sql.NullTime   `db:"completed_at"`
+}
+
+// Completed reports whether the response of the request has been stored.
+func (k *IdempotencyKey) Completed() bool {
+	return k.CompletedAt.Valid
+}
+
+// LastSeen is when the request running under the key was last known to be
+// alive.
+func (k *IdempotencyKey) LastSeen() time.Time {
+	if k.HeartbeatAt.Valid {
+		return k.HeartbeatAt.Time
+	}
+	return k.CreatedAt
+}
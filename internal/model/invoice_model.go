@@ -0,0 +1,114 @@
+package model
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"subscription-management/internal/money"
+)
+
+const (
+	LineItemKindPlan     = "plan"
+	LineItemKindDiscount = "discount"
+	LineItemKindTax      = "tax"
+)
+
+type Invoice struct {
+	ID                string            `json:"id" db:"id"`
+	InvoiceNumber     string            `json:"invoiceNumber" db:"invoice_number"`
+	TransactionID     string            `json:"transactionId" db:"transaction_id"`
+	UserID            string            `json:"userId" db:"user_id"`
+	CustomerName      string            `json:"customerName" db:"customer_name"`
+	CustomerEmail     string            `json:"customerEmail" db:"customer_email"`
+	CustomerPhone     string            `json:"customerPhone" db:"customer_phone"`
+	BillingCountry    sql.NullString    `json:"billingCountry" db:"billing_country"`
+	BillingState      sql.NullString    `json:"billingState" db:"billing_state"`
+	ProductName       string            `json:"productName" db:"product_name"`
+	PlanName          string            `json:"planName" db:"plan_name"`
+	PlanAttributes    InvoiceAttributes `json:"planAttributes" db:"plan_attributes"`
+	PaymentType       string            `json:"paymentType" db:"payment_type"`
+	PeriodStart       time.Time         `json:"periodStart" db:"period_start"`
+	PeriodEnd         time.Time         `json:"periodEnd" db:"period_end"`
+	Currency          string            `json:"currency" db:"currency"`
+	Subtotal          money.Money       `json:"subtotal" db:"subtotal"`
+	DiscountTotal     money.Money       `json:"discountTotal" db:"discount_total"`
+	TaxTotal          money.Money       `json:"taxTotal" db:"tax_total"`
+	Total             money.Money       `json:"total" db:"total"`
+	RazorpayPaymentID sql.NullString    `json:"razorpayPaymentId" db:"razorpay_payment_id"`
+	IssuedAt          time.Time         `json:"issuedAt" db:"issued_at"`
+	ContentHash       sql.NullString    `json:"contentHash" db:"content_hash"`
+	CreatedAt         time.Time         `json:"createdAt" db:"created_at"`
+
+	LineItems []InvoiceLineItem `json:"lineItems" db:"-"`
+}
+
+type InvoiceLineItem struct {
+	ID          string      `json:"id" db:"id"`
+	InvoiceID   string      `json:"invoiceId" db:"invoice_id"`
+	Position    int         `json:"position" db:"position"`
+	Kind        string      `json:"kind" db:"kind"`
+	Description string      `json:"description" db:"description"`
+	Quantity    int         `json:"quantity" db:"quantity"`
+	UnitAmount  money.Money `json:"unitAmount" db:"unit_amount"`
+	Amount      money.Money `json:"amount" db:"amount"`
+	CreatedAt   time.Time   `json:"createdAt" db:"created_at"`
+}
+
+// ApplyCurrency stamps the invoice currency on its amounts and line items
+// after a scan.
+func (inv *Invoice) ApplyCurrency() {
+	inv.Subtotal = inv.Subtotal.WithCurrency(inv.Currency)
+	inv.DiscountTotal = inv.DiscountTotal.WithCurrency(inv.Currency)
+	inv.TaxTotal = inv.TaxTotal.WithCurrency(inv.Currency)
+	inv.Total = inv.Total.WithCurrency(inv.Currency)
+	for i := range inv.LineItems {
+		inv.LineItems[i].UnitAmount = inv.LineItems[i].UnitAmount.WithCurrency(inv.Currency)
+		inv.LineItems[i].Amount = inv.LineItems[i].Amount.WithCurrency(inv.Currency)
+	}
+}
+
+type InvoiceVerification struct {
+	InvoiceID    string `json:"invoiceId"`
+	ContentHash  string `json:"contentHash"`
+	RenderedHash string `json:"renderedHash"`
+	Matches      bool   `json:"matches"`
+}
+
+type InvoiceAttribute struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// InvoiceAttributes is a snapshot of the plan attributes at issue time, stored
+// as JSON so the invoice does not change when the catalog does.
+type InvoiceAttributes []InvoiceAttribute
+
+func (a InvoiceAttributes) Value() (driver.Value, error) {
+	if a == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (a *InvoiceAttributes) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	case nil:
+		*a = nil
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into InvoiceAttributes", src)
+	}
+	return json.Unmarshal(data, a)
+}
@@ -1,21 +1,72 @@
 package model
 
 import (
+	"database/sql"
+	"fmt"
+	"strings"
 	"time"
+
+	"subscription-management/internal/money"
 )
 
+// Card is a saved payment card. The PAN itself lives in the card vault and is
+// referenced by CardToken; CardNumber only carries it in on creation and the
+// masked number out in responses.
 type Card struct {
-	ID             string    `json:"id" db:"id"`
-	UserID         string    `json:"userId" db:"user_id"`
-	CardNumber     string    `json:"cardNumber" db:"card_number"`
-	CardHolderName string    `json:"cardHolderName" db:"card_holder_name"`
-	ExpiryMonth    int       `json:"expiryMonth" db:"expiry_month"`
-	ExpiryYear     int       `json:"expiryYear" db:"expiry_year"`
-	CardType       string    `json:"cardType" db:"card_type"`
-	LastFourDigits string    `json:"lastFourDigits" db:"last_four_digits"`
-	IsDefault      bool      `json:"isDefault" db:"is_default"`
-	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt      time.Time `json:"updatedAt" db:"updated_at"`
+	ID               string         `json:"id" db:"id"`
+	UserID           string         `json:"userId" db:"user_id"`
+	CardNumber       string         `json:"cardNumber" db:"-"`
+	LegacyCardNumber sql.NullString `json:"-" db:"card_number"`
+	CardToken        sql.NullString `json:"-" db:"card_token"`
+	RazorpayTokenID  sql.NullString `json:"-" db:"razorpay_token_id"`
+	BIN              string         `json:"bin" db:"bin"`
+	Fingerprint      sql.NullString `json:"-" db:"fingerprint"`
+	CardHolderName   string         `json:"cardHolderName" db:"card_holder_name"`
+	ExpiryMonth      int            `json:"expiryMonth" db:"expiry_month"`
+	ExpiryYear       int            `json:"expiryYear" db:"expiry_year"`
+	CardType         string         `json:"cardType" db:"card_type"`
+	Issuer           string         `json:"issuer" db:"issuer"`
+	IssuerCountry    string         `json:"issuerCountry" db:"issuer_country"`
+	FundingType      string         `json:"fundingType" db:"funding_type"`
+	LastFourDigits   string         `json:"lastFourDigits" db:"last_four_digits"`
+	IsDefault        bool           `json:"isDefault" db:"is_default"`
+	IsExpired        bool           `json:"isExpired" db:"is_expired"`
+	ExpiryNotifiedAt sql.NullTime   `json:"expiryNotifiedAt" db:"expiry_notified_at"`
+	DeletedAt        sql.NullTime   `json:"-" db:"deleted_at"`
+	CreatedAt        time.Time      `json:"createdAt" db:"created_at"`
+	UpdatedAt        time.Time      `json:"updatedAt" db:"updated_at"`
+}
+
+// ExpiresAt is the first instant the card can no longer be charged: the
+// start of the month after its expiry month.
+func (c *Card) ExpiresAt() time.Time {
+	return time.Date(c.ExpiryYear, time.Month(c.ExpiryMonth)+1, 1, 0, 0, 0, 0, time.Local)
+}
+
+// IsUsableAt reports whether the card can still be charged at t.
+func (c *Card) IsUsableAt(t time.Time) bool {
+	return !c.DeletedAt.Valid && !c.IsExpired && c.ExpiresAt().After(t)
+}
+
+// IsChargeable reports whether the card can be charged without the customer,
+// through the Razorpay token it was saved under.
+func (c *Card) IsChargeable() bool {
+	return c.RazorpayTokenID.Valid && c.RazorpayTokenID.String != ""
+}
+
+// PaymentCard is what a Razorpay payment entity says about the card it was
+// made with.
+type PaymentCard struct {
+	TokenID  string
+	LastFour string
+}
+
+// SharedCardFingerprint is a card number saved on several accounts, a signal
+// of card testing or account farming.
+type SharedCardFingerprint struct {
+	Fingerprint  string   `json:"fingerprint"`
+	AccountCount int      `json:"accountCount"`
+	UserIDs      []string `json:"userIds"`
 }
 
 type Subscription struct {
@@ -32,13 +83,13 @@ type Subscription struct {
 }
 
 type Plan struct {
-	ID             string    `json:"id" db:"id"`
-	Name           string    `json:"name" db:"name"`
-	Description    string    `json:"description" db:"description"`
-	Price          float64   `json:"price" db:"price"`
-	DurationMonths int       `json:"durationMonths" db:"duration_months"`
-	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt      time.Time `json:"updatedAt" db:"updated_at"`
+	ID             string      `json:"id" db:"id"`
+	Name           string      `json:"name" db:"name"`
+	Description    string      `json:"description" db:"description"`
+	Price          money.Money `json:"price" db:"price"`
+	DurationMonths int         `json:"durationMonths" db:"duration_months"`
+	CreatedAt      time.Time   `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time   `json:"updatedAt" db:"updated_at"`
 }
 
 type Payment struct {
@@ -46,7 +97,7 @@ type Payment struct {
 	SubscriptionID   string    `json:"subscriptionId" db:"subscription_id"`
 	PaymentMethod    string    `json:"paymentMethod" db:"payment_method"`
 	CardID           string    `json:"cardId" db:"card_id"`
-	Amount           float64   `json:"amount" db:"amount"`
+	Amount           money.Money `json:"amount" db:"amount"`
 	Currency         string    `json:"currency" db:"currency"`
 	Status           string    `json:"status" db:"status"`
 	RazorpayPaymentID string   `json:"razorpayPaymentId" db:"razorpay_payment_id"`
@@ -54,4 +105,27 @@ type Payment struct {
 	TransactionDate  time.Time `json:"transactionDate" db:"transaction_date"`
 	CreatedAt        time.Time `json:"createdAt" db:"created_at"`
 	UpdatedAt        time.Time `json:"updatedAt" db:"updated_at"`
-}
\ No newline at end of file
+}
+
+// scanList reads a comma-separated column into a slice, dropping blanks.
+func scanList(src interface{}) ([]string, error) {
+	var text string
+	switch v := src.(type) {
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	case nil:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %T", src)
+	}
+
+	var list []string
+	for _, item := range strings.Split(text, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+
+	"subscription-management/internal/money"
+)
+
+const (
+	RefundStatusPending   = "pending"
+	RefundStatusProcessed = "processed"
+	RefundStatusFailed    = "failed"
+)
+
+type Refund struct {
+	ID                string         `json:"id" db:"id"`
+	SubscriptionID    string         `json:"subscriptionId" db:"subscription_id"`
+	UserID            string         `json:"userId" db:"user_id"`
+	RazorpayPaymentID string         `json:"razorpayPaymentId" db:"razorpay_payment_id"`
+	RazorpayRefundID  sql.NullString `json:"razorpayRefundId" db:"razorpay_refund_id"`
+	Amount            money.Money    `json:"amount" db:"amount"`
+	Currency          string         `json:"currency" db:"currency"`
+	Reason            string         `json:"reason" db:"reason"`
+	Status            string         `json:"status" db:"status"`
+	FailureReason     sql.NullString `json:"failureReason" db:"failure_reason"`
+	CreatedAt         time.Time      `json:"createdAt" db:"created_at"`
+	UpdatedAt         time.Time      `json:"updatedAt" db:"updated_at"`
+}
+
+// RefundRequest.Amount is in minor units of the payment currency; nil refunds
+// the whole remaining balance.
+type RefundRequest struct {
+	Amount *int64 `json:"amount"`
+	Reason string `json:"reason"`
+}
@@ -2,7 +2,12 @@ package model
 
 import (
 	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
 	"time"
+
+	"subscription-management/internal/money"
 )
 
 type RazorpayPlan struct {
@@ -30,14 +35,60 @@ type SubscriptionProductAttribute struct {
 }
 
 type SubscriptionPlan struct {
-	ID           string    `json:"id" db:"id"`
-	ProductID    string    `json:"productId" db:"product_id"`
-	Name         string    `json:"name" db:"name"`
-	PriceMonthly float64   `json:"priceMonthly" db:"price_monthly"`
-	PriceYearly  float64   `json:"priceYearly" db:"price_yearly"`
-	Attributes   []SubscriptionProductAttribute `json:"attributes" db:"-"` 
-	CreatedAt    time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt    time.Time `json:"updatedAt" db:"updated_at"`
+	ID                  string       `json:"id" db:"id"`
+	ProductID           string       `json:"productId" db:"product_id"`
+	Name                string       `json:"name" db:"name"`
+	PriceMonthly        money.Money  `json:"priceMonthly" db:"price_monthly"`
+	PriceYearly         money.Money  `json:"priceYearly" db:"price_yearly"`
+	AllowedFundingTypes FundingTypes `json:"allowedFundingTypes" db:"allowed_funding_types"`
+	Attributes          []SubscriptionProductAttribute `json:"attributes" db:"-"` 
+	Prices              []PlanPrice  `json:"prices" db:"-"`
+	CreatedAt           time.Time    `json:"createdAt" db:"created_at"`
+	UpdatedAt           time.Time    `json:"updatedAt" db:"updated_at"`
+}
+
+// FundingTypes lists the card funding types a plan accepts, stored as a
+// comma-separated list. An empty list accepts every card.
+type FundingTypes []string
+
+// Allows reports whether a card of the given funding type is accepted. A card
+// whose funding type is unknown is only accepted by unrestricted plans.
+func (f FundingTypes) Allows(funding string) bool {
+	if len(f) == 0 {
+		return true
+	}
+	for _, allowed := range f {
+		if allowed == funding {
+			return true
+		}
+	}
+	return false
+}
+
+func (f FundingTypes) Value() (driver.Value, error) {
+	return strings.Join(f, ","), nil
+}
+
+func (f *FundingTypes) Scan(src interface{}) error {
+	list, err := scanList(src)
+	if err != nil {
+		return fmt.Errorf("cannot scan %T into FundingTypes", src)
+	}
+	*f = list
+	return nil
+}
+
+// PlanPrice is the price of a plan in one currency for one billing period,
+// with the Razorpay plan used for recurring billing at that price.
+type PlanPrice struct {
+	ID             string         `json:"id" db:"id"`
+	PlanID         string         `json:"planId" db:"plan_id"`
+	Currency       string         `json:"currency" db:"currency"`
+	PaymentType    string         `json:"paymentType" db:"payment_type"`
+	Amount         money.Money    `json:"amount" db:"amount"`
+	RazorpayPlanID sql.NullString `json:"razorpayPlanId" db:"razorpay_plan_id"`
+	CreatedAt      time.Time      `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time      `json:"updatedAt" db:"updated_at"`
 }
 
 type SubscriptionTransaction struct {
@@ -46,10 +97,17 @@ type SubscriptionTransaction struct {
     ProductID            string         `json:"productId" db:"product_id"`
     PlanID               string         `json:"planId" db:"plan_id"`
     CardID               string         `json:"cardId" db:"card_id"`
+    PendingCardID        sql.NullString `json:"pendingCardId" db:"pending_card_id"`
     IsRenewal            bool           `json:"isRenewal" db:"is_renewal"`
     IsActive             bool           `json:"isActive" db:"is_active"`
     PaymentType          string         `json:"paymentType" db:"payment_type"`
-    Amount               float64        `json:"amount" db:"amount"`
+    Currency             string         `json:"currency" db:"currency"`
+    Amount               money.Money    `json:"amount" db:"amount"`
+    AmountExclusive      money.Money    `json:"amountExclusive" db:"amount_exclusive"`
+    TaxAmount            money.Money    `json:"taxAmount" db:"tax_amount"`
+    TaxBreakdown         TaxBreakdown   `json:"taxBreakdown" db:"tax_breakdown"`
+    BillingCountry       sql.NullString `json:"billingCountry" db:"billing_country"`
+    BillingState         sql.NullString `json:"billingState" db:"billing_state"`
     StartDate            time.Time      `json:"startDate" db:"start_date"`
     EndDate              time.Time      `json:"endDate" db:"end_date"`
     NextRenewalDate      time.Time      `json:"nextRenewalDate" db:"next_renewal_date"`
@@ -60,6 +118,12 @@ type SubscriptionTransaction struct {
     RazorpaySubscriptionID sql.NullString `json:"razorpaySubscriptionId" db:"razorpay_subscription_id"`
     RazorpayKeyID        string         `json:"razorpayKeyId" db:"-"` 
     AutoRenewal          bool           `json:"autoRenewal" db:"auto_renewal"`
+    Status               string         `json:"status" db:"status"`
+    GracePeriodEndsAt    sql.NullTime   `json:"gracePeriodEndsAt" db:"grace_period_ends_at"`
+    PausedAt             sql.NullTime   `json:"pausedAt" db:"paused_at"`
+    ResumeAt             sql.NullTime   `json:"resumeAt" db:"resume_at"`
+    CancelAtPeriodEnd    bool           `json:"cancelAtPeriodEnd" db:"cancel_at_period_end"`
+    CancelAt             sql.NullTime   `json:"cancelAt" db:"cancel_at"`
  
     PlanName      string    `json:"planName" db:"-"`
     ProductName   string    `json:"productName" db:"-"`
@@ -67,17 +131,101 @@ type SubscriptionTransaction struct {
 }
 
 
+// ApplyCurrency stamps the row's currency on its amounts after a scan.
+func (t *SubscriptionTransaction) ApplyCurrency() {
+	t.Amount = t.Amount.WithCurrency(t.Currency)
+	t.AmountExclusive = t.AmountExclusive.WithCurrency(t.Currency)
+	t.TaxAmount = t.TaxAmount.WithCurrency(t.Currency)
+	for i := range t.TaxBreakdown {
+		t.TaxBreakdown[i].Amount.Currency = t.Currency
+	}
+}
+
+
+const (
+	SubscriptionStatusActive    = "active"
+	SubscriptionStatusPastDue   = "past_due"
+	SubscriptionStatusPaused    = "paused"
+	SubscriptionStatusCancelled = "cancelled"
+	SubscriptionStatusExpired   = "expired"
+)
+
+const (
+	CancelModeImmediate = "immediate"
+	CancelModePeriodEnd = "period_end"
+)
+
+type CancelOptions struct {
+	Mode   string `json:"mode"`
+	Refund bool   `json:"refund"`
+}
+
+type CardChangeResult struct {
+	Subscription *SubscriptionTransaction `json:"subscription"`
+	// Checkout holds the Razorpay Checkout options the client opens to
+	// authenticate the new card. It is nil when the gateway has no mandate
+	// to update; otherwise the subscription keeps its card, with the new one
+	// pending, until Razorpay confirms the change.
+	Checkout map[string]interface{} `json:"razorpay,omitempty"`
+}
+
+type CancellationResult struct {
+	Subscription *SubscriptionTransaction `json:"subscription"`
+	RefundAmount *money.Money             `json:"refundAmount,omitempty"`
+	RefundID     string                   `json:"refundId,omitempty"`
+	// RefundFailed is set when the subscription was cancelled but its refund
+	// could not be issued. It can be retried through the refund endpoint.
+	RefundFailed bool                     `json:"refundFailed,omitempty"`
+}
+
+const (
+	PaymentAttemptStatusFailed    = "failed"
+	PaymentAttemptStatusPending   = "pending"
+	PaymentAttemptStatusSucceeded = "succeeded"
+)
+
+type PaymentAttempt struct {
+	ID                string         `json:"id" db:"id"`
+	SubscriptionID    string         `json:"subscriptionId" db:"subscription_id"`
+	UserID            string         `json:"userId" db:"user_id"`
+	CardID            string         `json:"cardId" db:"card_id"`
+	AttemptNumber     int            `json:"attemptNumber" db:"attempt_number"`
+	Status            string         `json:"status" db:"status"`
+	FailureReason     sql.NullString `json:"failureReason" db:"failure_reason"`
+	RazorpayPaymentID sql.NullString `json:"razorpayPaymentId" db:"razorpay_payment_id"`
+	RazorpayOrderID   sql.NullString `json:"razorpayOrderId" db:"razorpay_order_id"`
+	NextRetryAt       sql.NullTime   `json:"nextRetryAt" db:"next_retry_at"`
+	CreatedAt         time.Time      `json:"createdAt" db:"created_at"`
+	UpdatedAt         time.Time      `json:"updatedAt" db:"updated_at"`
+}
+
+
 type SubscriptionPlanWithAttributes struct {
 	Plan       SubscriptionPlan                `json:"plan"`
 	Attributes []SubscriptionProductAttribute  `json:"attributes"`
 }
 
 type SubscriptionRequest struct {
-    UserID      string `json:"userId"`
-    ProductID   string `json:"productId"`
-    PlanID      string `json:"planId"`
-    CardID      string `json:"cardId"`
-    PaymentType string `json:"paymentType"` 
-    AutoRenewal bool   `json:"autoRenewal"` 
+    UserID         string `json:"userId"`
+    ProductID      string `json:"productId"`
+    PlanID         string `json:"planId"`
+    CardID         string `json:"cardId"`
+    PaymentType    string `json:"paymentType"` 
+    AutoRenewal    bool   `json:"autoRenewal"` 
+    BillingCountry string `json:"billingCountry"`
+    BillingState   string `json:"billingState"`
+    Currency       string `json:"currency"`
 }
 
+// CatalogMismatch is a subscription whose product is not the product of its
+// plan, or whose plan or product no longer exists. PlanProductID is null when
+// the plan is missing.
+type CatalogMismatch struct {
+	SubscriptionID string         `json:"subscriptionId" db:"subscription_id"`
+	UserID         string         `json:"userId" db:"user_id"`
+	PlanID         string         `json:"planId" db:"plan_id"`
+	ProductID      string         `json:"productId" db:"product_id"`
+	PlanProductID  sql.NullString `json:"planProductId" db:"plan_product_id"`
+	ProductExists  bool           `json:"productExists" db:"product_exists"`
+	CreatedAt      time.Time      `json:"createdAt" db:"created_at"`
+}
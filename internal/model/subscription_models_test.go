@@ -0,0 +1,93 @@
+package model
+
+import (
+	"testing"
+
+	"subscription-management/internal/money"
+)
+
+// scanned reads a DECIMAL column value the way the database driver hands it
+// over, before the row's currency is known.
+func scanned(t *testing.T, value string) money.Money {
+	t.Helper()
+	var m money.Money
+	if err := m.Scan([]byte(value)); err != nil {
+		t.Fatalf("Scan(%q): %v", value, err)
+	}
+	return m
+}
+
+func TestSubscriptionTransactionApplyCurrency(t *testing.T) {
+	tests := []struct {
+		currency      string
+		amount        string
+		exclusive     string
+		tax           string
+		wantAmount    int64
+		wantExclusive int64
+		wantTax       int64
+	}{
+		{"INR", "1178.82", "999.00", "179.82", 117882, 99900, 17982},
+		{"USD", "12.00", "10.00", "2.00", 1200, 1000, 200},
+		{"JPY", "1500.00", "1500.00", "0.00", 1500, 1500, 0},
+	}
+
+	for _, tt := range tests {
+		txn := &SubscriptionTransaction{
+			Currency:        tt.currency,
+			Amount:          scanned(t, tt.amount),
+			AmountExclusive: scanned(t, tt.exclusive),
+			TaxAmount:       scanned(t, tt.tax),
+			TaxBreakdown:    TaxBreakdown{{Name: "IGST 18%", Rate: 18, Amount: money.New(tt.wantTax, "")}},
+		}
+		txn.ApplyCurrency()
+
+		if txn.Amount != money.New(tt.wantAmount, tt.currency) {
+			t.Errorf("%s: Amount = %#v, want %d", tt.currency, txn.Amount, tt.wantAmount)
+		}
+		if txn.AmountExclusive != money.New(tt.wantExclusive, tt.currency) {
+			t.Errorf("%s: AmountExclusive = %#v, want %d", tt.currency, txn.AmountExclusive, tt.wantExclusive)
+		}
+		if txn.TaxAmount != money.New(tt.wantTax, tt.currency) {
+			t.Errorf("%s: TaxAmount = %#v, want %d", tt.currency, txn.TaxAmount, tt.wantTax)
+		}
+		if txn.TaxBreakdown[0].Amount != money.New(tt.wantTax, tt.currency) {
+			t.Errorf("%s: TaxBreakdown amount = %#v, want %d", tt.currency, txn.TaxBreakdown[0].Amount, tt.wantTax)
+		}
+	}
+}
+
+func TestInvoiceApplyCurrency(t *testing.T) {
+	tests := []struct {
+		currency  string
+		total     string
+		wantTotal int64
+	}{
+		{"INR", "1178.82", 117882},
+		{"EUR", "12.50", 1250},
+		{"JPY", "1500.00", 1500},
+	}
+
+	for _, tt := range tests {
+		inv := &Invoice{
+			Currency:      tt.currency,
+			Subtotal:      scanned(t, tt.total),
+			DiscountTotal: scanned(t, "0"),
+			TaxTotal:      scanned(t, "0"),
+			Total:         scanned(t, tt.total),
+			LineItems:     []InvoiceLineItem{{UnitAmount: scanned(t, tt.total), Amount: scanned(t, tt.total)}},
+		}
+		inv.ApplyCurrency()
+
+		want := money.New(tt.wantTotal, tt.currency)
+		if inv.Total != want || inv.Subtotal != want {
+			t.Errorf("%s: Total = %#v, Subtotal = %#v, want %#v", tt.currency, inv.Total, inv.Subtotal, want)
+		}
+		if inv.DiscountTotal != money.Zero(tt.currency) || inv.TaxTotal != money.Zero(tt.currency) {
+			t.Errorf("%s: zero totals = %#v, %#v", tt.currency, inv.DiscountTotal, inv.TaxTotal)
+		}
+		if inv.LineItems[0].Amount != want || inv.LineItems[0].UnitAmount != want {
+			t.Errorf("%s: line item = %#v", tt.currency, inv.LineItems[0])
+		}
+	}
+}
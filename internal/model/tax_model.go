@@ -0,0 +1,60 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"subscription-management/internal/money"
+)
+
+type TaxLine struct {
+	Name   string      `json:"name"`
+	Rate   float64     `json:"rate"`
+	Amount money.Money `json:"amount"`
+}
+
+// TaxBreakdown lists the tax components charged on a transaction, for example
+// CGST and SGST for an intra-state sale. It is stored as JSON.
+type TaxBreakdown []TaxLine
+
+// Treatment names the tax components, for example "CGST 9% + SGST 9%", or
+// "none" when no tax applies.
+func (b TaxBreakdown) Treatment() string {
+	if len(b) == 0 {
+		return "none"
+	}
+	names := make([]string, len(b))
+	for i, line := range b {
+		names[i] = line.Name
+	}
+	return strings.Join(names, " + ")
+}
+
+func (b TaxBreakdown) Value() (driver.Value, error) {
+	if b == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (b *TaxBreakdown) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	case nil:
+		*b = nil
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into TaxBreakdown", src)
+	}
+	return json.Unmarshal(data, b)
+}
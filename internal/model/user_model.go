@@ -10,6 +10,7 @@ type UserInfo struct {
 	Email              string    `json:"email" db:"email"`
 	Phone              string    `json:"phone" db:"phone"`
 	RazorpayCustomerID string    `json:"razorpayCustomerId" db:"razorpay_customer_id"`
+	Currency           string    `json:"currency" db:"currency"`
 	CreatedAt          time.Time `json:"createdAt" db:"created_at"`
 	UpdatedAt          time.Time `json:"updatedAt" db:"updated_at"`
 }
\ No newline at end of file
@@ -0,0 +1,16 @@
+package model
+
+import (
+	"time"
+)
+
+// VaultEntry is an envelope-encrypted PAN. EncryptedPAN is sealed with a
+// per-entry data key, and EncryptedKey is that data key sealed with the
+// master key named by KeyID.
+type VaultEntry struct {
+	Token        string    `db:"token"`
+	KeyID        string    `db:"key_id"`
+	EncryptedKey []byte    `db:"encrypted_key"`
+	EncryptedPAN []byte    `db:"encrypted_pan"`
+	CreatedAt    time.Time `db:"created_at"`
+}
@@ -0,0 +1,320 @@
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// DefaultCurrency is used for amounts read from columns that have no currency
+// of their own, such as catalog prices.
+const DefaultCurrency = "INR"
+
+// zeroDecimalCurrencies and twoDecimalCurrencies are the ISO 4217 currencies
+// amounts can be kept in. A zero-decimal currency has no minor unit: an amount
+// of 1500 JPY is 1500 minor units. Currencies with three decimal places, such
+// as KWD, do not fit the DECIMAL(10, 2) columns amounts are stored in and are
+// left out, as are fund and precious-metal codes.
+var zeroDecimalCurrencies = map[string]bool{
+	"BIF": true, "CLP": true, "DJF": true, "GNF": true, "ISK": true,
+	"JPY": true, "KMF": true, "KRW": true, "PYG": true, "RWF": true,
+	"UGX": true, "VND": true, "VUV": true, "XAF": true, "XOF": true,
+	"XPF": true,
+}
+
+var twoDecimalCurrencies = map[string]bool{
+	"AED": true, "AFN": true, "ALL": true, "AMD": true, "ANG": true,
+	"AOA": true, "ARS": true, "AUD": true, "AWG": true, "AZN": true,
+	"BAM": true, "BBD": true, "BDT": true, "BGN": true, "BMD": true,
+	"BND": true, "BOB": true, "BRL": true, "BSD": true, "BTN": true,
+	"BWP": true, "BYN": true, "BZD": true, "CAD": true, "CDF": true,
+	"CHF": true, "CNY": true, "COP": true, "CRC": true, "CUP": true,
+	"CVE": true, "CZK": true, "DKK": true, "DOP": true, "DZD": true,
+	"EGP": true, "ERN": true, "ETB": true, "EUR": true, "FJD": true,
+	"FKP": true, "GBP": true, "GEL": true, "GHS": true, "GIP": true,
+	"GMD": true, "GTQ": true, "GYD": true, "HKD": true, "HNL": true,
+	"HTG": true, "HUF": true, "IDR": true, "ILS": true, "INR": true,
+	"IRR": true, "JMD": true, "KES": true, "KGS": true, "KHR": true,
+	"KPW": true, "KYD": true, "KZT": true, "LAK": true, "LBP": true,
+	"LKR": true, "LRD": true, "LSL": true, "MAD": true, "MDL": true,
+	"MGA": true, "MKD": true, "MMK": true, "MNT": true, "MOP": true,
+	"MRU": true, "MUR": true, "MVR": true, "MWK": true, "MXN": true,
+	"MYR": true, "MZN": true, "NAD": true, "NGN": true, "NIO": true,
+	"NOK": true, "NPR": true, "NZD": true, "PAB": true, "PEN": true,
+	"PGK": true, "PHP": true, "PKR": true, "PLN": true, "QAR": true,
+	"RON": true, "RSD": true, "RUB": true, "SAR": true, "SBD": true,
+	"SCR": true, "SDG": true, "SEK": true, "SGD": true, "SHP": true,
+	"SLE": true, "SOS": true, "SRD": true, "SSP": true, "STN": true,
+	"SVC": true, "SYP": true, "SZL": true, "THB": true, "TJS": true,
+	"TMT": true, "TOP": true, "TRY": true, "TTD": true, "TWD": true,
+	"TZS": true, "UAH": true, "USD": true, "UYU": true, "UZS": true,
+	"VES": true, "WST": true, "XCD": true, "YER": true, "ZAR": true,
+	"ZMW": true, "ZWL": true,
+}
+
+var (
+	ErrInvalidAmount       = errors.New("invalid money amount")
+	ErrCurrencyMismatch    = errors.New("currency mismatch")
+	ErrUnsupportedCurrency = errors.New("unsupported currency")
+)
+
+// RoundingMode decides what happens to a fraction of a minor unit. Every
+// operation that can produce one takes a mode explicitly.
+type RoundingMode int
+
+const (
+	// RoundHalfUp rounds to the nearest minor unit, ties away from zero. Used for tax.
+	RoundHalfUp RoundingMode = iota
+	// RoundHalfEven rounds to the nearest minor unit, ties to the even neighbour.
+	RoundHalfEven
+	// RoundDown truncates toward zero. Used for refunds so a customer is never
+	// credited more than the exact share.
+	RoundDown
+	// RoundUp rounds away from zero.
+	RoundUp
+)
+
+// Money is an amount in integer minor units (paise for INR) and its ISO 4217
+// currency code.
+type Money struct {
+	Minor    int64
+	Currency string
+}
+
+// Supported reports whether currency is an upper-case ISO 4217 code whose
+// amounts can be represented.
+func Supported(currency string) bool {
+	return zeroDecimalCurrencies[currency] || twoDecimalCurrencies[currency]
+}
+
+// Decimals returns the number of decimal places of currency's minor unit.
+func Decimals(currency string) int {
+	if zeroDecimalCurrencies[currency] {
+		return 0
+	}
+	return 2
+}
+
+func minorPerMajor(currency string) int64 {
+	if Decimals(currency) == 0 {
+		return 1
+	}
+	return 100
+}
+
+func New(minor int64, currency string) Money {
+	return Money{Minor: minor, Currency: currency}
+}
+
+func Zero(currency string) Money {
+	return Money{Currency: currency}
+}
+
+// Parse reads a major-unit decimal string such as "19.99" exactly, without
+// passing through float64. Digits beyond the minor unit are rounded with mode.
+func Parse(value string, currency string, mode RoundingMode) (Money, error) {
+	if !Supported(currency) {
+		return Money{}, fmt.Errorf("%w: %q", ErrUnsupportedCurrency, currency)
+	}
+	major, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, value)
+	}
+	minor := new(big.Rat).Mul(major, big.NewRat(minorPerMajor(currency), 1))
+	return Money{Minor: round(minor, mode), Currency: currency}, nil
+}
+
+func (m Money) Add(other Money) Money {
+	m.mustMatch(other)
+	return Money{Minor: m.Minor + other.Minor, Currency: m.Currency}
+}
+
+func (m Money) Sub(other Money) Money {
+	m.mustMatch(other)
+	return Money{Minor: m.Minor - other.Minor, Currency: m.Currency}
+}
+
+// Cmp returns -1, 0 or +1 depending on whether m is less than, equal to or
+// greater than other.
+func (m Money) Cmp(other Money) int {
+	m.mustMatch(other)
+	switch {
+	case m.Minor < other.Minor:
+		return -1
+	case m.Minor > other.Minor:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (m Money) IsZero() bool {
+	return m.Minor == 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.Minor > 0
+}
+
+// Mul multiplies the amount by an exact ratio.
+func (m Money) Mul(ratio *big.Rat, mode RoundingMode) Money {
+	product := new(big.Rat).Mul(new(big.Rat).SetInt64(m.Minor), ratio)
+	return Money{Minor: round(product, mode), Currency: m.Currency}
+}
+
+// Percent returns rate percent of the amount, for example the tax on it.
+func (m Money) Percent(rate float64, mode RoundingMode) Money {
+	return m.Mul(new(big.Rat).Quo(percentRat(rate), big.NewRat(100, 1)), mode)
+}
+
+// ExcludePercent returns the amount before rate percent was added to it, for
+// example the taxable value of a tax-inclusive price.
+func (m Money) ExcludePercent(rate float64, mode RoundingMode) Money {
+	hundred := big.NewRat(100, 1)
+	return m.Mul(new(big.Rat).Quo(hundred, new(big.Rat).Add(hundred, percentRat(rate))), mode)
+}
+
+// Prorate returns part/whole of the amount.
+func (m Money) Prorate(part int64, whole int64, mode RoundingMode) Money {
+	if whole == 0 {
+		return Zero(m.Currency)
+	}
+	return m.Mul(big.NewRat(part, whole), mode)
+}
+
+// WithCurrency returns the same major-unit amount in currency. Scan reads a
+// DECIMAL column before the row's currency is known, so repositories use it
+// to stamp the currency on once it is.
+func (m Money) WithCurrency(currency string) Money {
+	from, to := minorPerMajor(m.Currency), minorPerMajor(currency)
+	if m.Currency == "" || from == to {
+		return Money{Minor: m.Minor, Currency: currency}
+	}
+	return Money{Minor: round(big.NewRat(m.Minor*to, from), RoundHalfUp), Currency: currency}
+}
+
+// Decimal formats the amount in major units, e.g. "19.99", or "1500" for a
+// currency without a minor unit.
+func (m Money) Decimal() string {
+	sign := ""
+	minor := m.Minor
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	per := minorPerMajor(m.Currency)
+	if per == 1 {
+		return fmt.Sprintf("%s%d", sign, minor)
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, minor/per, minor%per)
+}
+
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+type jsonMoney struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// MarshalJSON encodes the amount in minor units, the same convention the
+// Razorpay API uses: {"amount": 1999, "currency": "INR"}.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonMoney{Amount: m.Minor, Currency: m.Currency})
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var v jsonMoney
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	m.Minor = v.Amount
+	m.Currency = v.Currency
+	return nil
+}
+
+// Value stores the amount as a major-unit decimal string for DECIMAL columns.
+func (m Money) Value() (driver.Value, error) {
+	return m.Decimal(), nil
+}
+
+// Scan reads a DECIMAL column. The column carries no currency, so Scan keeps
+// the one already set and falls back to DefaultCurrency; repositories stamp the
+// row's currency afterwards where the table has one.
+func (m *Money) Scan(src interface{}) error {
+	var text string
+	switch v := src.(type) {
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	case int64:
+		text = strconv.FormatInt(v, 10)
+	case float64:
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		text = "0"
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+
+	currency := m.Currency
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+
+	parsed, err := Parse(text, currency, RoundHalfUp)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// mustMatch panics when two amounts in different currencies are combined.
+// That is a programming error, not something a request can trigger.
+func (m Money) mustMatch(other Money) {
+	if m.Currency != other.Currency {
+		panic(fmt.Sprintf("%v: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency))
+	}
+}
+
+func percentRat(rate float64) *big.Rat {
+	r, _ := new(big.Rat).SetString(strconv.FormatFloat(rate, 'f', -1, 64))
+	return r
+}
+
+// round converts an exact number of minor units to an integer using mode.
+func round(minor *big.Rat, mode RoundingMode) int64 {
+	num := minor.Num()
+	den := minor.Denom()
+
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Sign() == 0 {
+		return quo.Int64()
+	}
+
+	step := int64(num.Sign())
+	half := new(big.Int).Abs(rem)
+	half.Lsh(half, 1)
+	cmp := half.Cmp(den)
+
+	switch mode {
+	case RoundDown:
+	case RoundUp:
+		quo.Add(quo, big.NewInt(step))
+	case RoundHalfEven:
+		if cmp > 0 || (cmp == 0 && quo.Bit(0) == 1) {
+			quo.Add(quo, big.NewInt(step))
+		}
+	default:
+		if cmp >= 0 {
+			quo.Add(quo, big.NewInt(step))
+		}
+	}
+	return quo.Int64()
+}
@@ -0,0 +1,250 @@
+package money
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value    string
+		currency string
+		mode     RoundingMode
+		want     int64
+		wantErr  error
+	}{
+		{"19.99", "INR", RoundHalfUp, 1999, nil},
+		{"0", "INR", RoundHalfUp, 0, nil},
+		{"100", "INR", RoundHalfUp, 10000, nil},
+		{"-19.99", "INR", RoundHalfUp, -1999, nil},
+		{"0.005", "INR", RoundHalfUp, 1, nil},
+		{"0.005", "INR", RoundHalfEven, 0, nil},
+		{"0.015", "INR", RoundHalfEven, 2, nil},
+		{"0.009", "INR", RoundDown, 0, nil},
+		{"0.001", "INR", RoundUp, 1, nil},
+		{"-0.005", "INR", RoundHalfUp, -1, nil},
+		{"1500", "JPY", RoundHalfUp, 1500, nil},
+		{"1500.5", "JPY", RoundHalfUp, 1501, nil},
+		{"1500.5", "JPY", RoundHalfEven, 1500, nil},
+		{"abc", "INR", RoundHalfUp, 0, ErrInvalidAmount},
+		{"", "INR", RoundHalfUp, 0, ErrInvalidAmount},
+		{"1.000", "KWD", RoundHalfUp, 0, ErrUnsupportedCurrency},
+		{"1.00", "", RoundHalfUp, 0, ErrUnsupportedCurrency},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.value, tt.currency, tt.mode)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Parse(%q, %s) error = %v, want %v", tt.value, tt.currency, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q, %s) unexpected error: %v", tt.value, tt.currency, err)
+			continue
+		}
+		if got.Minor != tt.want || got.Currency != tt.currency {
+			t.Errorf("Parse(%q, %s, %d) = %v, want %d %s", tt.value, tt.currency, tt.mode, got, tt.want, tt.currency)
+		}
+	}
+}
+
+func TestRound(t *testing.T) {
+	modes := []RoundingMode{RoundHalfUp, RoundHalfEven, RoundDown, RoundUp}
+
+	// Each row is num/den minor units and the expected result per mode, in
+	// the order of modes above.
+	tests := []struct {
+		num, den int64
+		want     [4]int64
+	}{
+		{5, 1, [4]int64{5, 5, 5, 5}},
+		{5, 2, [4]int64{3, 2, 2, 3}},
+		{7, 2, [4]int64{4, 4, 3, 4}},
+		{-5, 2, [4]int64{-3, -2, -2, -3}},
+		{-7, 2, [4]int64{-4, -4, -3, -4}},
+		{1, 3, [4]int64{0, 0, 0, 1}},
+		{2, 3, [4]int64{1, 1, 0, 1}},
+		{-1, 3, [4]int64{0, 0, 0, -1}},
+		{-2, 3, [4]int64{-1, -1, 0, -1}},
+		{1, 2, [4]int64{1, 0, 0, 1}},
+		{-1, 2, [4]int64{-1, 0, 0, -1}},
+		{0, 1, [4]int64{0, 0, 0, 0}},
+	}
+
+	for _, tt := range tests {
+		for i, mode := range modes {
+			if got := round(big.NewRat(tt.num, tt.den), mode); got != tt.want[i] {
+				t.Errorf("round(%d/%d, mode %d) = %d, want %d", tt.num, tt.den, mode, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestPercent(t *testing.T) {
+	tests := []struct {
+		minor int64
+		rate  float64
+		mode  RoundingMode
+		want  int64
+	}{
+		{10000, 18, RoundHalfUp, 1800},
+		{99900, 9, RoundHalfUp, 8991},
+		{1999, 18, RoundHalfUp, 360},
+		{1999, 18, RoundDown, 359},
+		{50, 9, RoundHalfUp, 5},
+		{50, 9, RoundHalfEven, 4},
+		{-1999, 18, RoundHalfUp, -360},
+		{1000, 0, RoundHalfUp, 0},
+		{1000, 7.5, RoundHalfUp, 75},
+	}
+
+	for _, tt := range tests {
+		got := New(tt.minor, "INR").Percent(tt.rate, tt.mode)
+		if got.Minor != tt.want {
+			t.Errorf("%d.Percent(%v, %d) = %d, want %d", tt.minor, tt.rate, tt.mode, got.Minor, tt.want)
+		}
+	}
+}
+
+func TestExcludePercent(t *testing.T) {
+	tests := []struct {
+		minor int64
+		rate  float64
+		mode  RoundingMode
+		want  int64
+	}{
+		{11800, 18, RoundHalfUp, 10000},
+		{99900, 18, RoundHalfUp, 84661},
+		{99900, 18, RoundDown, 84661},
+		{99900, 18, RoundUp, 84662},
+		{-11800, 18, RoundHalfUp, -10000},
+		{1000, 0, RoundHalfUp, 1000},
+	}
+
+	for _, tt := range tests {
+		got := New(tt.minor, "INR").ExcludePercent(tt.rate, tt.mode)
+		if got.Minor != tt.want {
+			t.Errorf("%d.ExcludePercent(%v, %d) = %d, want %d", tt.minor, tt.rate, tt.mode, got.Minor, tt.want)
+		}
+	}
+}
+
+func TestProrate(t *testing.T) {
+	tests := []struct {
+		minor       int64
+		part, whole int64
+		mode        RoundingMode
+		want        int64
+	}{
+		{99900, 15, 30, RoundDown, 49950},
+		{99900, 1, 3, RoundDown, 33300},
+		{1000, 1, 3, RoundDown, 333},
+		{1000, 2, 3, RoundDown, 666},
+		{1000, 2, 3, RoundHalfUp, 667},
+		{1000, 1, 8, RoundHalfEven, 125},
+		{1, 1, 2, RoundHalfEven, 0},
+		{3, 1, 2, RoundHalfEven, 2},
+		{-1000, 2, 3, RoundDown, -666},
+		{1000, 0, 30, RoundDown, 0},
+		{1000, 30, 30, RoundDown, 1000},
+		{1000, 5, 0, RoundDown, 0},
+	}
+
+	for _, tt := range tests {
+		got := New(tt.minor, "INR").Prorate(tt.part, tt.whole, tt.mode)
+		if got.Minor != tt.want || got.Currency != "INR" {
+			t.Errorf("%d.Prorate(%d, %d, %d) = %v, want %d INR", tt.minor, tt.part, tt.whole, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestSupported(t *testing.T) {
+	tests := []struct {
+		currency string
+		want     bool
+	}{
+		{"INR", true},
+		{"USD", true},
+		{"EUR", true},
+		{"JPY", true},
+		{"KWD", false},
+		{"XYZ", false},
+		{"XAU", false},
+		{"inr", false},
+		{"IN", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := Supported(tt.currency); got != tt.want {
+			t.Errorf("Supported(%q) = %v, want %v", tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{New(1999, "INR"), "19.99"},
+		{New(5, "INR"), "0.05"},
+		{New(-1999, "INR"), "-19.99"},
+		{New(0, "USD"), "0.00"},
+		{New(1500, "JPY"), "1500"},
+		{New(-1500, "JPY"), "-1500"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.money.Decimal(); got != tt.want {
+			t.Errorf("%#v.Decimal() = %q, want %q", tt.money, got, tt.want)
+		}
+	}
+}
+
+func TestWithCurrency(t *testing.T) {
+	tests := []struct {
+		money    Money
+		currency string
+		want     Money
+	}{
+		{New(150000, "INR"), "JPY", New(1500, "JPY")},
+		{New(1500, "JPY"), "USD", New(150000, "USD")},
+		{New(1999, "INR"), "USD", New(1999, "USD")},
+		{New(1999, ""), "EUR", New(1999, "EUR")},
+	}
+
+	for _, tt := range tests {
+		if got := tt.money.WithCurrency(tt.currency); got != tt.want {
+			t.Errorf("%#v.WithCurrency(%s) = %#v, want %#v", tt.money, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestScanRoundTrip(t *testing.T) {
+	for _, m := range []Money{New(1999, "INR"), New(-5, "USD"), New(1500, "JPY")} {
+		value, err := m.Value()
+		if err != nil {
+			t.Fatalf("%v.Value() error: %v", m, err)
+		}
+		got := Money{Currency: m.Currency}
+		if err := got.Scan(value); err != nil {
+			t.Fatalf("Scan(%v) error: %v", value, err)
+		}
+		if got != m {
+			t.Errorf("Scan(Value(%#v)) = %#v", m, got)
+		}
+	}
+}
+
+func TestMismatchedCurrenciesPanic(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("adding INR to USD did not panic")
+		}
+	}()
+	New(1, "INR").Add(New(1, "USD"))
+}
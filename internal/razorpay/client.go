@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/razorpay/razorpay-go"
 )
@@ -17,6 +18,7 @@ var (
 	ErrSubscriptionCreationFailed = errors.New("failed to create subscription")
 	ErrCustomerCreationFailed = errors.New("failed to create customer")
 	ErrPlanCreationFailed = errors.New("failed to create plan")
+	ErrRefundCreationFailed = errors.New("failed to create refund")
 )
 
 
@@ -121,8 +123,8 @@ func (c *Client) GetOrCreateCustomer(ctx context.Context, customerID, name, emai
 	return c.CreateCustomer(ctx, name, email, contact)
 }
 
-func (c *Client) CreatePlan(ctx context.Context, planName string, amount int, interval string) (map[string]interface{}, error) {
-	log.Printf("Creating Razorpay plan: %s, %d per %s", planName, amount, interval)
+func (c *Client) CreatePlan(ctx context.Context, planName string, amount int, currency string, interval string) (map[string]interface{}, error) {
+	log.Printf("Creating Razorpay plan: %s, %d %s per %s", planName, amount, currency, interval)
 	
 	data := map[string]interface{}{
 		"period": interval,
@@ -130,7 +132,7 @@ func (c *Client) CreatePlan(ctx context.Context, planName string, amount int, in
 		"item": map[string]interface{}{
 			"name": planName,
 			"amount": amount,
-			"currency": "INR",
+			"currency": currency,
 			"description": planName + " subscription plan",
 		},
 	}
@@ -145,7 +147,7 @@ func (c *Client) CreatePlan(ctx context.Context, planName string, amount int, in
 	return plan, nil
 }
 
-func (c *Client) CreateSubscription(ctx context.Context, planID string, customerID string, totalCount int, customerNotify bool) (map[string]interface{}, error) {
+func (c *Client) CreateSubscription(ctx context.Context, planID string, customerID string, totalCount int, customerNotify bool, notes map[string]interface{}) (map[string]interface{}, error) {
 	log.Printf("Creating Razorpay subscription: Plan ID %s, Customer ID %s", planID, customerID)
 	
 	var notifyValue int
@@ -161,6 +163,9 @@ func (c *Client) CreateSubscription(ctx context.Context, planID string, customer
 		"total_count":     totalCount,
 		"customer_notify": notifyValue,
 	}
+	if len(notes) > 0 {
+		data["notes"] = notes
+	}
 
 	subscription, err := c.client.Subscription.Create(data, nil)
 	if err != nil {
@@ -173,6 +178,41 @@ func (c *Client) CreateSubscription(ctx context.Context, planID string, customer
 }
 
 
+func (c *Client) FetchSubscription(ctx context.Context, subscriptionID string) (map[string]interface{}, error) {
+	subscription, err := c.client.Subscription.Fetch(subscriptionID, nil, nil)
+	if err != nil {
+		log.Printf("Failed to fetch Razorpay subscription %s: %v", subscriptionID, err)
+		return nil, fmt.Errorf("failed to fetch subscription: %v", err)
+	}
+
+	return subscription, nil
+}
+
+
+// ListSubscriptions returns up to count subscriptions created since from,
+// newest first, after skipping the first skip of them.
+func (c *Client) ListSubscriptions(ctx context.Context, from time.Time, count int, skip int) ([]map[string]interface{}, error) {
+	result, err := c.client.Subscription.All(map[string]interface{}{
+		"from":  from.Unix(),
+		"count": count,
+		"skip":  skip,
+	}, nil)
+	if err != nil {
+		log.Printf("Failed to list Razorpay subscriptions: %v", err)
+		return nil, fmt.Errorf("failed to list subscriptions: %v", err)
+	}
+
+	items, _ := result["items"].([]interface{})
+	subscriptions := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		if subscription, ok := item.(map[string]interface{}); ok {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	return subscriptions, nil
+}
+
+
 func (c *Client) CancelSubscription(ctx context.Context, subscriptionID string, cancelAtCycleEnd bool) (map[string]interface{}, error) {
 	log.Printf("Cancelling Razorpay subscription: ID %s, At cycle end: %v", 
 		subscriptionID, cancelAtCycleEnd)
@@ -191,6 +231,85 @@ func (c *Client) CancelSubscription(ctx context.Context, subscriptionID string,
 	return subscription, nil
 }
 
+// ChargeToken charges a card the customer saved with Razorpay, without the
+// customer present, against an order created for the amount. The outcome
+// arrives later through the payment.authorized or payment.failed webhook.
+func (c *Client) ChargeToken(ctx context.Context, customerID, tokenID, orderID string, amount int, currency, email, contact string, notes map[string]interface{}) (map[string]interface{}, error) {
+	log.Printf("Charging Razorpay token %s: Order ID %s, Amount %d %s", tokenID, orderID, amount, currency)
+
+	data := map[string]interface{}{
+		"email":       email,
+		"contact":     contact,
+		"amount":      amount,
+		"currency":    currency,
+		"order_id":    orderID,
+		"customer_id": customerID,
+		"token":       tokenID,
+		"recurring":   "1",
+		"notes":       notes,
+	}
+
+	payment, err := c.client.Payment.CreateRecurringPayment(data, nil)
+	if err != nil {
+		log.Printf("Failed to charge Razorpay token %s: %v", tokenID, err)
+		return nil, fmt.Errorf("%w: %v", ErrPaymentCreationFailed, err)
+	}
+
+	log.Printf("Successfully created Razorpay recurring payment: ID %v", payment["razorpay_payment_id"])
+	return payment, nil
+}
+
+func (c *Client) CreateRefund(ctx context.Context, paymentID string, amount int, notes map[string]interface{}) (map[string]interface{}, error) {
+	log.Printf("Creating Razorpay refund: Payment ID %s, Amount %d", paymentID, amount)
+	
+	data := map[string]interface{}{
+		"notes": notes,
+	}
+
+	refund, err := c.client.Payment.Refund(paymentID, amount, data, nil)
+	if err != nil {
+		log.Printf("Failed to create Razorpay refund: %v", err)
+		return nil, fmt.Errorf("%w: %v", ErrRefundCreationFailed, err)
+	}
+
+	log.Printf("Successfully created Razorpay refund: ID %s", refund["id"])
+	return refund, nil
+}
+
+func (c *Client) PauseSubscription(ctx context.Context, subscriptionID string) (map[string]interface{}, error) {
+	log.Printf("Pausing Razorpay subscription: ID %s", subscriptionID)
+	
+	data := map[string]interface{}{
+		"pause_at": "now",
+	}
+
+	subscription, err := c.client.Subscription.Pause(subscriptionID, data, nil)
+	if err != nil {
+		log.Printf("Failed to pause Razorpay subscription: %v", err)
+		return nil, fmt.Errorf("failed to pause subscription: %v", err)
+	}
+
+	log.Printf("Successfully paused Razorpay subscription: ID %s", subscription["id"])
+	return subscription, nil
+}
+
+func (c *Client) ResumeSubscription(ctx context.Context, subscriptionID string) (map[string]interface{}, error) {
+	log.Printf("Resuming Razorpay subscription: ID %s", subscriptionID)
+	
+	data := map[string]interface{}{
+		"resume_at": "now",
+	}
+
+	subscription, err := c.client.Subscription.Resume(subscriptionID, data, nil)
+	if err != nil {
+		log.Printf("Failed to resume Razorpay subscription: %v", err)
+		return nil, fmt.Errorf("failed to resume subscription: %v", err)
+	}
+
+	log.Printf("Successfully resumed Razorpay subscription: ID %s", subscription["id"])
+	return subscription, nil
+}
+
 func (c *Client) VerifyPaymentSignature(attributes map[string]interface{}, signature string) bool {
 
 	if c.keySecret == "" {
@@ -218,6 +337,20 @@ func (c *Client) VerifyPaymentSignature(attributes map[string]interface{}, signa
 	return result
 }
 
+// VerifyWebhookSignature checks the X-Razorpay-Signature header of a webhook,
+// an HMAC-SHA256 of the raw body keyed by the webhook secret. Unlike payment
+// signatures, a webhook never passes without a secret.
+func VerifyWebhookSignature(payload []byte, signature string, secret string) bool {
+	if secret == "" || signature == "" {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	expectedSignature := hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expectedSignature), []byte(signature))
+}
+
 func (c *Client) TestConnection() error {
 	log.Println("Testing Razorpay connection...")
 	_, err := c.client.Payment.All(map[string]interface{}{
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"subscription-management/internal/model"
+)
+
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *model.APIKey) error
+	GetByID(ctx context.Context, id string) (*model.APIKey, error)
+	GetByHash(ctx context.Context, keyHash string) (*model.APIKey, error)
+	List(ctx context.Context) ([]model.APIKey, error)
+	Rotate(ctx context.Context, oldID string, replacement *model.APIKey, revokeAt time.Time) error
+	Revoke(ctx context.Context, id string, at time.Time) error
+	TouchLastUsed(ctx context.Context, id string, at time.Time) error
+}
+
+type SQLAPIKeyRepository struct {
+	db *sqlx.DB
+}
+
+func NewAPIKeyRepository(db *sqlx.DB) APIKeyRepository {
+	return &SQLAPIKeyRepository{
+		db: db,
+	}
+}
+
+const insertAPIKeyQuery = `
+	INSERT INTO api_keys (
+		id, name, prefix, key_hash, scopes, rotated_from, created_at, updated_at
+	) VALUES (
+		:id, :name, :prefix, :key_hash, :scopes, :rotated_from, :created_at, :updated_at
+	)
+`
+
+func (r *SQLAPIKeyRepository) Create(ctx context.Context, key *model.APIKey) error {
+	stampAPIKey(key)
+
+	_, err := conn(ctx, r.db).NamedExecContext(ctx, insertAPIKeyQuery, key)
+	return err
+}
+
+func (r *SQLAPIKeyRepository) GetByID(ctx context.Context, id string) (*model.APIKey, error) {
+	return r.getOne(ctx, `SELECT * FROM api_keys WHERE id = ?`, id)
+}
+
+func (r *SQLAPIKeyRepository) GetByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	return r.getOne(ctx, `SELECT * FROM api_keys WHERE key_hash = ?`, keyHash)
+}
+
+func (r *SQLAPIKeyRepository) getOne(ctx context.Context, query string, arg interface{}) (*model.APIKey, error) {
+	var key model.APIKey
+
+	err := conn(ctx, r.db).GetContext(ctx, &key, query, arg)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+func (r *SQLAPIKeyRepository) List(ctx context.Context) ([]model.APIKey, error) {
+	var keys []model.APIKey
+
+	query := `SELECT * FROM api_keys ORDER BY created_at DESC`
+
+	err := conn(ctx, r.db).SelectContext(ctx, &keys, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Rotate inserts the replacement key and schedules the old one to stop
+// working at revokeAt, in one transaction.
+func (r *SQLAPIKeyRepository) Rotate(ctx context.Context, oldID string, replacement *model.APIKey, revokeAt time.Time) error {
+	stampAPIKey(replacement)
+
+	return withinTx(ctx, r.db, func(ctx context.Context) error {
+		if _, err := conn(ctx, r.db).NamedExecContext(ctx, insertAPIKeyQuery, replacement); err != nil {
+			return err
+		}
+
+		query := `UPDATE api_keys SET revoked_at = ?, updated_at = ? WHERE id = ? AND revoked_at IS NULL`
+		_, err := conn(ctx, r.db).ExecContext(ctx, query, revokeAt, time.Now(), oldID)
+		return err
+	})
+}
+
+func (r *SQLAPIKeyRepository) Revoke(ctx context.Context, id string, at time.Time) error {
+	query := `UPDATE api_keys SET revoked_at = ?, updated_at = ? WHERE id = ? AND (revoked_at IS NULL OR revoked_at > ?)`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, at, time.Now(), id, at)
+	return err
+}
+
+func (r *SQLAPIKeyRepository) TouchLastUsed(ctx context.Context, id string, at time.Time) error {
+	query := `UPDATE api_keys SET last_used_at = ?, updated_at = updated_at WHERE id = ?`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, at, id)
+	return err
+}
+
+func stampAPIKey(key *model.APIKey) {
+	if key.ID == "" {
+		key.ID = uuid.New().String()
+	}
+	now := time.Now()
+	key.CreatedAt = now
+	key.UpdatedAt = now
+}
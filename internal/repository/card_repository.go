@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -17,9 +18,32 @@ type CardRepository interface {
 	GetByID(ctx context.Context, id string) (*model.Card, error)
 	GetByUserID(ctx context.Context, userID string) ([]model.Card, error)
 	Update(ctx context.Context, card *model.Card) error
-	Delete(ctx context.Context, id string) error
+	Delete(ctx context.Context, id string, replacementID string) error
 	SetDefault(ctx context.Context, userID, cardID string) error
 	DeleteByUserID(ctx context.Context, userID string) error
+	GetByFingerprint(ctx context.Context, userID string, fingerprint string) (*model.Card, error)
+	GetByRazorpayToken(ctx context.Context, userID string, tokenID string) (*model.Card, error)
+	SetRazorpayToken(ctx context.Context, id string, tokenID string) error
+	CountAccountsWithFingerprint(ctx context.Context, fingerprint string) (int, error)
+	GetSharedFingerprints(ctx context.Context, minAccounts int) ([]model.SharedCardFingerprint, error)
+	GetUntokenized(ctx context.Context, limit int) ([]model.Card, error)
+	SetToken(ctx context.Context, id string, token string, bin string, fingerprint string) error
+	GetUnfingerprinted(ctx context.Context, afterID string, limit int) ([]model.Card, error)
+	SetFingerprint(ctx context.Context, id string, fingerprint string) error
+	GetWithBIN(ctx context.Context, afterID string, limit int) ([]model.Card, error)
+	UpdateBINMetadata(ctx context.Context, card *model.Card) error
+	GetExpiringWithAutoRenewal(ctx context.Context, beforeMonth int) ([]model.Card, error)
+	GetExpiringByUserID(ctx context.Context, userID string, beforeMonth int) ([]model.Card, error)
+	MarkExpired(ctx context.Context, beforeMonth int) (int64, error)
+	SetExpiryNotified(ctx context.Context, id string, at time.Time) error
+}
+
+// liveSubscriptionStatuses are the subscription statuses that are still
+// billed, or will be again, through their card.
+var liveSubscriptionStatuses = []interface{}{
+	model.SubscriptionStatusActive,
+	model.SubscriptionStatusPastDue,
+	model.SubscriptionStatusPaused,
 }
 
 type SQLCardRepository struct {
@@ -37,30 +61,28 @@ func (r *SQLCardRepository) Create(ctx context.Context, card *model.Card) error
 		card.ID = uuid.New().String()
 	}
 	
-	cardLength := len(card.CardNumber)
-	if cardLength >= 4 {
-		card.LastFourDigits = card.CardNumber[cardLength-4:]
-	}
-	
 	card.CreatedAt = time.Now()
 	card.UpdatedAt = time.Now()
 	
 	query := `
 		INSERT INTO cards (
-			id, user_id, card_number, card_holder_name, 
-			expiry_month, expiry_year, card_type, 
+			id, user_id, card_token, bin, fingerprint, card_holder_name, 
+			expiry_month, expiry_year, card_type, issuer, issuer_country, funding_type, 
 			last_four_digits, is_default, created_at, updated_at
 		) VALUES (
-			:id, :user_id, :card_number, :card_holder_name, 
-			:expiry_month, :expiry_year, :card_type, 
+			:id, :user_id, :card_token, :bin, :fingerprint, :card_holder_name, 
+			:expiry_month, :expiry_year, :card_type, :issuer, :issuer_country, :funding_type, 
 			:last_four_digits, :is_default, :created_at, :updated_at
 		)
 	`
 	
-	_, err := r.db.NamedExecContext(ctx, query, card)
+	_, err := conn(ctx, r.db).NamedExecContext(ctx, query, card)
 	return err
 }
 
+// GetByID also returns removed cards, so that past subscriptions and invoices
+// can still describe the card they were paid with. Callers acting on a card
+// must check DeletedAt.
 func (r *SQLCardRepository) GetByID(ctx context.Context, id string) (*model.Card, error) {
 	var card model.Card
 	
@@ -68,7 +90,7 @@ func (r *SQLCardRepository) GetByID(ctx context.Context, id string) (*model.Card
 		SELECT * FROM cards WHERE id = ?
 	`
 	
-	err := r.db.GetContext(ctx, &card, query, id)
+	err := conn(ctx, r.db).GetContext(ctx, &card, query, id)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil 
@@ -83,10 +105,10 @@ func (r *SQLCardRepository) GetByUserID(ctx context.Context, userID string) ([]m
 	var cards []model.Card
 	
 	query := `
-		SELECT * FROM cards WHERE user_id = ?
+		SELECT * FROM cards WHERE user_id = ? AND deleted_at IS NULL
 	`
 	
-	err := r.db.SelectContext(ctx, &cards, query, userID)
+	err := conn(ctx, r.db).SelectContext(ctx, &cards, query, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -103,57 +125,352 @@ func (r *SQLCardRepository) Update(ctx context.Context, card *model.Card) error
 			expiry_month = :expiry_month,
 			expiry_year = :expiry_year,
 			is_default = :is_default,
+			is_expired = :is_expired,
+			expiry_notified_at = :expiry_notified_at,
 			updated_at = :updated_at
 		WHERE id = :id
 	`
 	
-	_, err := r.db.NamedExecContext(ctx, query, card)
+	_, err := conn(ctx, r.db).NamedExecContext(ctx, query, card)
 	return err
 }
 
-func (r *SQLCardRepository) Delete(ctx context.Context, id string) error {
-	query := `DELETE FROM cards WHERE id = ?`
-	_, err := r.db.ExecContext(ctx, query, id)
-	return err
+// Delete removes a card. Live subscriptions paying with it are first moved to
+// replacementID when one is given; if any remain, nothing changes and
+// ErrCardInUse is returned. The row is kept for history with its token and
+// raw number erased.
+func (r *SQLCardRepository) Delete(ctx context.Context, id string, replacementID string) error {
+	return withinTx(ctx, r.db, func(ctx context.Context) error {
+		db := conn(ctx, r.db)
+
+		if replacementID != "" {
+			query, args, err := sqlx.In(`
+				UPDATE subscription_transactions SET card_id = ?, updated_at = ?
+				WHERE card_id = ? AND status IN (?)
+			`, replacementID, time.Now(), id, liveSubscriptionStatuses)
+			if err != nil {
+				return err
+			}
+			if _, err := db.ExecContext(ctx, query, args...); err != nil {
+				return err
+			}
+		}
+
+		if err := ensureCardsUnused(ctx, db, `card_id = ?`, id); err != nil {
+			return err
+		}
+
+		query := `
+			UPDATE cards SET deleted_at = ?, card_token = NULL, razorpay_token_id = NULL, card_number = NULL, is_default = false
+			WHERE id = ? AND deleted_at IS NULL
+		`
+		_, err := db.ExecContext(ctx, query, time.Now(), id)
+		return err
+	})
 }
 
 func (r *SQLCardRepository) SetDefault(ctx context.Context, userID, cardID string) error {
-	tx, err := r.db.BeginTxx(ctx, nil)
+	return withinTx(ctx, r.db, func(ctx context.Context) error {
+		db := conn(ctx, r.db)
+
+		unsetQuery := `UPDATE cards SET is_default = false WHERE user_id = ?`
+		if _, err := db.ExecContext(ctx, unsetQuery, userID); err != nil {
+			return err
+		}
+
+		setQuery := `UPDATE cards SET is_default = true WHERE id = ? AND user_id = ?`
+		result, err := db.ExecContext(ctx, setQuery, cardID, userID)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return ErrCardNotFound
+		}
+		return nil
+	})
+}
+
+
+func (r *SQLCardRepository) DeleteByUserID(ctx context.Context, userID string) error {
+    return withinTx(ctx, r.db, func(ctx context.Context) error {
+        db := conn(ctx, r.db)
+
+        if err := ensureCardsUnused(ctx, db, `card_id IN (SELECT id FROM cards WHERE user_id = ?)`, userID); err != nil {
+            return err
+        }
+
+        query := `
+            UPDATE cards SET deleted_at = ?, card_token = NULL, razorpay_token_id = NULL, card_number = NULL, is_default = false
+            WHERE user_id = ? AND deleted_at IS NULL
+        `
+        _, err := db.ExecContext(ctx, query, time.Now(), userID)
+        return err
+    })
+}
+
+
+// ensureCardsUnused returns ErrCardInUse if any live subscription matches
+// cardFilter. The rows are locked so that none can be created or moved onto
+// the cards before the removal commits, so db must be a transaction.
+func ensureCardsUnused(ctx context.Context, db queryer, cardFilter string, args ...interface{}) error {
+	query, queryArgs, err := sqlx.In(`
+		SELECT id FROM subscription_transactions
+		WHERE `+cardFilter+` AND status IN (?)
+		FOR UPDATE
+	`, append(args, liveSubscriptionStatuses)...)
 	if err != nil {
 		return err
 	}
 
-	unsetQuery := `UPDATE cards SET is_default = false WHERE user_id = ?`
-	_, err = tx.ExecContext(ctx, unsetQuery, userID)
-	if err != nil {
-		tx.Rollback()
+	var ids []string
+	if err := db.SelectContext(ctx, &ids, query, queryArgs...); err != nil {
 		return err
 	}
-	
-	setQuery := `UPDATE cards SET is_default = true WHERE id = ? AND user_id = ?`
-	result, err := tx.ExecContext(ctx, setQuery, cardID, userID)
+	if len(ids) > 0 {
+		return ErrCardInUse
+	}
+	return nil
+}
+
+
+func (r *SQLCardRepository) GetByFingerprint(ctx context.Context, userID string, fingerprint string) (*model.Card, error) {
+	var card model.Card
+
+	query := `SELECT * FROM cards WHERE user_id = ? AND fingerprint = ? AND deleted_at IS NULL`
+
+	err := conn(ctx, r.db).GetContext(ctx, &card, query, userID, fingerprint)
 	if err != nil {
-		tx.Rollback()
-		return err
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	return &card, nil
+}
+
+func (r *SQLCardRepository) GetByRazorpayToken(ctx context.Context, userID string, tokenID string) (*model.Card, error) {
+	var card model.Card
+
+	query := `SELECT * FROM cards WHERE user_id = ? AND razorpay_token_id = ? AND deleted_at IS NULL`
+
+	err := conn(ctx, r.db).GetContext(ctx, &card, query, userID, tokenID)
 	if err != nil {
-		tx.Rollback()
-		return err
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
 	}
-	
-	if rowsAffected == 0 {
-		tx.Rollback()
-		return errors.New("card not found or doesn't belong to user")
+
+	return &card, nil
+}
+
+func (r *SQLCardRepository) SetRazorpayToken(ctx context.Context, id string, tokenID string) error {
+	query := `UPDATE cards SET razorpay_token_id = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, tokenID, time.Now(), id)
+	return err
+}
+
+func (r *SQLCardRepository) CountAccountsWithFingerprint(ctx context.Context, fingerprint string) (int, error) {
+	var count int
+
+	query := `SELECT COUNT(DISTINCT user_id) FROM cards WHERE fingerprint = ?`
+
+	err := conn(ctx, r.db).GetContext(ctx, &count, query, fingerprint)
+	return count, err
+}
+
+func (r *SQLCardRepository) GetSharedFingerprints(ctx context.Context, minAccounts int) ([]model.SharedCardFingerprint, error) {
+	var rows []struct {
+		Fingerprint  string `db:"fingerprint"`
+		AccountCount int    `db:"account_count"`
+		UserIDs      string `db:"user_ids"`
 	}
-	
-	return tx.Commit()
+
+	query := `
+		SELECT fingerprint, COUNT(DISTINCT user_id) AS account_count,
+			GROUP_CONCAT(DISTINCT user_id ORDER BY user_id) AS user_ids
+		FROM cards
+		WHERE fingerprint IS NOT NULL
+		GROUP BY fingerprint
+		HAVING account_count >= ?
+		ORDER BY account_count DESC
+	`
+
+	err := conn(ctx, r.db).SelectContext(ctx, &rows, query, minAccounts)
+	if err != nil {
+		return nil, err
+	}
+
+	shared := make([]model.SharedCardFingerprint, 0, len(rows))
+	for _, row := range rows {
+		shared = append(shared, model.SharedCardFingerprint{
+			Fingerprint:  row.Fingerprint,
+			AccountCount: row.AccountCount,
+			UserIDs:      strings.Split(row.UserIDs, ","),
+		})
+	}
+
+	return shared, nil
 }
 
+// GetUntokenized returns cards that still hold a raw card number from before
+// tokenization.
+func (r *SQLCardRepository) GetUntokenized(ctx context.Context, limit int) ([]model.Card, error) {
+	var cards []model.Card
 
-func (r *SQLCardRepository) DeleteByUserID(ctx context.Context, userID string) error {
-    query := `DELETE FROM cards WHERE user_id = ?`
-    _, err := r.db.ExecContext(ctx, query, userID)
-    return err
-}
\ No newline at end of file
+	query := `
+		SELECT * FROM cards
+		WHERE card_token IS NULL AND card_number IS NOT NULL AND card_number <> ''
+		LIMIT ?
+	`
+
+	err := conn(ctx, r.db).SelectContext(ctx, &cards, query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return cards, nil
+}
+
+// SetToken records the vault token of a legacy card and erases its raw number.
+func (r *SQLCardRepository) SetToken(ctx context.Context, id string, token string, bin string, fingerprint string) error {
+	query := `UPDATE cards SET card_token = ?, bin = ?, fingerprint = ?, card_number = NULL, updated_at = ? WHERE id = ?`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, token, bin, fingerprint, time.Now(), id)
+	return err
+}
+
+// GetUnfingerprinted pages through tokenized cards that have no fingerprint
+// yet, ordered by ID so a caller can skip rows it cannot fix.
+func (r *SQLCardRepository) GetUnfingerprinted(ctx context.Context, afterID string, limit int) ([]model.Card, error) {
+	var cards []model.Card
+
+	query := `
+		SELECT * FROM cards
+		WHERE fingerprint IS NULL AND card_token IS NOT NULL AND deleted_at IS NULL AND id > ?
+		ORDER BY id
+		LIMIT ?
+	`
+
+	err := conn(ctx, r.db).SelectContext(ctx, &cards, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return cards, nil
+}
+
+func (r *SQLCardRepository) SetFingerprint(ctx context.Context, id string, fingerprint string) error {
+	query := `UPDATE cards SET fingerprint = ?, updated_at = ? WHERE id = ?`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, fingerprint, time.Now(), id)
+	return err
+}
+
+// GetWithBIN pages through cards that have a stored BIN, ordered by ID.
+func (r *SQLCardRepository) GetWithBIN(ctx context.Context, afterID string, limit int) ([]model.Card, error) {
+	var cards []model.Card
+
+	query := `
+		SELECT * FROM cards
+		WHERE bin <> '' AND deleted_at IS NULL AND id > ?
+		ORDER BY id
+		LIMIT ?
+	`
+
+	err := conn(ctx, r.db).SelectContext(ctx, &cards, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return cards, nil
+}
+
+func (r *SQLCardRepository) UpdateBINMetadata(ctx context.Context, card *model.Card) error {
+	card.UpdatedAt = time.Now()
+
+	query := `
+		UPDATE cards SET
+			card_type = :card_type,
+			issuer = :issuer,
+			issuer_country = :issuer_country,
+			funding_type = :funding_type,
+			updated_at = :updated_at
+		WHERE id = :id
+	`
+
+	_, err := conn(ctx, r.db).NamedExecContext(ctx, query, card)
+	return err
+}
+
+// GetExpiringWithAutoRenewal returns cards that pay for an auto-renewing
+// subscription, expire before beforeMonth and whose owner has not been
+// warned. Months are compared as year*12 + month.
+func (r *SQLCardRepository) GetExpiringWithAutoRenewal(ctx context.Context, beforeMonth int) ([]model.Card, error) {
+	var cards []model.Card
+
+	query := `
+		SELECT DISTINCT c.* FROM cards c
+		JOIN subscription_transactions st ON st.card_id = c.id
+		WHERE st.auto_renewal = true
+		AND st.status IN (?, ?, ?)
+		AND c.expiry_notified_at IS NULL
+		AND c.deleted_at IS NULL
+		AND c.expiry_year * 12 + c.expiry_month < ?
+	`
+
+	err := conn(ctx, r.db).SelectContext(ctx, &cards, query,
+		model.SubscriptionStatusActive, model.SubscriptionStatusPastDue, model.SubscriptionStatusPaused, beforeMonth)
+	if err != nil {
+		return nil, err
+	}
+
+	return cards, nil
+}
+
+func (r *SQLCardRepository) GetExpiringByUserID(ctx context.Context, userID string, beforeMonth int) ([]model.Card, error) {
+	var cards []model.Card
+
+	query := `
+		SELECT * FROM cards
+		WHERE user_id = ? AND deleted_at IS NULL AND expiry_year * 12 + expiry_month < ?
+		ORDER BY expiry_year, expiry_month
+	`
+
+	err := conn(ctx, r.db).SelectContext(ctx, &cards, query, userID, beforeMonth)
+	if err != nil {
+		return nil, err
+	}
+
+	return cards, nil
+}
+
+// MarkExpired flags cards that expired before beforeMonth as unusable.
+func (r *SQLCardRepository) MarkExpired(ctx context.Context, beforeMonth int) (int64, error) {
+	query := `
+		UPDATE cards SET is_expired = true, updated_at = ?
+		WHERE is_expired = false AND deleted_at IS NULL AND expiry_year * 12 + expiry_month < ?
+	`
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, time.Now(), beforeMonth)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (r *SQLCardRepository) SetExpiryNotified(ctx context.Context, id string, at time.Time) error {
+	query := `UPDATE cards SET expiry_notified_at = ?, updated_at = updated_at WHERE id = ?`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, at, id)
+	return err
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"subscription-management/internal/model"
+)
+
+type CustomerRepository interface {
+	GetByID(ctx context.Context, id string) (*model.UserInfo, error)
+	Save(ctx context.Context, customer *model.UserInfo) error
+	SetRazorpayCustomerID(ctx context.Context, id string, razorpayCustomerID string) error
+}
+
+type SQLCustomerRepository struct {
+	db *sqlx.DB
+}
+
+func NewCustomerRepository(db *sqlx.DB) CustomerRepository {
+	return &SQLCustomerRepository{
+		db: db,
+	}
+}
+
+func (r *SQLCustomerRepository) GetByID(ctx context.Context, id string) (*model.UserInfo, error) {
+	var customer model.UserInfo
+
+	query := `SELECT * FROM customers WHERE id = ?`
+
+	err := conn(ctx, r.db).GetContext(ctx, &customer, query, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &customer, nil
+}
+
+// Save inserts the customer or updates the profile fields of an existing one.
+// The Razorpay customer ID is only written by SetRazorpayCustomerID.
+func (r *SQLCustomerRepository) Save(ctx context.Context, customer *model.UserInfo) error {
+	now := time.Now()
+	if customer.CreatedAt.IsZero() {
+		customer.CreatedAt = now
+	}
+	customer.UpdatedAt = now
+
+	query := `
+		INSERT INTO customers (
+			id, name, email, phone, razorpay_customer_id, currency, created_at, updated_at
+		) VALUES (
+			:id, :name, :email, :phone, :razorpay_customer_id, :currency, :created_at, :updated_at
+		)
+		ON DUPLICATE KEY UPDATE
+			name = VALUES(name),
+			email = VALUES(email),
+			phone = VALUES(phone),
+			currency = VALUES(currency),
+			updated_at = VALUES(updated_at)
+	`
+
+	_, err := conn(ctx, r.db).NamedExecContext(ctx, query, customer)
+	return err
+}
+
+func (r *SQLCustomerRepository) SetRazorpayCustomerID(ctx context.Context, id string, razorpayCustomerID string) error {
+	query := `UPDATE customers SET razorpay_customer_id = ?, updated_at = ? WHERE id = ?`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, razorpayCustomerID, time.Now(), id)
+	return err
+}
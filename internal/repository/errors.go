@@ -0,0 +1,12 @@
+package repository
+
+import "subscription-management/internal/apperr"
+
+// Errors for writes whose preconditions no longer hold. They share their codes
+// with the matching service errors.
+var (
+	ErrCardNotFound          = apperr.New(apperr.NotFound, "card_not_found", "card not found or doesn't belong to user")
+	ErrCardInUse             = apperr.New(apperr.Conflict, "card_in_use", "card is used by an active subscription")
+	ErrSubscriptionNotActive = apperr.New(apperr.Conflict, "subscription_not_active", "subscription not found or already inactive")
+	ErrInvoiceExists         = apperr.New(apperr.Conflict, "invoice_exists", "an invoice has already been issued for this transaction")
+)
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"subscription-management/internal/model"
+)
+
+type IdempotencyRepository interface {
+	Create(ctx context.Context, key *model.IdempotencyKey) (bool, error)
+	Get(ctx context.Context, owner string, key string) (*model.IdempotencyKey, error)
+	Heartbeat(ctx context.Context, id string, at time.Time) error
+	Complete(ctx context.Context, id string, statusCode int, contentType string, body []byte, at time.Time) error
+	Delete(ctx context.Context, id string) error
+	DeleteCreatedBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+type SQLIdempotencyRepository struct {
+	db *sqlx.DB
+}
+
+func NewIdempotencyRepository(db *sqlx.DB) IdempotencyRepository {
+	return &SQLIdempotencyRepository{
+		db: db,
+	}
+}
+
+// Create stores key and reports whether it did. It stores nothing and returns
+// false when the owner has already used the key.
+func (r *SQLIdempotencyRepository) Create(ctx context.Context, key *model.IdempotencyKey) (bool, error) {
+	if key.ID == "" {
+		key.ID = uuid.New().String()
+	}
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+
+	query := `
+		INSERT IGNORE INTO idempotency_keys (
+			id, owner, idempotency_key, request_hash, method, path, created_at
+		) VALUES (
+			:id, :owner, :idempotency_key, :request_hash, :method, :path, :created_at
+		)
+	`
+
+	result, err := conn(ctx, r.db).NamedExecContext(ctx, query, key)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+func (r *SQLIdempotencyRepository) Get(ctx context.Context, owner string, key string) (*model.IdempotencyKey, error) {
+	var record model.IdempotencyKey
+
+	query := `SELECT * FROM idempotency_keys WHERE owner = ? AND idempotency_key = ?`
+
+	err := conn(ctx, r.db).GetContext(ctx, &record, query, owner, key)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// Heartbeat records that the request holding the key is still running.
+func (r *SQLIdempotencyRepository) Heartbeat(ctx context.Context, id string, at time.Time) error {
+	query := `UPDATE idempotency_keys SET heartbeat_at = ? WHERE id = ? AND completed_at IS NULL`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, at, id)
+	return err
+}
+
+func (r *SQLIdempotencyRepository) Complete(ctx context.Context, id string, statusCode int, contentType string, body []byte, at time.Time) error {
+	query := `
+		UPDATE idempotency_keys
+		SET status_code = ?, content_type = ?, response_body = ?, completed_at = ?
+		WHERE id = ?
+	`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, statusCode, contentType, body, at, id)
+	return err
+}
+
+func (r *SQLIdempotencyRepository) Delete(ctx context.Context, id string) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM idempotency_keys WHERE id = ?`, id)
+	return err
+}
+
+func (r *SQLIdempotencyRepository) DeleteCreatedBefore(ctx context.Context, before time.Time) (int64, error) {
+	result, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM idempotency_keys WHERE created_at < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
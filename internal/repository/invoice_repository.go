@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"subscription-management/internal/model"
+)
+
+// InvoiceRepository has no update or delete methods on purpose: invoices are
+// immutable once issued, and the database enforces the same with triggers.
+type InvoiceRepository interface {
+	Create(ctx context.Context, invoice *model.Invoice, beforeInsert func(*model.Invoice) error) error
+	GetByID(ctx context.Context, id string) (*model.Invoice, error)
+	GetByTransactionID(ctx context.Context, transactionID string) (*model.Invoice, error)
+	GetByUserID(ctx context.Context, userID string) ([]model.Invoice, error)
+}
+
+type SQLInvoiceRepository struct {
+	db *sqlx.DB
+}
+
+func NewInvoiceRepository(db *sqlx.DB) InvoiceRepository {
+	return &SQLInvoiceRepository{
+		db: db,
+	}
+}
+
+// Create allocates the next sequential invoice number for the issue year and
+// stores the invoice with its line items in a single transaction. beforeInsert,
+// if set, runs once the number is assigned, so callers can seal the final content.
+// It returns ErrInvoiceExists, without allocating a number, when the
+// transaction already has an invoice.
+func (r *SQLInvoiceRepository) Create(ctx context.Context, invoice *model.Invoice, beforeInsert func(*model.Invoice) error) error {
+	if invoice.ID == "" {
+		invoice.ID = uuid.New().String()
+	}
+	if invoice.IssuedAt.IsZero() {
+		invoice.IssuedAt = time.Now()
+	}
+	invoice.CreatedAt = time.Now()
+
+	for i := range invoice.LineItems {
+		item := &invoice.LineItems[i]
+		if item.ID == "" {
+			item.ID = uuid.New().String()
+		}
+		item.InvoiceID = invoice.ID
+		item.Position = i + 1
+		item.CreatedAt = invoice.CreatedAt
+	}
+
+	return withinTx(ctx, r.db, func(ctx context.Context) error {
+		tx := conn(ctx, r.db)
+
+		// Locking the paid transaction serializes concurrent issuers for it, so
+		// the check below holds until commit and no number is spent on a
+		// duplicate.
+		var transactionID string
+		err := tx.GetContext(ctx, &transactionID, `SELECT id FROM subscription_transactions WHERE id = ? FOR UPDATE`, invoice.TransactionID)
+		if err != nil {
+			return err
+		}
+
+		var issued int
+		err = tx.GetContext(ctx, &issued, `SELECT COUNT(*) FROM invoices WHERE transaction_id = ?`, invoice.TransactionID)
+		if err != nil {
+			return err
+		}
+		if issued > 0 {
+			return ErrInvoiceExists
+		}
+
+		prefix := fmt.Sprintf("INV-%d", invoice.IssuedAt.Year())
+
+		_, err = tx.ExecContext(ctx, `INSERT IGNORE INTO invoice_sequences (prefix, last_value) VALUES (?, 0)`, prefix)
+		if err != nil {
+			return err
+		}
+
+		var lastValue int64
+		err = tx.GetContext(ctx, &lastValue, `SELECT last_value FROM invoice_sequences WHERE prefix = ? FOR UPDATE`, prefix)
+		if err != nil {
+			return err
+		}
+
+		nextValue := lastValue + 1
+		_, err = tx.ExecContext(ctx, `UPDATE invoice_sequences SET last_value = ? WHERE prefix = ?`, nextValue, prefix)
+		if err != nil {
+			return err
+		}
+
+		invoice.InvoiceNumber = fmt.Sprintf("%s-%06d", prefix, nextValue)
+
+		if beforeInsert != nil {
+			if err := beforeInsert(invoice); err != nil {
+				return err
+			}
+		}
+
+		invoiceQuery := `
+			INSERT INTO invoices (
+				id, invoice_number, transaction_id, user_id,
+				customer_name, customer_email, customer_phone,
+				billing_country, billing_state,
+				product_name, plan_name, plan_attributes, payment_type,
+				period_start, period_end, currency,
+				subtotal, discount_total, tax_total, total,
+				razorpay_payment_id, issued_at, content_hash, created_at
+			) VALUES (
+				:id, :invoice_number, :transaction_id, :user_id,
+				:customer_name, :customer_email, :customer_phone,
+				:billing_country, :billing_state,
+				:product_name, :plan_name, :plan_attributes, :payment_type,
+				:period_start, :period_end, :currency,
+				:subtotal, :discount_total, :tax_total, :total,
+				:razorpay_payment_id, :issued_at, :content_hash, :created_at
+			)
+		`
+
+		if _, err := tx.NamedExecContext(ctx, invoiceQuery, invoice); err != nil {
+			return err
+		}
+
+		lineItemQuery := `
+			INSERT INTO invoice_line_items (
+				id, invoice_id, position, kind, description,
+				quantity, unit_amount, amount, created_at
+			) VALUES (
+				:id, :invoice_id, :position, :kind, :description,
+				:quantity, :unit_amount, :amount, :created_at
+			)
+		`
+
+		for i := range invoice.LineItems {
+			if _, err := tx.NamedExecContext(ctx, lineItemQuery, &invoice.LineItems[i]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *SQLInvoiceRepository) GetByID(ctx context.Context, id string) (*model.Invoice, error) {
+	return r.getOne(ctx, `SELECT * FROM invoices WHERE id = ?`, id)
+}
+
+func (r *SQLInvoiceRepository) GetByTransactionID(ctx context.Context, transactionID string) (*model.Invoice, error) {
+	return r.getOne(ctx, `SELECT * FROM invoices WHERE transaction_id = ?`, transactionID)
+}
+
+func (r *SQLInvoiceRepository) GetByUserID(ctx context.Context, userID string) ([]model.Invoice, error) {
+	var invoices []model.Invoice
+
+	query := `
+		SELECT * FROM invoices
+		WHERE user_id = ?
+		ORDER BY issued_at DESC
+	`
+
+	err := conn(ctx, r.db).SelectContext(ctx, &invoices, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range invoices {
+		if err := r.loadLineItems(ctx, &invoices[i]); err != nil {
+			return nil, err
+		}
+		invoices[i].ApplyCurrency()
+	}
+
+	return invoices, nil
+}
+
+func (r *SQLInvoiceRepository) getOne(ctx context.Context, query string, arg interface{}) (*model.Invoice, error) {
+	var invoice model.Invoice
+
+	err := conn(ctx, r.db).GetContext(ctx, &invoice, query, arg)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if err := r.loadLineItems(ctx, &invoice); err != nil {
+		return nil, err
+	}
+	invoice.ApplyCurrency()
+
+	return &invoice, nil
+}
+
+func (r *SQLInvoiceRepository) loadLineItems(ctx context.Context, invoice *model.Invoice) error {
+	query := `
+		SELECT * FROM invoice_line_items
+		WHERE invoice_id = ?
+		ORDER BY position ASC
+	`
+
+	return conn(ctx, r.db).SelectContext(ctx, &invoice.LineItems, query, invoice.ID)
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"subscription-management/internal/model"
+)
+
+// OutboxRepository stores domain events. Add joins the unit of work in ctx,
+// which is what makes an event commit or roll back with its state change.
+type OutboxRepository interface {
+	Add(ctx context.Context, event *model.OutboxEvent) error
+	Claim(ctx context.Context, limit int, until time.Time) ([]model.OutboxEvent, error)
+	Release(ctx context.Context, ids []int64) error
+	MarkPublished(ctx context.Context, id int64, at time.Time) error
+	MarkFailed(ctx context.Context, id int64, reason string) error
+	MarkDeadLettered(ctx context.Context, id int64, reason string, at time.Time) error
+}
+
+type SQLOutboxRepository struct {
+	db *sqlx.DB
+}
+
+func NewOutboxRepository(db *sqlx.DB) OutboxRepository {
+	return &SQLOutboxRepository{
+		db: db,
+	}
+}
+
+func (r *SQLOutboxRepository) Add(ctx context.Context, event *model.OutboxEvent) error {
+	if event.EventID == "" {
+		event.EventID = uuid.New().String()
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO outbox_events (
+			event_id, event_type, aggregate_type, aggregate_id, user_id, payload, occurred_at
+		) VALUES (
+			:event_id, :event_type, :aggregate_type, :aggregate_id, :user_id, :payload, :occurred_at
+		)
+	`
+
+	result, err := conn(ctx, r.db).NamedExecContext(ctx, query, event)
+	if err != nil {
+		return err
+	}
+	event.ID, err = result.LastInsertId()
+	return err
+}
+
+// Claim returns the oldest events still to publish, in the order they were
+// written, and reserves them for the caller until the given time. It returns
+// nothing while another relay holds an unexpired claim on the oldest of them,
+// so batches are published one after another and never interleave. The claim
+// commits before Claim returns; no lock is held while the events are sent.
+func (r *SQLOutboxRepository) Claim(ctx context.Context, limit int, until time.Time) ([]model.OutboxEvent, error) {
+	var events []model.OutboxEvent
+
+	err := withinTx(ctx, r.db, func(ctx context.Context) error {
+		query := `
+			SELECT * FROM outbox_events
+			WHERE published_at IS NULL AND dead_lettered_at IS NULL
+			ORDER BY id ASC
+			LIMIT ?
+			FOR UPDATE
+		`
+		if err := conn(ctx, r.db).SelectContext(ctx, &events, query, limit); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		ids := make([]int64, 0, len(events))
+		for _, event := range events {
+			if event.ClaimedUntil.Valid && event.ClaimedUntil.Time.After(now) {
+				events = nil
+				return nil
+			}
+			ids = append(ids, event.ID)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		update, args, err := sqlx.In(`UPDATE outbox_events SET claimed_until = ? WHERE id IN (?)`, until, ids)
+		if err != nil {
+			return err
+		}
+		_, err = conn(ctx, r.db).ExecContext(ctx, update, args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// Release gives up the claim on events the caller did not get to, so the next
+// run can publish them straight away.
+func (r *SQLOutboxRepository) Release(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query, args, err := sqlx.In(`UPDATE outbox_events SET claimed_until = NULL WHERE id IN (?) AND published_at IS NULL`, ids)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn(ctx, r.db).ExecContext(ctx, query, args...)
+	return err
+}
+
+func (r *SQLOutboxRepository) MarkPublished(ctx context.Context, id int64, at time.Time) error {
+	query := `UPDATE outbox_events SET published_at = ?, claimed_until = NULL, attempts = attempts + 1, last_error = NULL WHERE id = ?`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, at, id)
+	return err
+}
+
+func (r *SQLOutboxRepository) MarkFailed(ctx context.Context, id int64, reason string) error {
+	query := `UPDATE outbox_events SET claimed_until = NULL, attempts = attempts + 1, last_error = ? WHERE id = ?`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, reason, id)
+	return err
+}
+
+// MarkDeadLettered records a final failure and sets the event aside. It is no
+// longer published and no longer holds back the events after it.
+func (r *SQLOutboxRepository) MarkDeadLettered(ctx context.Context, id int64, reason string, at time.Time) error {
+	query := `
+		UPDATE outbox_events
+		SET dead_lettered_at = ?, claimed_until = NULL, attempts = attempts + 1, last_error = ?
+		WHERE id = ?
+	`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, at, reason, id)
+	return err
+}
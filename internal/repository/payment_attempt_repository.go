@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"subscription-management/internal/model"
+)
+
+type PaymentAttemptRepository interface {
+	Create(ctx context.Context, attempt *model.PaymentAttempt) error
+	Update(ctx context.Context, attempt *model.PaymentAttempt) error
+	GetBySubscriptionID(ctx context.Context, subscriptionID string) ([]model.PaymentAttempt, error)
+	GetLatestBySubscriptionID(ctx context.Context, subscriptionID string) (*model.PaymentAttempt, error)
+}
+
+type SQLPaymentAttemptRepository struct {
+	db *sqlx.DB
+}
+
+func NewPaymentAttemptRepository(db *sqlx.DB) PaymentAttemptRepository {
+	return &SQLPaymentAttemptRepository{
+		db: db,
+	}
+}
+
+func (r *SQLPaymentAttemptRepository) Create(ctx context.Context, attempt *model.PaymentAttempt) error {
+	if attempt.ID == "" {
+		attempt.ID = uuid.New().String()
+	}
+
+	attempt.CreatedAt = time.Now()
+	attempt.UpdatedAt = time.Now()
+
+	query := `
+		INSERT INTO payment_attempts (
+			id, subscription_id, user_id, card_id, attempt_number, status,
+			failure_reason, razorpay_payment_id, razorpay_order_id,
+			next_retry_at, created_at, updated_at
+		) VALUES (
+			:id, :subscription_id, :user_id, :card_id, :attempt_number, :status,
+			:failure_reason, :razorpay_payment_id, :razorpay_order_id,
+			:next_retry_at, :created_at, :updated_at
+		)
+	`
+
+	_, err := conn(ctx, r.db).NamedExecContext(ctx, query, attempt)
+	return err
+}
+
+func (r *SQLPaymentAttemptRepository) Update(ctx context.Context, attempt *model.PaymentAttempt) error {
+	attempt.UpdatedAt = time.Now()
+
+	query := `
+		UPDATE payment_attempts SET
+			card_id = :card_id,
+			status = :status,
+			failure_reason = :failure_reason,
+			razorpay_payment_id = :razorpay_payment_id,
+			razorpay_order_id = :razorpay_order_id,
+			next_retry_at = :next_retry_at,
+			updated_at = :updated_at
+		WHERE id = :id
+	`
+
+	_, err := conn(ctx, r.db).NamedExecContext(ctx, query, attempt)
+	return err
+}
+
+func (r *SQLPaymentAttemptRepository) GetBySubscriptionID(ctx context.Context, subscriptionID string) ([]model.PaymentAttempt, error) {
+	var attempts []model.PaymentAttempt
+
+	query := `
+		SELECT * FROM payment_attempts
+		WHERE subscription_id = ?
+		ORDER BY created_at ASC
+	`
+
+	err := conn(ctx, r.db).SelectContext(ctx, &attempts, query, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return attempts, nil
+}
+
+func (r *SQLPaymentAttemptRepository) GetLatestBySubscriptionID(ctx context.Context, subscriptionID string) (*model.PaymentAttempt, error) {
+	var attempt model.PaymentAttempt
+
+	query := `
+		SELECT * FROM payment_attempts
+		WHERE subscription_id = ?
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+
+	err := conn(ctx, r.db).GetContext(ctx, &attempt, query, subscriptionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &attempt, nil
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"subscription-management/internal/model"
+	"subscription-management/internal/money"
+)
+
+type RefundRepository interface {
+	Create(ctx context.Context, refund *model.Refund) error
+	Update(ctx context.Context, refund *model.Refund) error
+	GetByRazorpayRefundID(ctx context.Context, razorpayRefundID string) (*model.Refund, error)
+	GetBySubscriptionID(ctx context.Context, subscriptionID string) ([]model.Refund, error)
+	GetRefundedAmount(ctx context.Context, razorpayPaymentID string, currency string) (money.Money, error)
+}
+
+type SQLRefundRepository struct {
+	db *sqlx.DB
+}
+
+func NewRefundRepository(db *sqlx.DB) RefundRepository {
+	return &SQLRefundRepository{
+		db: db,
+	}
+}
+
+func (r *SQLRefundRepository) Create(ctx context.Context, refund *model.Refund) error {
+	if refund.ID == "" {
+		refund.ID = uuid.New().String()
+	}
+
+	if refund.Currency == "" {
+		refund.Currency = refund.Amount.Currency
+	}
+	refund.CreatedAt = time.Now()
+	refund.UpdatedAt = time.Now()
+
+	query := `
+		INSERT INTO refunds (
+			id, subscription_id, user_id, razorpay_payment_id, razorpay_refund_id,
+			amount, currency, reason, status, failure_reason, created_at, updated_at
+		) VALUES (
+			:id, :subscription_id, :user_id, :razorpay_payment_id, :razorpay_refund_id,
+			:amount, :currency, :reason, :status, :failure_reason, :created_at, :updated_at
+		)
+	`
+
+	_, err := conn(ctx, r.db).NamedExecContext(ctx, query, refund)
+	return err
+}
+
+func (r *SQLRefundRepository) Update(ctx context.Context, refund *model.Refund) error {
+	refund.UpdatedAt = time.Now()
+
+	query := `
+		UPDATE refunds SET
+			razorpay_refund_id = :razorpay_refund_id,
+			status = :status,
+			failure_reason = :failure_reason,
+			updated_at = :updated_at
+		WHERE id = :id
+	`
+
+	_, err := conn(ctx, r.db).NamedExecContext(ctx, query, refund)
+	return err
+}
+
+func (r *SQLRefundRepository) GetByRazorpayRefundID(ctx context.Context, razorpayRefundID string) (*model.Refund, error) {
+	var refund model.Refund
+
+	query := `SELECT * FROM refunds WHERE razorpay_refund_id = ?`
+
+	err := conn(ctx, r.db).GetContext(ctx, &refund, query, razorpayRefundID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	refund.Amount = refund.Amount.WithCurrency(refund.Currency)
+	return &refund, nil
+}
+
+func (r *SQLRefundRepository) GetBySubscriptionID(ctx context.Context, subscriptionID string) ([]model.Refund, error) {
+	var refunds []model.Refund
+
+	query := `
+		SELECT * FROM refunds
+		WHERE subscription_id = ?
+		ORDER BY created_at DESC
+	`
+
+	err := conn(ctx, r.db).SelectContext(ctx, &refunds, query, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range refunds {
+		refunds[i].Amount = refunds[i].Amount.WithCurrency(refunds[i].Currency)
+	}
+
+	return refunds, nil
+}
+
+func (r *SQLRefundRepository) GetRefundedAmount(ctx context.Context, razorpayPaymentID string, currency string) (money.Money, error) {
+	amount := money.Zero(currency)
+
+	query := `
+		SELECT COALESCE(SUM(amount), 0) FROM refunds
+		WHERE razorpay_payment_id = ? AND currency = ? AND status != ?
+	`
+
+	err := conn(ctx, r.db).GetContext(ctx, &amount, query, razorpayPaymentID, currency, model.RefundStatusFailed)
+	if err != nil {
+		return money.Money{}, err
+	}
+
+	return amount, nil
+}
@@ -10,12 +10,17 @@ import (
 	"github.com/jmoiron/sqlx"
 
 	"subscription-management/internal/model"
+	"subscription-management/internal/money"
 )
 
 type SubscriptionRepository interface {
 	GetProducts(ctx context.Context) ([]model.SubscriptionProduct, error)
 	GetPlans(ctx context.Context, productID string) ([]model.SubscriptionPlan, error)
 	GetPlanWithAttributes(ctx context.Context, planID string) (*model.SubscriptionPlanWithAttributes, error)
+	GetPlanPrice(ctx context.Context, planID string, currency string, paymentType string) (*model.PlanPrice, error)
+	SetPlanPriceRazorpayPlanID(ctx context.Context, priceID string, razorpayPlanID string) error
+	GetGatewayPlanID(ctx context.Context, priceID string, taxTreatment string, amount money.Money) (string, error)
+	AddGatewayPlan(ctx context.Context, priceID string, taxTreatment string, amount money.Money, razorpayPlanID string) error
 	GetActiveSubscription(ctx context.Context, userID string) (*model.SubscriptionTransaction, error)
 	GetSubscriptionHistory(ctx context.Context, userID string) ([]model.SubscriptionTransaction, error)
 	CreateSubscription(ctx context.Context, subscription *model.SubscriptionTransaction) error
@@ -24,6 +29,11 @@ type SubscriptionRepository interface {
 	GetSubscriptionByRazorpayOrderID(ctx context.Context, orderID string) (*model.SubscriptionTransaction, error)
 	GetSubscriptionByRazorpaySubscriptionID(ctx context.Context, subscriptionID string) (*model.SubscriptionTransaction, error)
 	UpdateSubscription(ctx context.Context, subscription *model.SubscriptionTransaction) error
+	SetCard(ctx context.Context, subscriptionID string, cardID string) error
+	SetPendingCard(ctx context.Context, subscriptionID string, cardID string) error
+	GetSubscriptionsByStatus(ctx context.Context, status string) ([]model.SubscriptionTransaction, error)
+	GetScheduledCancellations(ctx context.Context, before time.Time) ([]model.SubscriptionTransaction, error)
+	GetCatalogMismatches(ctx context.Context) ([]model.CatalogMismatch, error)
 }
 
 
@@ -43,7 +53,7 @@ func (r *SQLSubscriptionRepository) GetProducts(ctx context.Context) ([]model.Su
 	
 	query := `SELECT * FROM subscription_products`
 	
-	err := r.db.SelectContext(ctx, &products, query)
+	err := conn(ctx, r.db).SelectContext(ctx, &products, query)
 	if err != nil {
 		return nil, err
 	}
@@ -64,7 +74,7 @@ func (r *SQLSubscriptionRepository) GetPlans(ctx context.Context, productID stri
 		query = `SELECT * FROM subscription_plans`
 	}
 	
-	err := r.db.SelectContext(ctx, &plans, query, args...)
+	err := conn(ctx, r.db).SelectContext(ctx, &plans, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -75,6 +85,12 @@ func (r *SQLSubscriptionRepository) GetPlans(ctx context.Context, productID stri
 			return nil, err
 		}
 		plans[i].Attributes = attributes
+
+		prices, err := r.getPlanPrices(ctx, plans[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		plans[i].Prices = prices
 	}
 	
 	return plans, nil
@@ -85,7 +101,7 @@ func (r *SQLSubscriptionRepository) GetPlanWithAttributes(ctx context.Context, p
 	
 	planQuery := `SELECT * FROM subscription_plans WHERE id = ?`
 	
-	err := r.db.GetContext(ctx, &plan, planQuery, planID)
+	err := conn(ctx, r.db).GetContext(ctx, &plan, planQuery, planID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil 
@@ -98,12 +114,92 @@ func (r *SQLSubscriptionRepository) GetPlanWithAttributes(ctx context.Context, p
 		return nil, err
 	}
 	
+	plan.Prices, err = r.getPlanPrices(ctx, planID)
+	if err != nil {
+		return nil, err
+	}
+	
 	return &model.SubscriptionPlanWithAttributes{
 		Plan:       plan,
 		Attributes: attributes,
 	}, nil
 }
 
+func (r *SQLSubscriptionRepository) getPlanPrices(ctx context.Context, planID string) ([]model.PlanPrice, error) {
+	var prices []model.PlanPrice
+	
+	query := `
+		SELECT * FROM plan_prices
+		WHERE plan_id = ?
+		ORDER BY currency, payment_type
+	`
+	
+	err := conn(ctx, r.db).SelectContext(ctx, &prices, query, planID)
+	if err != nil {
+		return nil, err
+	}
+	
+	for i := range prices {
+		prices[i].Amount = prices[i].Amount.WithCurrency(prices[i].Currency)
+	}
+	
+	return prices, nil
+}
+
+func (r *SQLSubscriptionRepository) GetPlanPrice(ctx context.Context, planID string, currency string, paymentType string) (*model.PlanPrice, error) {
+	var price model.PlanPrice
+	
+	query := `SELECT * FROM plan_prices WHERE plan_id = ? AND currency = ? AND payment_type = ?`
+	
+	err := conn(ctx, r.db).GetContext(ctx, &price, query, planID, currency, paymentType)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	
+	price.Amount = price.Amount.WithCurrency(price.Currency)
+	return &price, nil
+}
+
+func (r *SQLSubscriptionRepository) SetPlanPriceRazorpayPlanID(ctx context.Context, priceID string, razorpayPlanID string) error {
+	query := `UPDATE plan_prices SET razorpay_plan_id = ? WHERE id = ?`
+	
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, razorpayPlanID, priceID)
+	return err
+}
+
+// GetGatewayPlanID returns the Razorpay plan that charges amount for the price
+// under the given tax treatment, or "" if none has been created yet.
+func (r *SQLSubscriptionRepository) GetGatewayPlanID(ctx context.Context, priceID string, taxTreatment string, amount money.Money) (string, error) {
+	var razorpayPlanID string
+
+	query := `SELECT razorpay_plan_id FROM gateway_plans WHERE plan_price_id = ? AND tax_treatment = ? AND amount = ?`
+
+	err := conn(ctx, r.db).GetContext(ctx, &razorpayPlanID, query, priceID, taxTreatment, amount)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return razorpayPlanID, nil
+}
+
+// AddGatewayPlan records a Razorpay plan for the price, tax treatment and
+// amount. When another request recorded one first, that one is kept.
+func (r *SQLSubscriptionRepository) AddGatewayPlan(ctx context.Context, priceID string, taxTreatment string, amount money.Money, razorpayPlanID string) error {
+	query := `
+		INSERT IGNORE INTO gateway_plans (id, plan_price_id, tax_treatment, amount, razorpay_plan_id)
+		VALUES (?, ?, ?, ?, ?)
+	`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, uuid.New().String(), priceID, taxTreatment, amount, razorpayPlanID)
+	return err
+}
+
 func (r *SQLSubscriptionRepository) getPlanAttributes(ctx context.Context, planID string) ([]model.SubscriptionProductAttribute, error) {
 	var attributes []model.SubscriptionProductAttribute
 	
@@ -113,7 +209,7 @@ func (r *SQLSubscriptionRepository) getPlanAttributes(ctx context.Context, planI
 		WHERE pa.plan_id = ?
 	`
 	
-	err := r.db.SelectContext(ctx, &attributes, query, planID)
+	err := conn(ctx, r.db).SelectContext(ctx, &attributes, query, planID)
 	if err != nil {
 		return nil, err
 	}
@@ -130,7 +226,7 @@ func (r *SQLSubscriptionRepository) GetActiveSubscription(ctx context.Context, u
 		LIMIT 1
 	`
 	
-	err := r.db.GetContext(ctx, &subscription, query, userID)
+	err := conn(ctx, r.db).GetContext(ctx, &subscription, query, userID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil 
@@ -154,7 +250,7 @@ func (r *SQLSubscriptionRepository) GetSubscriptionHistory(ctx context.Context,
 		ORDER BY created_at DESC
 	`
 	
-	err := r.db.SelectContext(ctx, &subscriptions, query, userID)
+	err := conn(ctx, r.db).SelectContext(ctx, &subscriptions, query, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -168,54 +264,64 @@ func (r *SQLSubscriptionRepository) GetSubscriptionHistory(ctx context.Context,
 	return subscriptions, nil
 }
 
+// CreateSubscription stores subscription as the user's only active one,
+// expiring the subscription it replaces in the same transaction.
 func (r *SQLSubscriptionRepository) CreateSubscription(ctx context.Context, subscription *model.SubscriptionTransaction) error {
 	if subscription.ID == "" {
 		subscription.ID = uuid.New().String()
 	}
 	
-	deactivateQuery := `
-		UPDATE subscription_transactions
-		SET is_active = false
-		WHERE user_id = ? AND is_active = true
-	`
-	
-	_, err := r.db.ExecContext(ctx, deactivateQuery, subscription.UserID)
-	if err != nil {
-		return err
+	if subscription.Status == "" {
+		subscription.Status = model.SubscriptionStatusActive
+	}
+	if subscription.Currency == "" {
+		subscription.Currency = subscription.Amount.Currency
 	}
-	
 	
 	subscription.CreatedAt = time.Now()
 	subscription.UpdatedAt = time.Now()
 	
+	deactivateQuery := `
+		UPDATE subscription_transactions
+		SET is_active = false, status = 'expired'
+		WHERE user_id = ? AND is_active = true
+	`
+	
 	insertQuery := `
 		INSERT INTO subscription_transactions (
 			id, user_id, product_id, plan_id, card_id,
-			is_renewal, is_active, payment_type, amount,
+			is_renewal, is_active, payment_type, currency, amount,
+			amount_exclusive, tax_amount, tax_breakdown, billing_country, billing_state,
 			start_date, end_date, next_renewal_date,
 			razorpay_order_id, razorpay_payment_id, razorpay_subscription_id,
-			auto_renewal, created_at, updated_at
+			auto_renewal, status, grace_period_ends_at, created_at, updated_at
 		) VALUES (
 			:id, :user_id, :product_id, :plan_id, :card_id,
-			:is_renewal, :is_active, :payment_type, :amount,
+			:is_renewal, :is_active, :payment_type, :currency, :amount,
+			:amount_exclusive, :tax_amount, :tax_breakdown, :billing_country, :billing_state,
 			:start_date, :end_date, :next_renewal_date,
 			:razorpay_order_id, :razorpay_payment_id, :razorpay_subscription_id,
-			:auto_renewal, :created_at, :updated_at
+			:auto_renewal, :status, :grace_period_ends_at, :created_at, :updated_at
 		)
 	`
 	
-	_, err = r.db.NamedExecContext(ctx, insertQuery, subscription)
-	return err
+	return withinTx(ctx, r.db, func(ctx context.Context) error {
+		if _, err := conn(ctx, r.db).ExecContext(ctx, deactivateQuery, subscription.UserID); err != nil {
+			return err
+		}
+		_, err := conn(ctx, r.db).NamedExecContext(ctx, insertQuery, subscription)
+		return err
+	})
 }
 
 func (r *SQLSubscriptionRepository) StopSubscription(ctx context.Context, subscriptionID string, userID string) error {
 	query := `
 		UPDATE subscription_transactions
-		SET is_active = false, updated_at = NOW()
+		SET is_active = false, status = 'cancelled', updated_at = NOW()
 		WHERE id = ? AND user_id = ? AND is_active = true
 	`
 	
-	result, err := r.db.ExecContext(ctx, query, subscriptionID, userID)
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, subscriptionID, userID)
 	if err != nil {
 		return err
 	}
@@ -226,7 +332,7 @@ func (r *SQLSubscriptionRepository) StopSubscription(ctx context.Context, subscr
 	}
 	
 	if rows == 0 {
-		return errors.New("subscription not found or already inactive")
+		return ErrSubscriptionNotActive
 	}
 	
 	return nil
@@ -237,7 +343,7 @@ func (r *SQLSubscriptionRepository) GetSubscriptionByID(ctx context.Context, sub
 	
 	query := `SELECT * FROM subscription_transactions WHERE id = ?`
 	
-	err := r.db.GetContext(ctx, &subscription, query, subscriptionID)
+	err := conn(ctx, r.db).GetContext(ctx, &subscription, query, subscriptionID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil 
@@ -253,10 +359,11 @@ func (r *SQLSubscriptionRepository) GetSubscriptionByID(ctx context.Context, sub
 }
 
 func (r *SQLSubscriptionRepository) enrichSubscriptionData(ctx context.Context, subscription *model.SubscriptionTransaction) error {
+	subscription.ApplyCurrency()
 
 	var planName string
 	planQuery := `SELECT name FROM subscription_plans WHERE id = ?`
-	err := r.db.GetContext(ctx, &planName, planQuery, subscription.PlanID)
+	err := conn(ctx, r.db).GetContext(ctx, &planName, planQuery, subscription.PlanID)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return err
 	}
@@ -264,7 +371,7 @@ func (r *SQLSubscriptionRepository) enrichSubscriptionData(ctx context.Context,
 
 	var productName string
 	productQuery := `SELECT name FROM subscription_products WHERE id = ?`
-	err = r.db.GetContext(ctx, &productName, productQuery, subscription.ProductID)
+	err = conn(ctx, r.db).GetContext(ctx, &productName, productQuery, subscription.ProductID)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return err
 	}
@@ -272,7 +379,7 @@ func (r *SQLSubscriptionRepository) enrichSubscriptionData(ctx context.Context,
 	
 	var cardLastFour string
 	cardQuery := `SELECT last_four_digits FROM cards WHERE id = ?`
-	err = r.db.GetContext(ctx, &cardLastFour, cardQuery, subscription.CardID)
+	err = conn(ctx, r.db).GetContext(ctx, &cardLastFour, cardQuery, subscription.CardID)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return err
 	}
@@ -286,7 +393,7 @@ func (r *SQLSubscriptionRepository) GetSubscriptionByRazorpayOrderID(ctx context
 	
 	query := `SELECT * FROM subscription_transactions WHERE razorpay_order_id = ?`
 	
-	err := r.db.GetContext(ctx, &subscription, query, orderID)
+	err := conn(ctx, r.db).GetContext(ctx, &subscription, query, orderID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil 
@@ -305,9 +412,14 @@ func (r *SQLSubscriptionRepository) GetSubscriptionByRazorpayOrderID(ctx context
 func (r *SQLSubscriptionRepository) GetSubscriptionByRazorpaySubscriptionID(ctx context.Context, subscriptionID string) (*model.SubscriptionTransaction, error) {
 	var subscription model.SubscriptionTransaction
 	
-	query := `SELECT * FROM subscription_transactions WHERE razorpay_subscription_id = ?`
+	query := `
+		SELECT * FROM subscription_transactions
+		WHERE razorpay_subscription_id = ?
+		ORDER BY is_active DESC, created_at DESC
+		LIMIT 1
+	`
 	
-	err := r.db.GetContext(ctx, &subscription, query, subscriptionID)
+	err := conn(ctx, r.db).GetContext(ctx, &subscription, query, subscriptionID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil 
@@ -332,11 +444,121 @@ func (r *SQLSubscriptionRepository) UpdateSubscription(ctx context.Context, subs
 			razorpay_payment_id = :razorpay_payment_id,
 			razorpay_order_id = :razorpay_order_id,
 			razorpay_subscription_id = :razorpay_subscription_id,
+			end_date = :end_date,
 			next_renewal_date = :next_renewal_date,
+			status = :status,
+			grace_period_ends_at = :grace_period_ends_at,
+			paused_at = :paused_at,
+			resume_at = :resume_at,
+			auto_renewal = :auto_renewal,
+			cancel_at_period_end = :cancel_at_period_end,
+			cancel_at = :cancel_at,
 			updated_at = :updated_at
 		WHERE id = :id
 	`
 	
-	_, err := r.db.NamedExecContext(ctx, query, subscription)
+	_, err := conn(ctx, r.db).NamedExecContext(ctx, query, subscription)
+	return err
+}
+
+// SetCard moves a subscription to another card, provided the card has not been
+// removed in the meantime. Any pending card change is settled by it.
+func (r *SQLSubscriptionRepository) SetCard(ctx context.Context, subscriptionID string, cardID string) error {
+	query := `
+		UPDATE subscription_transactions SET card_id = ?, pending_card_id = NULL, updated_at = ?
+		WHERE id = ? AND EXISTS (SELECT 1 FROM cards WHERE id = ? AND deleted_at IS NULL)
+	`
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, cardID, time.Now(), subscriptionID, cardID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrCardNotFound
+	}
+
+	return nil
+}
+
+// SetPendingCard records the card a subscription moves to once the gateway
+// confirms it. An empty cardID clears the pending change.
+func (r *SQLSubscriptionRepository) SetPendingCard(ctx context.Context, subscriptionID string, cardID string) error {
+	query := `UPDATE subscription_transactions SET pending_card_id = ?, updated_at = ? WHERE id = ?`
+
+	pending := sql.NullString{String: cardID, Valid: cardID != ""}
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, pending, time.Now(), subscriptionID)
 	return err
-}
\ No newline at end of file
+}
+
+func (r *SQLSubscriptionRepository) GetSubscriptionsByStatus(ctx context.Context, status string) ([]model.SubscriptionTransaction, error) {
+	var subscriptions []model.SubscriptionTransaction
+	
+	query := `
+		SELECT * FROM subscription_transactions
+		WHERE status = ? AND is_active = true
+		ORDER BY updated_at ASC
+	`
+	
+	err := conn(ctx, r.db).SelectContext(ctx, &subscriptions, query, status)
+	if err != nil {
+		return nil, err
+	}
+	
+	for i := range subscriptions {
+		if err := r.enrichSubscriptionData(ctx, &subscriptions[i]); err != nil {
+			return nil, err
+		}
+	}
+	
+	return subscriptions, nil
+}
+
+func (r *SQLSubscriptionRepository) GetScheduledCancellations(ctx context.Context, before time.Time) ([]model.SubscriptionTransaction, error) {
+	var subscriptions []model.SubscriptionTransaction
+	
+	query := `
+		SELECT * FROM subscription_transactions
+		WHERE cancel_at_period_end = true AND is_active = true AND cancel_at <= ?
+		ORDER BY cancel_at ASC
+	`
+	
+	err := conn(ctx, r.db).SelectContext(ctx, &subscriptions, query, before)
+	if err != nil {
+		return nil, err
+	}
+	
+	for i := range subscriptions {
+		subscriptions[i].ApplyCurrency()
+	}
+	
+	return subscriptions, nil
+}
+
+// GetCatalogMismatches returns the subscriptions whose product disagrees with
+// their plan or does not exist, oldest first.
+func (r *SQLSubscriptionRepository) GetCatalogMismatches(ctx context.Context) ([]model.CatalogMismatch, error) {
+	var mismatches []model.CatalogMismatch
+	
+	query := `
+		SELECT st.id AS subscription_id, st.user_id, st.plan_id, st.product_id,
+			p.product_id AS plan_product_id, pr.id IS NOT NULL AS product_exists, st.created_at
+		FROM subscription_transactions st
+		LEFT JOIN subscription_plans p ON p.id = st.plan_id
+		LEFT JOIN subscription_products pr ON pr.id = st.product_id
+		WHERE p.id IS NULL OR pr.id IS NULL OR p.product_id <> st.product_id
+		ORDER BY st.created_at ASC
+	`
+	
+	err := conn(ctx, r.db).SelectContext(ctx, &mismatches, query)
+	if err != nil {
+		return nil, err
+	}
+	
+	return mismatches, nil
+}
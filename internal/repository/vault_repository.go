@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"subscription-management/internal/model"
+)
+
+type VaultRepository interface {
+	Save(ctx context.Context, entry *model.VaultEntry) error
+	Get(ctx context.Context, token string) (*model.VaultEntry, error)
+	Delete(ctx context.Context, token string) error
+}
+
+type SQLVaultRepository struct {
+	db *sqlx.DB
+}
+
+func NewVaultRepository(db *sqlx.DB) VaultRepository {
+	return &SQLVaultRepository{
+		db: db,
+	}
+}
+
+func (r *SQLVaultRepository) Save(ctx context.Context, entry *model.VaultEntry) error {
+	entry.CreatedAt = time.Now()
+
+	query := `
+		INSERT INTO card_vault (
+			token, key_id, encrypted_key, encrypted_pan, created_at
+		) VALUES (
+			:token, :key_id, :encrypted_key, :encrypted_pan, :created_at
+		)
+	`
+
+	_, err := conn(ctx, r.db).NamedExecContext(ctx, query, entry)
+	return err
+}
+
+func (r *SQLVaultRepository) Get(ctx context.Context, token string) (*model.VaultEntry, error) {
+	var entry model.VaultEntry
+
+	query := `SELECT * FROM card_vault WHERE token = ?`
+
+	err := conn(ctx, r.db).GetContext(ctx, &entry, query, token)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+func (r *SQLVaultRepository) Delete(ctx context.Context, token string) error {
+	query := `DELETE FROM card_vault WHERE token = ?`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, token)
+	return err
+}
@@ -0,0 +1,280 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"subscription-management/internal/config"
+	"subscription-management/internal/model"
+)
+
+// memAPIKeyRepository keeps API keys in memory for tests.
+type memAPIKeyRepository struct {
+	keys    map[string]*model.APIKey
+	touched int
+}
+
+func newMemAPIKeyRepository() *memAPIKeyRepository {
+	return &memAPIKeyRepository{keys: map[string]*model.APIKey{}}
+}
+
+func (r *memAPIKeyRepository) Create(ctx context.Context, key *model.APIKey) error {
+	if key.ID == "" {
+		key.ID = uuid.New().String()
+	}
+	stored := *key
+	r.keys[key.ID] = &stored
+	return nil
+}
+
+func (r *memAPIKeyRepository) GetByID(ctx context.Context, id string) (*model.APIKey, error) {
+	if key, ok := r.keys[id]; ok {
+		found := *key
+		return &found, nil
+	}
+	return nil, nil
+}
+
+func (r *memAPIKeyRepository) GetByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	for _, key := range r.keys {
+		if key.KeyHash == keyHash {
+			found := *key
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memAPIKeyRepository) List(ctx context.Context) ([]model.APIKey, error) {
+	var keys []model.APIKey
+	for _, key := range r.keys {
+		keys = append(keys, *key)
+	}
+	return keys, nil
+}
+
+func (r *memAPIKeyRepository) Rotate(ctx context.Context, oldID string, replacement *model.APIKey, revokeAt time.Time) error {
+	if err := r.Create(ctx, replacement); err != nil {
+		return err
+	}
+	if old := r.keys[oldID]; old != nil && !old.RevokedAt.Valid {
+		old.RevokedAt = sql.NullTime{Time: revokeAt, Valid: true}
+	}
+	return nil
+}
+
+func (r *memAPIKeyRepository) Revoke(ctx context.Context, id string, at time.Time) error {
+	if key := r.keys[id]; key != nil && (!key.RevokedAt.Valid || key.RevokedAt.Time.After(at)) {
+		key.RevokedAt = sql.NullTime{Time: at, Valid: true}
+	}
+	return nil
+}
+
+func (r *memAPIKeyRepository) TouchLastUsed(ctx context.Context, id string, at time.Time) error {
+	r.touched++
+	r.keys[id].LastUsedAt = sql.NullTime{Time: at, Valid: true}
+	return nil
+}
+
+func newTestAPIKeyService(repo *memAPIKeyRepository, grace time.Duration) APIKeyService {
+	return NewAPIKeyService(repo, config.APIKeyConfig{RotationGracePeriod: grace})
+}
+
+func TestHashAPIKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"smk_test", "95312e93b112e9635906eccba747c8569633c6889139e66e822b60db50b0a4fc"},
+		{"", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+	}
+
+	for _, tt := range tests {
+		if got := hashAPIKey(tt.key); got != tt.want {
+			t.Errorf("hashAPIKey(%q) = %s, want %s", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestNewAPIKey(t *testing.T) {
+	first, err := newAPIKey("billing", []string{model.ScopeCardsRead})
+	if err != nil {
+		t.Fatalf("newAPIKey: %v", err)
+	}
+	second, err := newAPIKey("billing", []string{model.ScopeCardsRead})
+	if err != nil {
+		t.Fatalf("newAPIKey: %v", err)
+	}
+
+	for _, issued := range []*model.IssuedAPIKey{first, second} {
+		if !strings.HasPrefix(issued.Key, apiKeyPrefix) || len(issued.Key) != len(apiKeyPrefix)+43 {
+			t.Errorf("key %q is not the prefix and 32 random bytes", issued.Key)
+		}
+		if issued.Prefix != issued.Key[:apiKeyDisplayLength] {
+			t.Errorf("Prefix = %q, want the first %d characters of the key", issued.Prefix, apiKeyDisplayLength)
+		}
+		if issued.KeyHash != hashAPIKey(issued.Key) {
+			t.Errorf("KeyHash is not the hash of the key")
+		}
+		if strings.Contains(issued.KeyHash, issued.Key) {
+			t.Errorf("KeyHash contains the key")
+		}
+	}
+	if first.Key == second.Key {
+		t.Error("two keys are equal")
+	}
+}
+
+func TestCreateKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyName string
+		scopes  []string
+		wantErr error
+	}{
+		{"valid", "billing", []string{model.ScopeCardsRead, model.ScopeSubscriptionsWrite}, nil},
+		{"wildcard scope", "billing", []string{"cards:*"}, nil},
+		{"name is trimmed to nothing", "  ", []string{model.ScopeCardsRead}, ErrAPIKeyNameRequired},
+		{"no scopes", "billing", nil, ErrInvalidScope},
+		{"unknown scope", "billing", []string{model.ScopeCardsRead, "cards:delete"}, ErrInvalidScope},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemAPIKeyRepository()
+			issued, err := newTestAPIKeyService(repo, time.Hour).CreateKey(context.Background(), tt.keyName, tt.scopes)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CreateKey error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if len(repo.keys) != 0 {
+					t.Errorf("a rejected key was stored")
+				}
+				return
+			}
+			stored := repo.keys[issued.ID]
+			if stored == nil || stored.KeyHash != hashAPIKey(issued.Key) {
+				t.Fatalf("stored key = %+v, want the hash of the issued key", stored)
+			}
+		})
+	}
+}
+
+func TestRotateKey(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		grace       time.Duration
+		oldWorks    bool
+		revokeFirst bool
+		wantErr     error
+	}{
+		{"old key works during the grace period", time.Hour, true, false, nil},
+		{"old key stops at once without a grace period", 0, false, false, nil},
+		{"revoked key cannot be rotated", time.Hour, false, true, ErrAPIKeyRevoked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemAPIKeyRepository()
+			svc := newTestAPIKeyService(repo, tt.grace)
+
+			old, err := svc.CreateKey(ctx, "billing", []string{model.ScopeInvoicesRead})
+			if err != nil {
+				t.Fatalf("CreateKey: %v", err)
+			}
+			if tt.revokeFirst {
+				if err := svc.RevokeKey(ctx, old.ID); err != nil {
+					t.Fatalf("RevokeKey: %v", err)
+				}
+			}
+
+			rotated, err := svc.RotateKey(ctx, old.ID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RotateKey error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			if rotated.Key == old.Key || rotated.KeyHash == old.KeyHash {
+				t.Error("rotation reused the old secret")
+			}
+			if rotated.Name != old.Name || !rotated.Scopes.Allows(model.ScopeInvoicesRead) {
+				t.Errorf("rotated key = %+v, want the old name and scopes", rotated.APIKey)
+			}
+			if rotated.RotatedFrom.String != old.ID {
+				t.Errorf("RotatedFrom = %q, want %q", rotated.RotatedFrom.String, old.ID)
+			}
+
+			if _, err := svc.Authenticate(ctx, rotated.Key); err != nil {
+				t.Errorf("new key does not authenticate: %v", err)
+			}
+			_, err = svc.Authenticate(ctx, old.Key)
+			if works := err == nil; works != tt.oldWorks {
+				t.Errorf("old key authenticates = %v, want %v (err %v)", works, tt.oldWorks, err)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemAPIKeyRepository()
+	svc := newTestAPIKeyService(repo, time.Hour)
+
+	active, err := svc.CreateKey(ctx, "active", []string{model.ScopeCardsRead})
+	if err != nil {
+		t.Fatalf("CreateKey: %v", err)
+	}
+	revoked, err := svc.CreateKey(ctx, "revoked", []string{model.ScopeCardsRead})
+	if err != nil {
+		t.Fatalf("CreateKey: %v", err)
+	}
+	if err := svc.RevokeKey(ctx, revoked.ID); err != nil {
+		t.Fatalf("RevokeKey: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		wantID  string
+		wantErr error
+	}{
+		{"active key", active.Key, active.ID, nil},
+		{"revoked key", revoked.Key, "", ErrInvalidAPIKey},
+		{"unknown key", apiKeyPrefix + "unknown", "", ErrInvalidAPIKey},
+		{"missing prefix", strings.TrimPrefix(active.Key, apiKeyPrefix), "", ErrInvalidAPIKey},
+		{"hash instead of key", active.KeyHash, "", ErrInvalidAPIKey},
+	}
+
+	for _, tt := range tests {
+		got, err := svc.Authenticate(ctx, tt.key)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Authenticate error = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr == nil && got.ID != tt.wantID {
+			t.Errorf("%s: Authenticate = %s, want %s", tt.name, got.ID, tt.wantID)
+		}
+	}
+
+	// Uses within lastUsedResolution of each other are recorded once.
+	repo.touched = 0
+	repo.keys[active.ID].LastUsedAt = sql.NullTime{}
+	for i := 0; i < 3; i++ {
+		if _, err := svc.Authenticate(ctx, active.Key); err != nil {
+			t.Fatalf("Authenticate: %v", err)
+		}
+	}
+	if repo.touched != 1 {
+		t.Errorf("last use recorded %d times, want 1", repo.touched)
+	}
+}
@@ -2,20 +2,41 @@ package service
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"errors"
+	"log"
 	"regexp"
+	"sort"
 	"time"
 
+	"subscription-management/internal/apperr"
+	"subscription-management/internal/bin"
+	"subscription-management/internal/config"
 	"subscription-management/internal/model"
 	"subscription-management/internal/repository"
+	"subscription-management/internal/vault"
 )
 
 var (
-	ErrInvalidCardNumber     = errors.New("invalid card number")
-	ErrInvalidExpiryDate     = errors.New("card has expired or has an invalid expiry date")
-	ErrInvalidCardHolderName = errors.New("card holder name is required")
-	ErrCardNotFound          = errors.New("card not found")
-	ErrUnauthorized          = errors.New("unauthorized access to card")
+	ErrInvalidCardNumber      = apperr.New(apperr.Invalid, "invalid_card_number", "invalid card number")
+	ErrInvalidExpiryDate      = apperr.New(apperr.Invalid, "invalid_expiry_date", "card has expired or has an invalid expiry date")
+	ErrInvalidCardHolderName  = apperr.New(apperr.Invalid, "card_holder_name_required", "card holder name is required")
+	ErrCardNotFound           = apperr.New(apperr.NotFound, "card_not_found", "card not found")
+	ErrUnauthorized           = apperr.New(apperr.Forbidden, "forbidden", "not allowed to access this resource")
+	ErrDuplicateCard          = apperr.New(apperr.Conflict, "duplicate_card", "card already exists for this user")
+	ErrCardInUse              = apperr.New(apperr.Conflict, "card_in_use", "card is used by an active subscription; pass replacementCardId to move it to another card")
+	ErrInvalidReplacementCard = apperr.New(apperr.Invalid, "invalid_replacement_card", "replacement card must be another usable card of the same user")
+)
+
+// Orders in which a user's non-default cards are tried, set with
+// CARD_FALLBACK_ORDER. Unknown values behave like CardOrderNewest.
+const (
+	CardOrderNewest       = "newest"
+	CardOrderOldest       = "oldest"
+	CardOrderLatestExpiry = "latest_expiry"
 )
 
 type CardService interface {
@@ -23,22 +44,55 @@ type CardService interface {
 	GetCard(ctx context.Context, id, userID string) (*model.Card, error)
 	GetUserCards(ctx context.Context, userID string) ([]model.Card, error)
 	UpdateCard(ctx context.Context, card *model.Card) error
-	DeleteCard(ctx context.Context, id, userID string) error
+	DeleteCard(ctx context.Context, id, userID, replacementID string) error
 	SetDefaultCard(ctx context.Context, userID, cardID string) error
 	DeleteAllUserCards(ctx context.Context, userID string) error
+	GetSharedCards(ctx context.Context) ([]model.SharedCardFingerprint, error)
+	TokenizeLegacyCards(ctx context.Context, batchSize int) (int, error)
+	FingerprintCards(ctx context.Context, batchSize int) (int, error)
+	RefreshBINMetadata(ctx context.Context, batchSize int) (int, error)
+	GetExpiringCards(ctx context.Context, userID string, days int) ([]model.Card, error)
+	GetFallbackCards(ctx context.Context, userID string) ([]model.Card, error)
+	MatchPaymentCard(ctx context.Context, userID string, paid *model.PaymentCard) (*model.Card, error)
+	ProcessExpiringCards(ctx context.Context) error
 }
 
 type DefaultCardService struct {
-	cardRepo repository.CardRepository
+	cardRepo            repository.CardRepository
+	vault               vault.Vault
+	binTable            *bin.Table
+	notificationService NotificationService
+	outboxRepo          repository.OutboxRepository
+	transactor          repository.Transactor
+	config              config.CardConfig
 }
 
-func NewCardService(cardRepo repository.CardRepository) CardService {
+func NewCardService(
+	cardRepo repository.CardRepository,
+	vault vault.Vault,
+	binTable *bin.Table,
+	notificationService NotificationService,
+	outboxRepo repository.OutboxRepository,
+	transactor repository.Transactor,
+	config config.CardConfig,
+) CardService {
 	return &DefaultCardService{
-		cardRepo: cardRepo,
+		cardRepo:            cardRepo,
+		vault:               vault,
+		binTable:            binTable,
+		notificationService: notificationService,
+		outboxRepo:          outboxRepo,
+		transactor:          transactor,
+		config:              config,
 	}
 }
 
+// CreateCard tokenizes the card number in the vault and stores only the token,
+// BIN, fingerprint, last four digits, brand, issuer details and expiry. The full number is
+// cleared from card before it returns.
 func (s *DefaultCardService) CreateCard(ctx context.Context, card *model.Card) error {
+    card.CardNumber = normalizeCardNumber(card.CardNumber)
+    defer func() { card.CardNumber = "" }()
     
     cardLength := len(card.CardNumber)
     lastFour := ""
@@ -47,25 +101,80 @@ func (s *DefaultCardService) CreateCard(ctx context.Context, card *model.Card) e
     }
     
     
-    existingCards, err := s.cardRepo.GetByUserID(ctx, card.UserID)
+    if err := validateCard(card); err != nil {
+        return err
+    }
+    
+    fingerprint := s.fingerprint(card.CardNumber)
+    existing, err := s.cardRepo.GetByFingerprint(ctx, card.UserID, fingerprint)
     if err != nil {
         return err
     }
+    if existing != nil {
+        return ErrDuplicateCard
+    }
     
-    for _, existingCard := range existingCards {
-        if existingCard.LastFourDigits == lastFour {
-            return errors.New("card already exists for this user")
-        }
+    // A user's first card becomes the default so renewals always have a
+    // card to fall back to.
+    cards, err := s.cardRepo.GetByUserID(ctx, card.UserID)
+    if err != nil {
+        return err
     }
+    card.IsDefault = len(cards) == 0
     
+    applyBINInfo(card, s.binTable.Lookup(card.CardNumber))
+    card.LastFourDigits = lastFour
+    card.BIN = cardBIN(card.CardNumber)
+    card.Fingerprint = toNullString(fingerprint)
     
-    if err := validateCard(card); err != nil {
+    token, err := s.vault.Tokenize(ctx, card.CardNumber)
+    if err != nil {
         return err
     }
+    card.CardToken = toNullString(token)
     
-    card.CardType = determineCardType(card.CardNumber)
+    err = s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+        if err := s.cardRepo.Create(ctx, card); err != nil {
+            return err
+        }
+        return recordEvent(ctx, s.outboxRepo, model.EventCardAdded, model.AggregateCard, card.ID, card.UserID, map[string]interface{}{
+            "cardId":         card.ID,
+            "cardType":       card.CardType,
+            "fundingType":    card.FundingType,
+            "issuerCountry":  card.IssuerCountry,
+            "lastFourDigits": card.LastFourDigits,
+            "expiryMonth":    card.ExpiryMonth,
+            "expiryYear":     card.ExpiryYear,
+            "isDefault":      card.IsDefault,
+        })
+    })
+    if err != nil {
+        s.deleteToken(ctx, token)
+        return err
+    }
     
-    return s.cardRepo.Create(ctx, card)
+    s.checkSharedCard(ctx, card)
+    return nil
+}
+
+
+// checkSharedCard reports a card that is saved on suspiciously many accounts.
+// It only raises a signal; the card is still saved.
+func (s *DefaultCardService) checkSharedCard(ctx context.Context, card *model.Card) {
+	accounts, err := s.cardRepo.CountAccountsWithFingerprint(ctx, card.Fingerprint.String)
+	if err != nil {
+		log.Printf("Failed to check card %s for reuse across accounts: %v", card.ID, err)
+		return
+	}
+	if accounts >= s.config.SharedCardThreshold {
+		log.Printf("FRAUD SIGNAL: card %s (user %s, last four %s) is saved on %d accounts",
+			card.ID, card.UserID, card.LastFourDigits, accounts)
+	}
+}
+
+
+func (s *DefaultCardService) GetSharedCards(ctx context.Context) ([]model.SharedCardFingerprint, error) {
+	return s.cardRepo.GetSharedFingerprints(ctx, s.config.SharedCardThreshold)
 }
 
 func (s *DefaultCardService) GetCard(ctx context.Context, id, userID string) (*model.Card, error) {
@@ -74,7 +183,7 @@ func (s *DefaultCardService) GetCard(ctx context.Context, id, userID string) (*m
 		return nil, err
 	}
 	
-	if card == nil {
+	if card == nil || card.DeletedAt.Valid {
 		return nil, ErrCardNotFound
 	}
 	
@@ -96,9 +205,18 @@ func (s *DefaultCardService) UpdateCard(ctx context.Context, card *model.Card) e
 		return err
 	}
 	
-	card.CardNumber = existingCard.CardNumber
+	card.CardToken = existingCard.CardToken
+	card.BIN = existingCard.BIN
 	card.LastFourDigits = existingCard.LastFourDigits
 	card.CardType = existingCard.CardType
+	card.Issuer = existingCard.Issuer
+	card.IssuerCountry = existingCard.IssuerCountry
+	card.FundingType = existingCard.FundingType
+	card.IsDefault = existingCard.IsDefault
+	
+	// A new expiry date starts expiry tracking over.
+	card.IsExpired = false
+	card.ExpiryNotifiedAt = sql.NullTime{}
 	
 	if card.CardHolderName == "" {
 		return ErrInvalidCardHolderName
@@ -111,14 +229,64 @@ func (s *DefaultCardService) UpdateCard(ctx context.Context, card *model.Card) e
 	return s.cardRepo.Update(ctx, card)
 }
 
-func (s *DefaultCardService) DeleteCard(ctx context.Context, id, userID string) error {
+// DeleteCard removes a card. A card that pays for a live subscription can only
+// be removed together with a replacement card, which those subscriptions are
+// switched to in the same transaction.
+func (s *DefaultCardService) DeleteCard(ctx context.Context, id, userID, replacementID string) error {
 	
-	_, err := s.GetCard(ctx, id, userID)
+	card, err := s.GetCard(ctx, id, userID)
 	if err != nil {
 		return err
 	}
 	
-	return s.cardRepo.Delete(ctx, id)
+	if replacementID != "" {
+		replacement, err := s.GetCard(ctx, replacementID, userID)
+		if err == ErrCardNotFound || err == ErrUnauthorized {
+			return ErrInvalidReplacementCard
+		}
+		if err != nil {
+			return err
+		}
+		if replacement.ID == card.ID || !replacement.IsUsableAt(time.Now()) {
+			return ErrInvalidReplacementCard
+		}
+	}
+	
+	if err := s.cardRepo.Delete(ctx, id, replacementID); err != nil {
+		if errors.Is(err, repository.ErrCardInUse) {
+			return ErrCardInUse
+		}
+		return err
+	}
+	
+	s.deleteToken(ctx, fromNullString(card.CardToken))
+	
+	if card.IsDefault {
+		s.promoteDefault(ctx, userID)
+	}
+	return nil
+}
+
+
+// promoteDefault makes the first of the user's remaining cards in fallback
+// order the default after the default card is removed. A failure leaves the
+// user without a default, which they can fix themselves, so it is logged.
+func (s *DefaultCardService) promoteDefault(ctx context.Context, userID string) {
+	cards, err := s.cardRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to load cards to promote a new default for user %s: %v", userID, err)
+		return
+	}
+	if len(cards) == 0 {
+		return
+	}
+	
+	s.sortFallbackCards(cards, time.Now())
+	if err := s.cardRepo.SetDefault(ctx, userID, cards[0].ID); err != nil {
+		log.Printf("Failed to promote card %s to default for user %s: %v", cards[0].ID, userID, err)
+		return
+	}
+	log.Printf("Card %s is now the default card of user %s", cards[0].ID, userID)
 }
 
 
@@ -202,30 +370,340 @@ func isValidExpiryDate(month, year int) bool {
 	return true
 }
 
-func determineCardType(number string) string {
-	re := regexp.MustCompile(`[\s-]`)
-	number = re.ReplaceAllString(number, "")
+func applyBINInfo(card *model.Card, info bin.Info) {
+	card.CardType = info.Brand
+	card.Issuer = info.Issuer
+	card.IssuerCountry = info.Country
+	card.FundingType = info.Funding
+}
+
+
+func (s *DefaultCardService) DeleteAllUserCards(ctx context.Context, userID string) error {
+    cards, err := s.cardRepo.GetByUserID(ctx, userID)
+    if err != nil {
+        return err
+    }
+    
+    if err := s.cardRepo.DeleteByUserID(ctx, userID); err != nil {
+        if errors.Is(err, repository.ErrCardInUse) {
+            return ErrCardInUse
+        }
+        return err
+    }
+    
+    for _, card := range cards {
+        s.deleteToken(ctx, fromNullString(card.CardToken))
+    }
+    return nil
+}
+
 
-	if matched, _ := regexp.MatchString(`^4\d{12}(\d{3})?$`, number); matched {
-		return "VISA"
+// TokenizeLegacyCards moves card numbers saved before tokenization into the
+// vault, one batch at a time, and returns how many cards were converted.
+func (s *DefaultCardService) TokenizeLegacyCards(ctx context.Context, batchSize int) (int, error) {
+	converted := 0
+	for {
+		cards, err := s.cardRepo.GetUntokenized(ctx, batchSize)
+		if err != nil {
+			return converted, err
+		}
+		if len(cards) == 0 {
+			return converted, nil
+		}
+
+		for _, card := range cards {
+			number := normalizeCardNumber(card.LegacyCardNumber.String)
+
+			token, err := s.vault.Tokenize(ctx, number)
+			if err != nil {
+				return converted, err
+			}
+
+			if err := s.cardRepo.SetToken(ctx, card.ID, token, cardBIN(number), s.fingerprint(number)); err != nil {
+				s.deleteToken(ctx, token)
+				return converted, err
+			}
+			converted++
+		}
 	}
+}
+
+
+// FingerprintCards fingerprints tokenized cards saved before fingerprinting.
+// A card whose fingerprint matches another card of the same user cannot be
+// stored under the unique key; it is logged and left for manual review.
+func (s *DefaultCardService) FingerprintCards(ctx context.Context, batchSize int) (int, error) {
+	fingerprinted := 0
+	afterID := ""
+	for {
+		cards, err := s.cardRepo.GetUnfingerprinted(ctx, afterID, batchSize)
+		if err != nil {
+			return fingerprinted, err
+		}
+		if len(cards) == 0 {
+			return fingerprinted, nil
+		}
 
-	if matched, _ := regexp.MatchString(`^5[1-5]\d{14}$`, number); matched {
-		return "MASTERCARD"
+		for _, card := range cards {
+			afterID = card.ID
+
+			number, err := s.vault.Detokenize(ctx, card.CardToken.String)
+			if err != nil {
+				return fingerprinted, err
+			}
+
+			fingerprint := s.fingerprint(number)
+			duplicate, err := s.cardRepo.GetByFingerprint(ctx, card.UserID, fingerprint)
+			if err != nil {
+				return fingerprinted, err
+			}
+			if duplicate != nil {
+				log.Printf("Card %s duplicates card %s of user %s, leaving it unfingerprinted", card.ID, duplicate.ID, card.UserID)
+				continue
+			}
+
+			if err := s.cardRepo.SetFingerprint(ctx, card.ID, fingerprint); err != nil {
+				return fingerprinted, err
+			}
+			fingerprinted++
+		}
 	}
+}
+
 
-	if matched, _ := regexp.MatchString(`^3[47]\d{13}$`, number); matched {
-		return "AMEX"
+// RefreshBINMetadata re-derives brand, issuer, country and funding type of
+// every card from its stored BIN, for cards saved before the BIN table existed
+// or after the table has been updated.
+func (s *DefaultCardService) RefreshBINMetadata(ctx context.Context, batchSize int) (int, error) {
+	updated := 0
+	afterID := ""
+	for {
+		cards, err := s.cardRepo.GetWithBIN(ctx, afterID, batchSize)
+		if err != nil {
+			return updated, err
+		}
+		if len(cards) == 0 {
+			return updated, nil
+		}
+
+		for i := range cards {
+			card := &cards[i]
+			afterID = card.ID
+
+			info := s.binTable.Lookup(card.BIN)
+			if info.Brand == card.CardType && info.Issuer == card.Issuer &&
+				info.Country == card.IssuerCountry && info.Funding == card.FundingType {
+				continue
+			}
+
+			applyBINInfo(card, info)
+			if err := s.cardRepo.UpdateBINMetadata(ctx, card); err != nil {
+				return updated, err
+			}
+			updated++
+		}
 	}
+}
 
-	if matched, _ := regexp.MatchString(`^6(?:011|5\d{2})\d{12}$`, number); matched {
-		return "DISCOVER"
+
+// GetExpiringCards returns the user's cards that expire within days, including
+// cards that have already expired. days <= 0 uses the configured notice period.
+func (s *DefaultCardService) GetExpiringCards(ctx context.Context, userID string, days int) ([]model.Card, error) {
+	if days <= 0 {
+		days = s.config.ExpiryNoticeDays
 	}
+	return s.cardRepo.GetExpiringByUserID(ctx, userID, monthIndex(time.Now().AddDate(0, 0, days)))
+}
 
-	return "UNKNOWN"
+
+// GetFallbackCards returns the user's cards that can still be charged, in the
+// order a failed renewal tries them: the default card, then the others in the
+// configured fallback order.
+func (s *DefaultCardService) GetFallbackCards(ctx context.Context, userID string) ([]model.Card, error) {
+	cards, err := s.cardRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	
+	now := time.Now()
+	s.sortFallbackCards(cards, now)
+	
+	usable := make([]model.Card, 0, len(cards))
+	for _, card := range cards {
+		if card.IsUsableAt(now) {
+			usable = append(usable, card)
+		}
+	}
+	return usable, nil
 }
 
 
-func (s *DefaultCardService) DeleteAllUserCards(ctx context.Context, userID string) error {
-    return s.cardRepo.DeleteByUserID(ctx, userID)
+// MatchPaymentCard returns the saved card a Razorpay payment was made with, or
+// nil when it cannot be told apart. A card is found by the token Razorpay saved
+// it under, or else by its last four digits if exactly one of the user's cards
+// has them; that card then keeps the token so later retries can charge it.
+func (s *DefaultCardService) MatchPaymentCard(ctx context.Context, userID string, paid *model.PaymentCard) (*model.Card, error) {
+	if paid == nil {
+		return nil, nil
+	}
+
+	if paid.TokenID != "" {
+		card, err := s.cardRepo.GetByRazorpayToken(ctx, userID, paid.TokenID)
+		if err != nil || card != nil {
+			return card, err
+		}
+	}
+	if paid.LastFour == "" {
+		return nil, nil
+	}
+
+	cards, err := s.cardRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var match *model.Card
+	for i := range cards {
+		if cards[i].LastFourDigits != paid.LastFour {
+			continue
+		}
+		if match != nil {
+			log.Printf("Several cards of user %s end in %s, not matching the payment to one", userID, paid.LastFour)
+			return nil, nil
+		}
+		match = &cards[i]
+	}
+	if match == nil {
+		return nil, nil
+	}
+
+	if paid.TokenID != "" && match.RazorpayTokenID.String != paid.TokenID {
+		if err := s.cardRepo.SetRazorpayToken(ctx, match.ID, paid.TokenID); err != nil {
+			return nil, err
+		}
+		match.RazorpayTokenID = sql.NullString{String: paid.TokenID, Valid: true}
+		log.Printf("Card %s saved under Razorpay token %s", match.ID, paid.TokenID)
+	}
+	return match, nil
+}
+
+
+// sortFallbackCards puts the default card first and unusable cards last, and
+// orders the rest by the configured fallback order.
+func (s *DefaultCardService) sortFallbackCards(cards []model.Card, now time.Time) {
+	sort.SliceStable(cards, func(i, j int) bool {
+		a, b := &cards[i], &cards[j]
+		if a.IsDefault != b.IsDefault {
+			return a.IsDefault
+		}
+		if a.IsUsableAt(now) != b.IsUsableAt(now) {
+			return a.IsUsableAt(now)
+		}
+		switch s.config.FallbackOrder {
+		case CardOrderOldest:
+			return a.CreatedAt.Before(b.CreatedAt)
+		case CardOrderLatestExpiry:
+			return a.ExpiresAt().After(b.ExpiresAt())
+		default:
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+	})
+}
+
+
+// ProcessExpiringCards is the daily expiry job. It flags expired cards as
+// unusable and asks owners of cards that pay for an auto-renewing
+// subscription to update them before they lapse. Each card is announced once
+// per expiry date.
+func (s *DefaultCardService) ProcessExpiringCards(ctx context.Context) error {
+	now := time.Now()
+
+	expired, err := s.cardRepo.MarkExpired(ctx, monthIndex(now))
+	if err != nil {
+		return err
+	}
+	if expired > 0 {
+		log.Printf("Flagged %d expired cards", expired)
+	}
+
+	cards, err := s.cardRepo.GetExpiringWithAutoRenewal(ctx, monthIndex(now.AddDate(0, 0, s.config.ExpiryNoticeDays)))
+	if err != nil {
+		return err
+	}
+
+	for _, card := range cards {
+		data := map[string]interface{}{
+			"cardId":         card.ID,
+			"cardType":       card.CardType,
+			"lastFourDigits": card.LastFourDigits,
+			"expiryMonth":    card.ExpiryMonth,
+			"expiryYear":     card.ExpiryYear,
+			"expiresAt":      card.ExpiresAt(),
+		}
+		err := s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+			if err := s.cardRepo.SetExpiryNotified(ctx, card.ID, now); err != nil {
+				return err
+			}
+			return recordEvent(ctx, s.outboxRepo, model.EventCardExpiring, model.AggregateCard, card.ID, card.UserID, data)
+		})
+		if err != nil {
+			return err
+		}
+
+		// Sent only once the card is marked, so a failed commit cannot lead to
+		// the same notice again on the next run.
+		if err := s.notificationService.Notify(ctx, card.UserID, NotificationCardExpiring, data); err != nil {
+			log.Printf("Failed to notify user %s about expiring card %s: %v", card.UserID, card.ID, err)
+		}
+	}
+
+	return nil
+}
+
+
+// monthIndex numbers months consecutively so they compare as integers, the
+// same way the card expiry queries do.
+func monthIndex(t time.Time) int {
+	return t.Year()*12 + int(t.Month())
+}
+
+
+// fingerprint is a keyed HMAC of the card number. It identifies the same card
+// across rows and accounts without being reversible by anyone who lacks the
+// key, unlike a plain hash of the small PAN space.
+func (s *DefaultCardService) fingerprint(number string) string {
+	mac := hmac.New(sha256.New, []byte(s.config.FingerprintKey))
+	mac.Write([]byte(number))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+
+// deleteToken removes a vault entry that no card references any more. A
+// failure only leaves an orphaned, still-encrypted entry, so it is logged.
+func (s *DefaultCardService) deleteToken(ctx context.Context, token string) {
+	if token == "" {
+		return
+	}
+	if err := s.vault.Delete(ctx, token); err != nil {
+		log.Printf("Failed to delete vault token for card: %v", err)
+	}
+}
+
+
+func normalizeCardNumber(number string) string {
+	return regexp.MustCompile(`[\s-]`).ReplaceAllString(number, "")
+}
+
+
+// cardBIN returns the issuer identification number: the first eight digits of
+// a 16-digit or longer card, the first six otherwise.
+func cardBIN(number string) string {
+	length := 6
+	if len(number) >= 16 {
+		length = 8
+	}
+	if len(number) < length {
+		return ""
+	}
+	return number[:length]
 }
\ No newline at end of file
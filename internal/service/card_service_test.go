@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"subscription-management/internal/bin"
+	"subscription-management/internal/config"
+	"subscription-management/internal/model"
+	"subscription-management/internal/repository"
+)
+
+// memCardRepository keeps cards in memory. Only the methods CreateCard uses
+// are implemented; the embedded interface panics on any other.
+type memCardRepository struct {
+	repository.CardRepository
+	cards []model.Card
+}
+
+func (r *memCardRepository) Create(ctx context.Context, card *model.Card) error {
+	if card.ID == "" {
+		card.ID = uuid.New().String()
+	}
+	r.cards = append(r.cards, *card)
+	return nil
+}
+
+func (r *memCardRepository) GetByUserID(ctx context.Context, userID string) ([]model.Card, error) {
+	var cards []model.Card
+	for _, card := range r.cards {
+		if card.UserID == userID && !card.DeletedAt.Valid {
+			cards = append(cards, card)
+		}
+	}
+	return cards, nil
+}
+
+func (r *memCardRepository) GetByFingerprint(ctx context.Context, userID string, fingerprint string) (*model.Card, error) {
+	for _, card := range r.cards {
+		if card.UserID == userID && card.Fingerprint.String == fingerprint && !card.DeletedAt.Valid {
+			found := card
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memCardRepository) CountAccountsWithFingerprint(ctx context.Context, fingerprint string) (int, error) {
+	users := map[string]bool{}
+	for _, card := range r.cards {
+		if card.Fingerprint.String == fingerprint {
+			users[card.UserID] = true
+		}
+	}
+	return len(users), nil
+}
+
+type memVault struct {
+	pans map[string]string
+}
+
+func (v *memVault) Tokenize(ctx context.Context, pan string) (string, error) {
+	token := "vt_" + uuid.New().String()
+	v.pans[token] = pan
+	return token, nil
+}
+
+func (v *memVault) Detokenize(ctx context.Context, token string) (string, error) {
+	return v.pans[token], nil
+}
+
+func (v *memVault) Delete(ctx context.Context, token string) error {
+	delete(v.pans, token)
+	return nil
+}
+
+// memOutboxRepository collects recorded events. Only Add is implemented.
+type memOutboxRepository struct {
+	repository.OutboxRepository
+	events []model.OutboxEvent
+}
+
+func (r *memOutboxRepository) Add(ctx context.Context, event *model.OutboxEvent) error {
+	r.events = append(r.events, *event)
+	return nil
+}
+
+// inlineTransactor runs units of work without a database.
+type inlineTransactor struct{}
+
+func (inlineTransactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func newTestCardService(repo *memCardRepository, key string) *DefaultCardService {
+	return NewCardService(
+		repo,
+		&memVault{pans: map[string]string{}},
+		bin.NewTable(),
+		&LogNotificationService{},
+		&memOutboxRepository{},
+		inlineTransactor{},
+		config.CardConfig{FingerprintKey: key, SharedCardThreshold: 3},
+	).(*DefaultCardService)
+}
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		key    string
+		number string
+		want   string
+	}{
+		{"test-key", "4111111111111111", "b9a296a413d12fc678c4027233b1926dccb9bc80f18f07061a9f429d8d8a09e7"},
+		{"other-key", "4111111111111111", "4a53e2e6009886f599db702cc8d0d9de66d786b9ae4a31070184ae2e2fe4e778"},
+	}
+
+	for _, tt := range tests {
+		s := newTestCardService(&memCardRepository{}, tt.key)
+		got := s.fingerprint(tt.number)
+		if got != tt.want {
+			t.Errorf("fingerprint(%q) with key %q = %s, want %s", tt.number, tt.key, got, tt.want)
+		}
+
+		plain := sha256.Sum256([]byte(tt.number))
+		if got == hex.EncodeToString(plain[:]) {
+			t.Errorf("fingerprint(%q) is an unkeyed hash", tt.number)
+		}
+	}
+}
+
+func TestNormalizeCardNumber(t *testing.T) {
+	tests := []struct {
+		number string
+		want   string
+	}{
+		{"4111111111111111", "4111111111111111"},
+		{"4111 1111 1111 1111", "4111111111111111"},
+		{"4111-1111-1111-1111", "4111111111111111"},
+		{" 4111-1111 1111\t1111 ", "4111111111111111"},
+	}
+
+	s := newTestCardService(&memCardRepository{}, "test-key")
+	want := s.fingerprint("4111111111111111")
+	for _, tt := range tests {
+		got := normalizeCardNumber(tt.number)
+		if got != tt.want {
+			t.Errorf("normalizeCardNumber(%q) = %q, want %q", tt.number, got, tt.want)
+		}
+		if s.fingerprint(got) != want {
+			t.Errorf("%q does not fingerprint like the plain number", tt.number)
+		}
+	}
+}
+
+func TestCreateCardDetectsDuplicates(t *testing.T) {
+	expiryYear := time.Now().Year() + 2
+
+	tests := []struct {
+		name    string
+		userID  string
+		number  string
+		deleted bool
+		wantErr error
+	}{
+		{"same card, same user", "user-1", "4111111111111111", false, ErrDuplicateCard},
+		{"same card formatted differently", "user-1", "4111 1111-1111 1111", false, ErrDuplicateCard},
+		{"same card on another account", "user-2", "4111111111111111", false, nil},
+		{"different card, same user", "user-1", "5500005555555559", false, nil},
+		{"same card after the first was removed", "user-1", "4111111111111111", true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &memCardRepository{}
+			s := newTestCardService(repo, "test-key")
+			ctx := context.Background()
+
+			first := &model.Card{UserID: "user-1", CardNumber: "4111111111111111", CardHolderName: "Asha Rao", ExpiryMonth: 12, ExpiryYear: expiryYear}
+			if err := s.CreateCard(ctx, first); err != nil {
+				t.Fatalf("CreateCard: %v", err)
+			}
+			if tt.deleted {
+				repo.cards[0].DeletedAt.Valid = true
+			}
+
+			second := &model.Card{UserID: tt.userID, CardNumber: tt.number, CardHolderName: "Asha Rao", ExpiryMonth: 12, ExpiryYear: expiryYear}
+			err := s.CreateCard(ctx, second)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CreateCard error = %v, want %v", err, tt.wantErr)
+			}
+			if second.CardNumber != "" {
+				t.Error("CreateCard left the card number on the card")
+			}
+
+			for _, card := range repo.cards {
+				if !card.CardToken.Valid || card.LegacyCardNumber.Valid {
+					t.Errorf("card %s was stored without a vault token", card.ID)
+				}
+				if card.Fingerprint.String != s.fingerprint(normalizeCardNumber(tt.number)) && card.Fingerprint.String != s.fingerprint("4111111111111111") {
+					t.Errorf("card %s was stored with fingerprint %q", card.ID, card.Fingerprint.String)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"subscription-management/internal/apperr"
+	"subscription-management/internal/model"
+	"subscription-management/internal/money"
+	"subscription-management/internal/repository"
+)
+
+var (
+	ErrCustomerNotFound             = apperr.New(apperr.NotFound, "customer_not_found", "customer not found")
+	ErrCustomerEmailRequired        = apperr.New(apperr.Invalid, "customer_email_required", "customer email is required")
+	ErrCustomerCurrencyNotSupported = apperr.New(apperr.Invalid, "customer_currency_not_supported", "customer currency is not a supported ISO 4217 code")
+)
+
+type CustomerService interface {
+	GetCustomer(ctx context.Context, id string) (*model.UserInfo, error)
+	UpdateCustomer(ctx context.Context, customer *model.UserInfo) (*model.UserInfo, error)
+	ResolveCustomer(ctx context.Context, details *model.UserInfo) (*model.UserInfo, error)
+}
+
+type DefaultCustomerService struct {
+	customerRepo repository.CustomerRepository
+}
+
+func NewCustomerService(customerRepo repository.CustomerRepository) CustomerService {
+	return &DefaultCustomerService{
+		customerRepo: customerRepo,
+	}
+}
+
+func (s *DefaultCustomerService) GetCustomer(ctx context.Context, id string) (*model.UserInfo, error) {
+	customer, err := s.customerRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if customer == nil {
+		return nil, ErrCustomerNotFound
+	}
+
+	return customer, nil
+}
+
+// UpdateCustomer replaces the customer's profile, creating it if needed. The
+// Razorpay customer ID is kept as is.
+func (s *DefaultCustomerService) UpdateCustomer(ctx context.Context, customer *model.UserInfo) (*model.UserInfo, error) {
+	customer.Email = strings.TrimSpace(customer.Email)
+	if customer.Email == "" {
+		return nil, ErrCustomerEmailRequired
+	}
+	currency, err := customerCurrency(customer.Currency)
+	if err != nil {
+		return nil, err
+	}
+	customer.Currency = currency
+
+	existing, err := s.customerRepo.GetByID(ctx, customer.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		customer.RazorpayCustomerID = existing.RazorpayCustomerID
+		customer.CreatedAt = existing.CreatedAt
+	}
+
+	if err := s.customerRepo.Save(ctx, customer); err != nil {
+		return nil, err
+	}
+
+	return customer, nil
+}
+
+// ResolveCustomer returns the stored profile for details.ID, updated with any
+// non-empty details supplied by the caller, and persists the result.
+func (s *DefaultCustomerService) ResolveCustomer(ctx context.Context, details *model.UserInfo) (*model.UserInfo, error) {
+	customer, err := s.customerRepo.GetByID(ctx, details.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := customer == nil
+	if customer == nil {
+		customer = &model.UserInfo{ID: details.ID}
+	}
+
+	merge := func(field *string, value string) {
+		value = strings.TrimSpace(value)
+		if value != "" && value != *field {
+			*field = value
+			changed = true
+		}
+	}
+	merge(&customer.Name, details.Name)
+	merge(&customer.Email, details.Email)
+	merge(&customer.Phone, details.Phone)
+	currency, err := customerCurrency(details.Currency)
+	if err != nil {
+		return nil, err
+	}
+	merge(&customer.Currency, currency)
+
+	if changed {
+		if err := s.customerRepo.Save(ctx, customer); err != nil {
+			return nil, err
+		}
+	}
+
+	return customer, nil
+}
+
+// customerCurrency normalizes a customer's preferred currency, which may be
+// left empty, and rejects one no amount can be kept in.
+func customerCurrency(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency != "" && !money.Supported(currency) {
+		return "", ErrCustomerCurrencyNotSupported
+	}
+	return currency, nil
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCustomerCurrency(t *testing.T) {
+	tests := []struct {
+		currency string
+		want     string
+		wantErr  error
+	}{
+		{"", "", nil},
+		{"INR", "INR", nil},
+		{" usd ", "USD", nil},
+		{"jpy", "JPY", nil},
+		{"XYZ", "", ErrCustomerCurrencyNotSupported},
+		{"KWD", "", ErrCustomerCurrencyNotSupported},
+		{"rupees", "", ErrCustomerCurrencyNotSupported},
+	}
+
+	for _, tt := range tests {
+		got, err := customerCurrency(tt.currency)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("customerCurrency(%q) = %q, %v; want %q, %v", tt.currency, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,613 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"subscription-management/internal/config"
+	"subscription-management/internal/model"
+	"subscription-management/internal/razorpay"
+	"subscription-management/internal/repository"
+)
+
+type DunningService interface {
+	RecordPaymentFailure(ctx context.Context, subscription *model.SubscriptionTransaction, paymentID string, reason string) error
+	RecordPaymentRecovered(ctx context.Context, subscription *model.SubscriptionTransaction, paymentID string, paidCard *model.PaymentCard) error
+	ProcessDueRetries(ctx context.Context) error
+	GetPaymentAttempts(ctx context.Context, subscriptionID string, userID string) ([]model.PaymentAttempt, error)
+}
+
+type DefaultDunningService struct {
+	subscriptionRepo repository.SubscriptionRepository
+	attemptRepo      repository.PaymentAttemptRepository
+	cardService      CardService
+	customerRepo     repository.CustomerRepository
+	razorpayClient   *razorpay.Client
+	notifier         NotificationService
+	outboxRepo       repository.OutboxRepository
+	transactor       repository.Transactor
+	config           config.DunningConfig
+}
+
+func NewDunningService(
+	subscriptionRepo repository.SubscriptionRepository,
+	attemptRepo repository.PaymentAttemptRepository,
+	cardService CardService,
+	customerRepo repository.CustomerRepository,
+	razorpayClient *razorpay.Client,
+	notifier NotificationService,
+	outboxRepo repository.OutboxRepository,
+	transactor repository.Transactor,
+	config config.DunningConfig,
+) DunningService {
+	return &DefaultDunningService{
+		subscriptionRepo: subscriptionRepo,
+		attemptRepo:      attemptRepo,
+		cardService:      cardService,
+		customerRepo:     customerRepo,
+		razorpayClient:   razorpayClient,
+		notifier:         notifier,
+		outboxRepo:       outboxRepo,
+		transactor:       transactor,
+		config:           config,
+	}
+}
+
+func (s *DefaultDunningService) RecordPaymentFailure(
+	ctx context.Context,
+	subscription *model.SubscriptionTransaction,
+	paymentID string,
+	reason string,
+) error {
+	now := time.Now()
+
+	if subscription.Status != model.SubscriptionStatusActive && subscription.Status != model.SubscriptionStatusPastDue {
+		log.Printf("Ignoring payment failure for subscription %s in status %s", subscription.ID, subscription.Status)
+		return nil
+	}
+
+	// Dunning only gives grace to renewals of a subscription that was paid
+	// before. A failed first payment leaves the subscription waiting for its
+	// order to be paid, without a grace period or retries.
+	if !paidBefore(subscription) {
+		return s.recordInitialPaymentFailure(ctx, subscription, paymentID, reason)
+	}
+
+	var attempt *model.PaymentAttempt
+	attemptNumber := 1
+
+	if subscription.Status == model.SubscriptionStatusPastDue {
+		latest, err := s.attemptRepo.GetLatestBySubscriptionID(ctx, subscription.ID)
+		if err != nil {
+			return err
+		}
+		if latest != nil && latest.Status == model.PaymentAttemptStatusPending {
+			attempt = latest
+			attemptNumber = latest.AttemptNumber
+		} else if latest != nil {
+			attemptNumber = latest.AttemptNumber + 1
+		}
+	}
+
+	if attempt == nil {
+		attempt = &model.PaymentAttempt{
+			ID:             uuid.New().String(),
+			SubscriptionID: subscription.ID,
+			UserID:         subscription.UserID,
+			CardID:         subscription.CardID,
+			AttemptNumber:  attemptNumber,
+		}
+	}
+
+	attempt.Status = model.PaymentAttemptStatusFailed
+	attempt.FailureReason = toNullString(reason)
+	if paymentID != "" {
+		attempt.RazorpayPaymentID = toNullString(paymentID)
+	}
+
+	// Retry days count from the first failure, which opened the grace period,
+	// so the whole schedule fits inside it.
+	dunningStartedAt := now
+	if subscription.Status == model.SubscriptionStatusPastDue && subscription.GracePeriodEndsAt.Valid {
+		dunningStartedAt = subscription.GracePeriodEndsAt.Time.AddDate(0, 0, -s.config.GracePeriodDays)
+	}
+
+	finalAttempt := attemptNumber > len(s.config.RetryScheduleDays)
+	nextRetryAt := now.AddDate(0, 0, 1)
+	if !finalAttempt {
+		nextRetryAt = dunningStartedAt.AddDate(0, 0, s.config.RetryScheduleDays[attemptNumber-1])
+		if nextRetryAt.Before(now) {
+			nextRetryAt = now
+		}
+	} else {
+		// Past the schedule, keep retrying a day apart while the user has a
+		// card that has not failed yet. The grace period still bounds this.
+		untried, err := s.untriedCard(ctx, subscription, attempt.CardID)
+		if err != nil {
+			return err
+		}
+		if untried != nil {
+			log.Printf("Retry schedule exhausted for subscription %s, card %s not tried yet",
+				subscription.ID, untried.ID)
+			finalAttempt = false
+		}
+	}
+	if !finalAttempt {
+		attempt.NextRetryAt = sql.NullTime{Time: nextRetryAt, Valid: true}
+	} else {
+		attempt.NextRetryAt = sql.NullTime{}
+	}
+
+	// The attempt, the move to past_due and the event are saved together so a
+	// failure is never half recorded.
+	movedToPastDue := !finalAttempt && subscription.Status != model.SubscriptionStatusPastDue
+	err := s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		if attempt.CreatedAt.IsZero() {
+			if err := s.attemptRepo.Create(ctx, attempt); err != nil {
+				return err
+			}
+		} else if err := s.attemptRepo.Update(ctx, attempt); err != nil {
+			return err
+		}
+
+		if movedToPastDue {
+			subscription.Status = model.SubscriptionStatusPastDue
+			subscription.GracePeriodEndsAt = sql.NullTime{
+				Time:  now.AddDate(0, 0, s.config.GracePeriodDays),
+				Valid: true,
+			}
+			if err := s.subscriptionRepo.UpdateSubscription(ctx, subscription); err != nil {
+				return err
+			}
+		}
+
+		data := map[string]interface{}{
+			"subscriptionId": subscription.ID,
+			"cardId":         attempt.CardID,
+			"attemptNumber":  attempt.AttemptNumber,
+			"reason":         reason,
+			"paymentId":      paymentID,
+			"final":          finalAttempt,
+		}
+		if attempt.NextRetryAt.Valid {
+			data["nextRetryAt"] = attempt.NextRetryAt.Time
+		}
+		return recordEvent(ctx, s.outboxRepo, model.EventPaymentFailed, model.AggregateSubscription, subscription.ID, subscription.UserID, data)
+	})
+	if err != nil {
+		return err
+	}
+
+	if finalAttempt {
+		log.Printf("Final payment attempt %d failed for subscription %s", attemptNumber, subscription.ID)
+		return s.cancelForNonPayment(ctx, subscription)
+	}
+
+	if movedToPastDue {
+		log.Printf("Subscription %s moved to past_due, grace period ends %s",
+			subscription.ID, subscription.GracePeriodEndsAt.Time)
+	}
+
+	return s.notifier.Notify(ctx, subscription.UserID, NotificationPaymentFailed, map[string]interface{}{
+		"subscriptionId":    subscription.ID,
+		"attemptNumber":     attemptNumber,
+		"reason":            reason,
+		"nextRetryAt":       attempt.NextRetryAt.Time,
+		"gracePeriodEndsAt": subscription.GracePeriodEndsAt.Time,
+	})
+}
+
+// paidBefore reports whether subscription has had a payment captured, itself
+// or, for a renewal, the subscription it renews.
+func paidBefore(subscription *model.SubscriptionTransaction) bool {
+	return subscription.IsRenewal || subscription.RazorpayPaymentID.Valid
+}
+
+// recordInitialPaymentFailure records a failed first payment as a failed
+// attempt. The subscription itself is left pending its payment.
+func (s *DefaultDunningService) recordInitialPaymentFailure(
+	ctx context.Context,
+	subscription *model.SubscriptionTransaction,
+	paymentID string,
+	reason string,
+) error {
+	latest, err := s.attemptRepo.GetLatestBySubscriptionID(ctx, subscription.ID)
+	if err != nil {
+		return err
+	}
+	attemptNumber := 1
+	if latest != nil {
+		attemptNumber = latest.AttemptNumber + 1
+	}
+
+	attempt := &model.PaymentAttempt{
+		ID:             uuid.New().String(),
+		SubscriptionID: subscription.ID,
+		UserID:         subscription.UserID,
+		CardID:         subscription.CardID,
+		AttemptNumber:  attemptNumber,
+		Status:         model.PaymentAttemptStatusFailed,
+		FailureReason:  toNullString(reason),
+	}
+	if paymentID != "" {
+		attempt.RazorpayPaymentID = toNullString(paymentID)
+	}
+
+	err = s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.attemptRepo.Create(ctx, attempt); err != nil {
+			return err
+		}
+		return recordEvent(ctx, s.outboxRepo, model.EventPaymentFailed, model.AggregateSubscription, subscription.ID, subscription.UserID, map[string]interface{}{
+			"subscriptionId": subscription.ID,
+			"cardId":         attempt.CardID,
+			"attemptNumber":  attempt.AttemptNumber,
+			"reason":         reason,
+			"paymentId":      paymentID,
+			"final":          false,
+			"initial":        true,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("First payment of subscription %s failed, leaving it pending payment", subscription.ID)
+	return s.notifier.Notify(ctx, subscription.UserID, NotificationPaymentFailed, map[string]interface{}{
+		"subscriptionId": subscription.ID,
+		"attemptNumber":  attemptNumber,
+		"reason":         reason,
+	})
+}
+
+func (s *DefaultDunningService) RecordPaymentRecovered(
+	ctx context.Context,
+	subscription *model.SubscriptionTransaction,
+	paymentID string,
+	paidCard *model.PaymentCard,
+) error {
+	// Every captured payment teaches us which saved card it was made with, so
+	// that card can be charged by later retries.
+	card, err := s.cardService.MatchPaymentCard(ctx, subscription.UserID, paidCard)
+	if err != nil {
+		log.Printf("Failed to match payment %s to a saved card: %v", paymentID, err)
+		card = nil
+	}
+
+	if subscription.Status != model.SubscriptionStatusPastDue {
+		return nil
+	}
+
+	// The attempt, the card and the status change are saved together so a
+	// recovery is never half recorded.
+	err = s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		latest, err := s.attemptRepo.GetLatestBySubscriptionID(ctx, subscription.ID)
+		if err != nil {
+			return err
+		}
+
+		if latest != nil && latest.Status == model.PaymentAttemptStatusPending {
+			latest.Status = model.PaymentAttemptStatusSucceeded
+			latest.RazorpayPaymentID = toNullString(paymentID)
+			latest.NextRetryAt = sql.NullTime{}
+			if card != nil {
+				latest.CardID = card.ID
+			}
+			if err := s.attemptRepo.Update(ctx, latest); err != nil {
+				return err
+			}
+		} else {
+			attemptNumber := 1
+			if latest != nil {
+				attemptNumber = latest.AttemptNumber + 1
+				if latest.NextRetryAt.Valid {
+					latest.NextRetryAt = sql.NullTime{}
+					if err := s.attemptRepo.Update(ctx, latest); err != nil {
+						return err
+					}
+				}
+			}
+			attempt := &model.PaymentAttempt{
+				SubscriptionID:    subscription.ID,
+				UserID:            subscription.UserID,
+				CardID:            subscription.CardID,
+				AttemptNumber:     attemptNumber,
+				Status:            model.PaymentAttemptStatusSucceeded,
+				RazorpayPaymentID: toNullString(paymentID),
+			}
+			if card != nil {
+				attempt.CardID = card.ID
+			}
+			if err := s.attemptRepo.Create(ctx, attempt); err != nil {
+				return err
+			}
+		}
+
+		// A recovery paid with another saved card moves the subscription to
+		// that card for future renewals. A payment that cannot be matched to
+		// a saved card leaves the card unchanged.
+		if card != nil && card.ID != subscription.CardID {
+			if err := s.subscriptionRepo.SetCard(ctx, subscription.ID, card.ID); err != nil {
+				log.Printf("Failed to move subscription %s to card %s: %v", subscription.ID, card.ID, err)
+			} else {
+				log.Printf("Subscription %s moved to card %s, which paid the recovery", subscription.ID, card.ID)
+				subscription.CardID = card.ID
+			}
+		}
+
+		subscription.Status = model.SubscriptionStatusActive
+		subscription.GracePeriodEndsAt = sql.NullTime{}
+		return s.subscriptionRepo.UpdateSubscription(ctx, subscription)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Subscription %s recovered from past_due", subscription.ID)
+	return s.notifier.Notify(ctx, subscription.UserID, NotificationPaymentRecovered, map[string]interface{}{
+		"subscriptionId": subscription.ID,
+	})
+}
+
+func (s *DefaultDunningService) ProcessDueRetries(ctx context.Context) error {
+	subscriptions, err := s.subscriptionRepo.GetSubscriptionsByStatus(ctx, model.SubscriptionStatusPastDue)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for i := range subscriptions {
+		subscription := &subscriptions[i]
+
+		if subscription.GracePeriodEndsAt.Valid && now.After(subscription.GracePeriodEndsAt.Time) {
+			log.Printf("Grace period expired for subscription %s", subscription.ID)
+			if err := s.cancelForNonPayment(ctx, subscription); err != nil {
+				log.Printf("Failed to cancel subscription %s after grace period: %v", subscription.ID, err)
+			}
+			continue
+		}
+
+		latest, err := s.attemptRepo.GetLatestBySubscriptionID(ctx, subscription.ID)
+		if err != nil {
+			log.Printf("Failed to load payment attempts for subscription %s: %v", subscription.ID, err)
+			continue
+		}
+		if latest == nil || !latest.NextRetryAt.Valid || latest.NextRetryAt.Time.After(now) {
+			continue
+		}
+
+		if err := s.retryPayment(ctx, subscription, latest); err != nil {
+			log.Printf("Failed to retry payment for subscription %s: %v", subscription.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *DefaultDunningService) retryPayment(
+	ctx context.Context,
+	subscription *model.SubscriptionTransaction,
+	latest *model.PaymentAttempt,
+) error {
+	latest.NextRetryAt = sql.NullTime{}
+	if err := s.attemptRepo.Update(ctx, latest); err != nil {
+		return err
+	}
+
+	// Razorpay retries subscription charges on its own schedule, so for
+	// gateway-managed subscriptions we only ask the user to update their card.
+	if subscription.RazorpaySubscriptionID.Valid && subscription.RazorpaySubscriptionID.String != "" {
+		return s.notifier.Notify(ctx, subscription.UserID, NotificationPaymentRetry, map[string]interface{}{
+			"subscriptionId":    subscription.ID,
+			"action":            "update_card",
+			"gracePeriodEndsAt": subscription.GracePeriodEndsAt.Time,
+		})
+	}
+
+	card, err := s.retryCard(ctx, subscription, latest)
+	if err != nil {
+		return err
+	}
+
+	customer, err := s.customerRepo.GetByID(ctx, subscription.UserID)
+	if err != nil {
+		return err
+	}
+	chargeable := card != nil && customer != nil && customer.RazorpayCustomerID != ""
+
+	// The attempt is on the card that will be charged. Without one the user
+	// pays the order in Checkout, and the card they use is recorded when the
+	// payment is captured.
+	attempt := &model.PaymentAttempt{
+		ID:             uuid.New().String(),
+		SubscriptionID: subscription.ID,
+		UserID:         subscription.UserID,
+		CardID:         subscription.CardID,
+		AttemptNumber:  latest.AttemptNumber + 1,
+		Status:         model.PaymentAttemptStatusPending,
+	}
+	if chargeable {
+		attempt.CardID = card.ID
+	}
+
+	order, err := s.razorpayClient.CreateOrder(ctx, int(subscription.Amount.Minor), subscription.Amount.Currency, attempt.ID)
+	if err != nil {
+		return err
+	}
+
+	orderID, _ := order["id"].(string)
+	attempt.RazorpayOrderID = toNullString(orderID)
+	if err := s.attemptRepo.Create(ctx, attempt); err != nil {
+		return err
+	}
+
+	subscription.RazorpayOrderID = toNullString(orderID)
+	if err := s.subscriptionRepo.UpdateSubscription(ctx, subscription); err != nil {
+		return err
+	}
+
+	if !chargeable {
+		log.Printf("Created retry order %s for subscription %s, no saved card can be charged (attempt %d)",
+			orderID, subscription.ID, attempt.AttemptNumber)
+
+		return s.notifier.Notify(ctx, subscription.UserID, NotificationPaymentRetry, map[string]interface{}{
+			"subscriptionId":    subscription.ID,
+			"action":            "complete_payment",
+			"razorpayOrderId":   orderID,
+			"gracePeriodEndsAt": subscription.GracePeriodEndsAt.Time,
+		})
+	}
+
+	_, err = s.razorpayClient.ChargeToken(ctx,
+		customer.RazorpayCustomerID,
+		card.RazorpayTokenID.String,
+		orderID,
+		int(subscription.Amount.Minor),
+		subscription.Amount.Currency,
+		customer.Email,
+		customer.Phone,
+		map[string]interface{}{
+			"subscription_id": subscription.ID,
+			"attempt_id":      attempt.ID,
+		},
+	)
+	if err != nil {
+		log.Printf("Retry charge on card %s for subscription %s was rejected: %v", card.ID, subscription.ID, err)
+		return s.RecordPaymentFailure(ctx, subscription, "", err.Error())
+	}
+
+	log.Printf("Charged retry order %s for subscription %s to card %s (attempt %d)",
+		orderID, subscription.ID, card.ID, attempt.AttemptNumber)
+
+	return s.notifier.Notify(ctx, subscription.UserID, NotificationPaymentRetry, map[string]interface{}{
+		"subscriptionId":    subscription.ID,
+		"action":            "payment_retried",
+		"razorpayOrderId":   orderID,
+		"cardId":            card.ID,
+		"cardLastFour":      card.LastFourDigits,
+		"gracePeriodEndsAt": subscription.GracePeriodEndsAt.Time,
+	})
+}
+
+// retryCards lists the cards a failed renewal may be retried on, in order:
+// the subscription's own card, the user's default card, then the user's other
+// cards in the configured fallback order. Cards that can no longer be charged,
+// that have no Razorpay token to charge them through, or that the plan does
+// not accept are left out.
+func (s *DefaultDunningService) retryCards(ctx context.Context, subscription *model.SubscriptionTransaction) ([]model.Card, error) {
+	fallback, err := s.cardService.GetFallbackCards(ctx, subscription.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := s.subscriptionRepo.GetPlanWithAttributes(ctx, subscription.PlanID)
+	if err != nil {
+		return nil, err
+	}
+	accepts := func(card model.Card) bool {
+		return card.IsChargeable() && (plan == nil || plan.Plan.AllowedFundingTypes.Allows(card.FundingType))
+	}
+
+	cards := make([]model.Card, 0, len(fallback))
+	for _, card := range fallback {
+		if card.ID == subscription.CardID && accepts(card) {
+			cards = append(cards, card)
+		}
+	}
+	for _, card := range fallback {
+		if card.ID != subscription.CardID && accepts(card) {
+			cards = append(cards, card)
+		}
+	}
+	return cards, nil
+}
+
+// untriedCard returns the first retry card that has not failed since the
+// subscription last paid, counting failedCardID as failed. It returns nil
+// when every card has been tried.
+func (s *DefaultDunningService) untriedCard(ctx context.Context, subscription *model.SubscriptionTransaction, failedCardID string) (*model.Card, error) {
+	cards, err := s.retryCards(ctx, subscription)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts, err := s.attemptRepo.GetBySubscriptionID(ctx, subscription.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	failed := map[string]bool{failedCardID: true}
+	for _, attempt := range attempts {
+		switch attempt.Status {
+		case model.PaymentAttemptStatusSucceeded:
+			failed = map[string]bool{failedCardID: true}
+		case model.PaymentAttemptStatusFailed:
+			failed[attempt.CardID] = true
+		}
+	}
+
+	for i := range cards {
+		if !failed[cards[i].ID] {
+			return &cards[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// retryCard picks the card for the next retry: the first card not tried yet,
+// or the first retry card again once all have failed. It returns nil when no
+// card can be charged, leaving the user to pay the retry order themselves.
+func (s *DefaultDunningService) retryCard(ctx context.Context, subscription *model.SubscriptionTransaction, latest *model.PaymentAttempt) (*model.Card, error) {
+	card, err := s.untriedCard(ctx, subscription, latest.CardID)
+	if err != nil || card != nil {
+		return card, err
+	}
+
+	cards, err := s.retryCards(ctx, subscription)
+	if err != nil {
+		return nil, err
+	}
+	if len(cards) > 0 {
+		return &cards[0], nil
+	}
+
+	return nil, nil
+}
+
+func (s *DefaultDunningService) cancelForNonPayment(ctx context.Context, subscription *model.SubscriptionTransaction) error {
+	if subscription.RazorpaySubscriptionID.Valid && subscription.RazorpaySubscriptionID.String != "" {
+		if _, err := s.razorpayClient.CancelSubscription(ctx, subscription.RazorpaySubscriptionID.String, false); err != nil {
+			log.Printf("Failed to cancel Razorpay subscription %s: %v",
+				subscription.RazorpaySubscriptionID.String, err)
+		}
+	}
+
+	if err := stopSubscription(ctx, s.transactor, s.subscriptionRepo, s.outboxRepo, subscription, CancellationReasonNonPayment); err != nil {
+		return err
+	}
+
+	log.Printf("Subscription %s cancelled for non-payment", subscription.ID)
+	return s.notifier.Notify(ctx, subscription.UserID, NotificationSubscriptionDunned, map[string]interface{}{
+		"subscriptionId": subscription.ID,
+	})
+}
+
+func (s *DefaultDunningService) GetPaymentAttempts(ctx context.Context, subscriptionID string, userID string) ([]model.PaymentAttempt, error) {
+	subscription, err := s.subscriptionRepo.GetSubscriptionByID(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if subscription == nil {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	if subscription.UserID != userID {
+		return nil, ErrUnauthorized
+	}
+
+	return s.attemptRepo.GetBySubscriptionID(ctx, subscriptionID)
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"subscription-management/internal/config"
+	"subscription-management/internal/model"
+)
+
+const (
+	HeaderEventID        = "X-Event-Id"
+	HeaderEventType      = "X-Event-Type"
+	HeaderEventSignature = "X-Event-Signature"
+)
+
+// EventPublisher delivers outbox events to downstream consumers. Delivery is
+// at least once: an event whose publication could not be recorded is
+// published again.
+type EventPublisher interface {
+	Publish(ctx context.Context, event *model.OutboxEvent) error
+}
+
+// NewEventPublisher posts events to OUTBOX_PUBLISH_URL when it is set and
+// only logs them otherwise.
+func NewEventPublisher(cfg config.OutboxConfig) EventPublisher {
+	if cfg.PublishURL == "" {
+		return &LogEventPublisher{}
+	}
+	return &HTTPEventPublisher{
+		url:    cfg.PublishURL,
+		secret: cfg.SigningSecret,
+		client: &http.Client{Timeout: cfg.PublishTimeout},
+	}
+}
+
+// LogEventPublisher writes events to the application log. It is the default
+// until a broker or endpoint is configured.
+type LogEventPublisher struct{}
+
+func (p *LogEventPublisher) Publish(ctx context.Context, event *model.OutboxEvent) error {
+	log.Printf("Event [%s] %s %s/%s for user %s: %s",
+		event.EventID, event.Type, event.AggregateType, event.AggregateID, event.UserID, event.Data)
+	return nil
+}
+
+// HTTPEventPublisher POSTs each event's JSON envelope to one endpoint. When a
+// signing secret is set the body is signed with HMAC-SHA256 so consumers can
+// tell the events are ours.
+type HTTPEventPublisher struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+func (p *HTTPEventPublisher) Publish(ctx context.Context, event *model.OutboxEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEventID, event.EventID)
+	req.Header.Set(HeaderEventType, event.Type)
+	if p.secret != "" {
+		mac := hmac.New(sha256.New, []byte(p.secret))
+		mac.Write(body)
+		req.Header.Set(HeaderEventSignature, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("event endpoint returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+
+	"subscription-management/internal/model"
+	"subscription-management/internal/repository"
+)
+
+// Why a SubscriptionCancelled event happened.
+const (
+	CancellationReasonCustomer   = "customer"
+	CancellationReasonPeriodEnd  = "period_end"
+	CancellationReasonNonPayment = "non_payment"
+	CancellationReasonGateway    = "gateway"
+)
+
+// recordEvent adds a domain event to the outbox. It must run in the unit of
+// work that makes the change the event describes, so the event is published
+// if and only if the change commits.
+func recordEvent(
+	ctx context.Context,
+	outbox repository.OutboxRepository,
+	eventType string,
+	aggregateType string,
+	aggregateID string,
+	userID string,
+	data map[string]interface{},
+) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return outbox.Add(ctx, &model.OutboxEvent{
+		Type:          eventType,
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		UserID:        userID,
+		Data:          payload,
+	})
+}
+
+// recordSubscriptionEvent records an event about subscription. Every
+// subscription event carries the subscription's current terms; extra adds
+// the fields specific to the event.
+func recordSubscriptionEvent(
+	ctx context.Context,
+	outbox repository.OutboxRepository,
+	eventType string,
+	subscription *model.SubscriptionTransaction,
+	extra map[string]interface{},
+) error {
+	data := map[string]interface{}{
+		"subscriptionId": subscription.ID,
+		"productId":      subscription.ProductID,
+		"planId":         subscription.PlanID,
+		"cardId":         subscription.CardID,
+		"paymentType":    subscription.PaymentType,
+		"amount":         subscription.Amount,
+		"currency":       subscription.Currency,
+		"autoRenewal":    subscription.AutoRenewal,
+		"startDate":      subscription.StartDate,
+		"endDate":        subscription.EndDate,
+	}
+	for key, value := range extra {
+		data[key] = value
+	}
+
+	return recordEvent(ctx, outbox, eventType, model.AggregateSubscription, subscription.ID, subscription.UserID, data)
+}
+
+// stopSubscription deactivates subscription and records its cancellation in
+// one unit of work.
+func stopSubscription(
+	ctx context.Context,
+	transactor repository.Transactor,
+	subscriptionRepo repository.SubscriptionRepository,
+	outbox repository.OutboxRepository,
+	subscription *model.SubscriptionTransaction,
+	reason string,
+) error {
+	return transactor.WithinTx(ctx, func(ctx context.Context) error {
+		if err := subscriptionRepo.StopSubscription(ctx, subscription.ID, subscription.UserID); err != nil {
+			return err
+		}
+		return recordSubscriptionEvent(ctx, outbox, model.EventSubscriptionCancelled, subscription, map[string]interface{}{
+			"reason": reason,
+		})
+	})
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"subscription-management/internal/apperr"
+	"subscription-management/internal/invoice"
+	"subscription-management/internal/model"
+	"subscription-management/internal/money"
+	"subscription-management/internal/repository"
+)
+
+var (
+	ErrInvoiceNotFound   = apperr.New(apperr.NotFound, "invoice_not_found", "invoice not found")
+	ErrUnsupportedFormat = apperr.New(apperr.Invalid, "unsupported_format", "unsupported invoice format, use .pdf or .html")
+)
+
+type InvoiceService interface {
+	IssueInvoice(ctx context.Context, transactionID string, customer *model.UserInfo) (*model.Invoice, error)
+	GetInvoice(ctx context.Context, id string, userID string) (*model.Invoice, error)
+	GetUserInvoices(ctx context.Context, userID string) ([]model.Invoice, error)
+	RenderInvoice(ctx context.Context, id string, userID string, format string) ([]byte, error)
+	VerifyInvoice(ctx context.Context, id string, userID string) (*model.InvoiceVerification, error)
+}
+
+type DefaultInvoiceService struct {
+	invoiceRepo      repository.InvoiceRepository
+	subscriptionRepo repository.SubscriptionRepository
+	cardRepo         repository.CardRepository
+	customerRepo     repository.CustomerRepository
+	renderer         *invoice.Renderer
+}
+
+func NewInvoiceService(
+	invoiceRepo repository.InvoiceRepository,
+	subscriptionRepo repository.SubscriptionRepository,
+	cardRepo repository.CardRepository,
+	customerRepo repository.CustomerRepository,
+	renderer *invoice.Renderer,
+) InvoiceService {
+	return &DefaultInvoiceService{
+		invoiceRepo:      invoiceRepo,
+		subscriptionRepo: subscriptionRepo,
+		cardRepo:         cardRepo,
+		customerRepo:     customerRepo,
+		renderer:         renderer,
+	}
+}
+
+// IssueInvoice creates the invoice for a paid transaction. It is idempotent:
+// a transaction that already has an invoice returns the existing one. Customer
+// details come from the stored profile; fallback fills in whatever it lacks.
+func (s *DefaultInvoiceService) IssueInvoice(ctx context.Context, transactionID string, fallback *model.UserInfo) (*model.Invoice, error) {
+	existing, err := s.invoiceRepo.GetByTransactionID(ctx, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return existing, nil
+	}
+
+	transaction, err := s.subscriptionRepo.GetSubscriptionByID(ctx, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	if transaction == nil {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	plan, err := s.subscriptionRepo.GetPlanWithAttributes(ctx, transaction.PlanID)
+	if err != nil {
+		return nil, err
+	}
+
+	var attributes model.InvoiceAttributes
+	if plan != nil {
+		for _, attr := range plan.Attributes {
+			attributes = append(attributes, model.InvoiceAttribute{Name: attr.Name, Value: attr.Value})
+		}
+	}
+
+	customer, err := s.customerRepo.GetByID(ctx, transaction.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if customer == nil {
+		customer = &model.UserInfo{ID: transaction.UserID}
+	}
+	if fallback != nil {
+		if customer.Name == "" {
+			customer.Name = fallback.Name
+		}
+		if customer.Email == "" {
+			customer.Email = fallback.Email
+		}
+		if customer.Phone == "" {
+			customer.Phone = fallback.Phone
+		}
+	}
+	if customer.Name == "" {
+		card, err := s.cardRepo.GetByID(ctx, transaction.CardID)
+		if err != nil {
+			return nil, err
+		}
+		if card != nil {
+			customer.Name = card.CardHolderName
+		}
+	}
+
+	description := fmt.Sprintf("%s %s (%s) %s - %s",
+		transaction.ProductName,
+		transaction.PlanName,
+		transaction.PaymentType,
+		transaction.StartDate.Format("02 Jan 2006"),
+		transaction.EndDate.Format("02 Jan 2006"),
+	)
+
+	lineItems := []model.InvoiceLineItem{
+		{
+			Kind:        model.LineItemKindPlan,
+			Description: description,
+			Quantity:    1,
+			UnitAmount:  transaction.AmountExclusive,
+			Amount:      transaction.AmountExclusive,
+		},
+	}
+	for _, line := range transaction.TaxBreakdown {
+		lineItems = append(lineItems, model.InvoiceLineItem{
+			Kind:        model.LineItemKindTax,
+			Description: line.Name,
+			Quantity:    1,
+			UnitAmount:  line.Amount,
+			Amount:      line.Amount,
+		})
+	}
+
+	issued := &model.Invoice{
+		TransactionID:     transaction.ID,
+		UserID:            transaction.UserID,
+		CustomerName:      customer.Name,
+		CustomerEmail:     customer.Email,
+		CustomerPhone:     customer.Phone,
+		BillingCountry:    transaction.BillingCountry,
+		BillingState:      transaction.BillingState,
+		ProductName:       transaction.ProductName,
+		PlanName:          transaction.PlanName,
+		PlanAttributes:    attributes,
+		PaymentType:       transaction.PaymentType,
+		PeriodStart:       transaction.StartDate,
+		PeriodEnd:         transaction.EndDate,
+		Currency:          transaction.Currency,
+		DiscountTotal:     money.Zero(transaction.Currency),
+		Subtotal:          transaction.AmountExclusive,
+		TaxTotal:          transaction.TaxAmount,
+		Total:             transaction.Amount,
+		RazorpayPaymentID: transaction.RazorpayPaymentID,
+		LineItems:         lineItems,
+	}
+
+	seal := func(inv *model.Invoice) error {
+		hash, err := s.renderer.ContentHash(inv)
+		if err != nil {
+			return err
+		}
+		inv.ContentHash = toNullString(hash)
+		return nil
+	}
+
+	if err := s.invoiceRepo.Create(ctx, issued, seal); err != nil {
+		if errors.Is(err, repository.ErrInvoiceExists) {
+			// Another delivery of the same payment issued it first.
+			return s.invoiceRepo.GetByTransactionID(ctx, transactionID)
+		}
+		return nil, err
+	}
+
+	log.Printf("Issued invoice %s for transaction %s", issued.InvoiceNumber, transaction.ID)
+	return issued, nil
+}
+
+func (s *DefaultInvoiceService) GetInvoice(ctx context.Context, id string, userID string) (*model.Invoice, error) {
+	invoice, err := s.invoiceRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if invoice == nil {
+		return nil, ErrInvoiceNotFound
+	}
+
+	if invoice.UserID != userID {
+		return nil, ErrUnauthorized
+	}
+
+	return invoice, nil
+}
+
+func (s *DefaultInvoiceService) GetUserInvoices(ctx context.Context, userID string) ([]model.Invoice, error) {
+	return s.invoiceRepo.GetByUserID(ctx, userID)
+}
+
+func (s *DefaultInvoiceService) RenderInvoice(ctx context.Context, id string, userID string, format string) ([]byte, error) {
+	inv, err := s.GetInvoice(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case "html":
+		return s.renderer.HTML(inv)
+	case "pdf":
+		return s.renderer.PDF(inv)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+}
+
+func (s *DefaultInvoiceService) VerifyInvoice(ctx context.Context, id string, userID string) (*model.InvoiceVerification, error) {
+	inv, err := s.GetInvoice(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	renderedHash, err := s.renderer.ContentHash(inv)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.InvoiceVerification{
+		InvoiceID:    inv.ID,
+		ContentHash:  fromNullString(inv.ContentHash),
+		RenderedHash: renderedHash,
+		Matches:      inv.ContentHash.Valid && inv.ContentHash.String == renderedHash,
+	}, nil
+}
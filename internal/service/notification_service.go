@@ -0,0 +1,31 @@
+package service
+
+import (
+	"context"
+	"log"
+)
+
+const (
+	NotificationPaymentFailed      = "payment.failed"
+	NotificationPaymentRetry       = "payment.retry"
+	NotificationPaymentRecovered   = "payment.recovered"
+	NotificationSubscriptionDunned = "subscription.cancelled_for_nonpayment"
+	NotificationCardExpiring       = "card.expiring"
+)
+
+type NotificationService interface {
+	Notify(ctx context.Context, userID string, event string, data map[string]interface{}) error
+}
+
+// LogNotificationService writes notifications to the application log. It is
+// the default until an email/SMS provider is wired in.
+type LogNotificationService struct{}
+
+func NewLogNotificationService() NotificationService {
+	return &LogNotificationService{}
+}
+
+func (n *LogNotificationService) Notify(ctx context.Context, userID string, event string, data map[string]interface{}) error {
+	log.Printf("Notification [%s] for user %s: %v", event, userID, data)
+	return nil
+}
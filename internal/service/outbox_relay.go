@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"subscription-management/internal/config"
+	"subscription-management/internal/model"
+	"subscription-management/internal/repository"
+)
+
+// OutboxRelay publishes the events waiting in the outbox.
+type OutboxRelay interface {
+	PublishPending(ctx context.Context) error
+}
+
+type DefaultOutboxRelay struct {
+	outboxRepo repository.OutboxRepository
+	publisher  EventPublisher
+	config     config.OutboxConfig
+}
+
+func NewOutboxRelay(
+	outboxRepo repository.OutboxRepository,
+	publisher EventPublisher,
+	config config.OutboxConfig,
+) OutboxRelay {
+	return &DefaultOutboxRelay{
+		outboxRepo: outboxRepo,
+		publisher:  publisher,
+		config:     config,
+	}
+}
+
+// PublishPending publishes unpublished events in the order they were written,
+// batch by batch, until the outbox is empty or an event fails. A failed event
+// holds back the ones after it, so consumers never see events out of order;
+// it is retried on the next run. After MaxAttempts failures it is
+// dead-lettered instead, and the events after it go ahead.
+func (r *DefaultOutboxRelay) PublishPending(ctx context.Context) error {
+	for {
+		published, complete, err := r.publishBatch(ctx)
+		if err != nil {
+			return err
+		}
+		if published > 0 {
+			log.Printf("Published %d outbox events", published)
+		}
+		if !complete || published < r.config.BatchSize {
+			return nil
+		}
+	}
+}
+
+// publishBatch claims one batch and publishes it once the claim has
+// committed. It reports how many events it published and whether it got
+// through the whole batch. Events left over when it stops early, or when the
+// claim is about to run out, are released for the next run.
+func (r *DefaultOutboxRelay) publishBatch(ctx context.Context) (int, bool, error) {
+	claimedUntil := time.Now().Add(r.config.ClaimTimeout)
+	events, err := r.outboxRepo.Claim(ctx, r.config.BatchSize, claimedUntil)
+	if err != nil {
+		return 0, false, err
+	}
+
+	published := 0
+	for i := range events {
+		event := &events[i]
+
+		if time.Now().Add(r.config.PublishTimeout).After(claimedUntil) {
+			return published, false, r.release(ctx, events[i:])
+		}
+
+		if err := r.publisher.Publish(ctx, event); err != nil {
+			attempt := event.Attempts + 1
+			if attempt >= r.config.MaxAttempts {
+				log.Printf("Dead-lettering event %s (%s) after %d attempts: %v",
+					event.EventID, event.Type, attempt, err)
+				if err := r.outboxRepo.MarkDeadLettered(ctx, event.ID, err.Error(), time.Now()); err != nil {
+					return published, false, err
+				}
+				continue
+			}
+
+			log.Printf("Failed to publish event %s (%s), attempt %d: %v",
+				event.EventID, event.Type, attempt, err)
+			if err := r.outboxRepo.MarkFailed(ctx, event.ID, err.Error()); err != nil {
+				return published, false, err
+			}
+			return published, false, r.release(ctx, events[i+1:])
+		}
+
+		if err := r.outboxRepo.MarkPublished(ctx, event.ID, time.Now()); err != nil {
+			return published, false, err
+		}
+		published++
+	}
+
+	return published, len(events) == r.config.BatchSize, nil
+}
+
+func (r *DefaultOutboxRelay) release(ctx context.Context, events []model.OutboxEvent) error {
+	ids := make([]int64, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	return r.outboxRepo.Release(ctx, ids)
+}
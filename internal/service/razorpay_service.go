@@ -8,62 +8,65 @@ import (
 	"log"
 	"time"
 
+	"subscription-management/internal/apperr"
 	"subscription-management/internal/model"
+	"subscription-management/internal/money"
 	"subscription-management/internal/razorpay"
 	"subscription-management/internal/repository"
 )
 
 var (
-	ErrRazorpayOperationFailed = errors.New("razorpay operation failed")
-	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+	ErrRazorpayOperationFailed = apperr.New(apperr.Unavailable, "gateway_error", "razorpay operation failed")
+	ErrInvalidWebhookSignature = apperr.New(apperr.Unauthenticated, "invalid_webhook_signature", "invalid webhook signature")
+	ErrCardChangeNotAllowed    = apperr.New(apperr.Conflict, "card_change_not_allowed", "razorpay subscription does not accept a card change in its current state")
 )
 
 type RazorpayService interface {
-	CreatePayment(ctx context.Context, amount float64, currency string, receiptID string) (map[string]interface{}, error)
+	CreatePayment(ctx context.Context, amount money.Money, receiptID string) (map[string]interface{}, error)
 	CreateSubscription(ctx context.Context, subscription *model.SubscriptionTransaction, userInfo *model.UserInfo) (map[string]interface{}, error)
 	CancelSubscription(ctx context.Context, razorpaySubscriptionID string) error
+	RefundPayment(ctx context.Context, razorpayPaymentID string, amount money.Money, notes map[string]interface{}) (map[string]interface{}, error)
+	PauseSubscription(ctx context.Context, razorpaySubscriptionID string) error
+	ResumeSubscription(ctx context.Context, razorpaySubscriptionID string) error
+	PrepareCardChange(ctx context.Context, razorpaySubscriptionID string) (map[string]interface{}, error)
 	HandleWebhook(ctx context.Context, payload []byte, signature string) error
 	TestConnection(ctx context.Context) (interface{}, error)
-	GetPlanInfo(ctx context.Context, planID string, paymentType string) (map[string]interface{}, error)
-}
-
-type PlanInfo struct {
-	Monthly string
-	Yearly  string
+	GetPlanInfo(ctx context.Context, subscription *model.SubscriptionTransaction) (map[string]interface{}, error)
 }
 
 type DefaultRazorpayService struct {
 	razorpayClient     *razorpay.Client
 	subscriptionRepo   repository.SubscriptionRepository
+	refundRepo         repository.RefundRepository
+	customerRepo       repository.CustomerRepository
+	dunningService     DunningService
+	invoiceService     InvoiceService
+	outboxRepo         repository.OutboxRepository
+	transactor         repository.Transactor
 	webhookSecret      string
-	planMapping        map[string]PlanInfo
 }
 
 func NewRazorpayService(
 	razorpayClient *razorpay.Client,
 	subscriptionRepo repository.SubscriptionRepository,
+	refundRepo repository.RefundRepository,
+	customerRepo repository.CustomerRepository,
+	dunningService DunningService,
+	invoiceService InvoiceService,
+	outboxRepo repository.OutboxRepository,
+	transactor repository.Transactor,
 	webhookSecret string,
 ) RazorpayService {
-	planMapping := map[string]PlanInfo{
-		"plan-001": { // Budget
-			Monthly: "plan_QIbEUICtejuBUQ", 
-			Yearly:  "plan_QIbFBU9kxYoEhg",
-		},
-		"plan-002": { // Standard
-			Monthly: "plan_LgWAqFqsESLnhb",
-			Yearly:  "plan_LgWAtVDXJI4Nzu",
-		},
-		"plan-003": { // Premium
-			Monthly: "plan_LgWB3F9fPBzPRV",
-			Yearly:  "plan_LgWB7dBSP7iUf7",
-		},
-	}
-	
 	return &DefaultRazorpayService{
 		razorpayClient:   razorpayClient,
 		subscriptionRepo: subscriptionRepo,
+		refundRepo:       refundRepo,
+		customerRepo:     customerRepo,
+		dunningService:   dunningService,
+		invoiceService:   invoiceService,
+		outboxRepo:       outboxRepo,
+		transactor:       transactor,
 		webhookSecret:    webhookSecret,
-		planMapping:      planMapping,
 	}
 }
 
@@ -80,40 +83,99 @@ func (s *DefaultRazorpayService) TestConnection(ctx context.Context) (interface{
 	return "Razorpay connection successful", nil
 }
 
-func (s *DefaultRazorpayService) GetPlanInfo(ctx context.Context, planID string, paymentType string) (map[string]interface{}, error) {
-	planInfo, exists := s.planMapping[planID]
-	if !exists {
-		log.Printf("No Razorpay plan mapping found for plan ID: %s", planID)
-		return nil, fmt.Errorf("unknown plan ID: %s", planID)
+// GetPlanInfo returns the Razorpay plan that charges the subscription's
+// amount, tax included, every period, creating it on Razorpay the first time
+// it is needed. The catalog price's plan is used when tax is already in the
+// price; otherwise there is one plan per tax treatment and amount.
+func (s *DefaultRazorpayService) GetPlanInfo(ctx context.Context, subscription *model.SubscriptionTransaction) (map[string]interface{}, error) {
+	planID := subscription.PlanID
+	currency := subscription.Currency
+	paymentType := subscription.PaymentType
+
+	price, err := s.subscriptionRepo.GetPlanPrice(ctx, planID, currency, paymentType)
+	if err != nil {
+		return nil, err
+	}
+	if price == nil {
+		log.Printf("No %s %s price found for plan ID: %s", currency, paymentType, planID)
+		return nil, fmt.Errorf("no %s %s price for plan ID: %s", currency, paymentType, planID)
 	}
 
 	var razorpayPlanID string
-	if paymentType == "monthly" {
-		razorpayPlanID = planInfo.Monthly
-	} else { 
-		razorpayPlanID = planInfo.Yearly
+	if subscription.Amount.Cmp(price.Amount) == 0 {
+		razorpayPlanID = fromNullString(price.RazorpayPlanID)
+		if razorpayPlanID == "" {
+			razorpayPlanID, err = s.createGatewayPlan(ctx, planID, "", price.Amount, paymentType)
+			if err != nil {
+				return nil, err
+			}
+			if err := s.subscriptionRepo.SetPlanPriceRazorpayPlanID(ctx, price.ID, razorpayPlanID); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		treatment := subscription.TaxBreakdown.Treatment()
+		razorpayPlanID, err = s.subscriptionRepo.GetGatewayPlanID(ctx, price.ID, treatment, subscription.Amount)
+		if err != nil {
+			return nil, err
+		}
+		if razorpayPlanID == "" {
+			created, err := s.createGatewayPlan(ctx, planID, treatment, subscription.Amount, paymentType)
+			if err != nil {
+				return nil, err
+			}
+			if err := s.subscriptionRepo.AddGatewayPlan(ctx, price.ID, treatment, subscription.Amount, created); err != nil {
+				return nil, err
+			}
+			razorpayPlanID, err = s.subscriptionRepo.GetGatewayPlanID(ctx, price.ID, treatment, subscription.Amount)
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
 	
-	log.Printf("Using Razorpay plan ID: %s for local plan %s (%s)", 
-		razorpayPlanID, planID, paymentType)
+	log.Printf("Using Razorpay plan ID: %s for local plan %s (%s %s)", 
+		razorpayPlanID, planID, currency, paymentType)
 	
 	return map[string]interface{}{
 		"razorpay_plan_id": razorpayPlanID,
 	}, nil
 }
 
+// createGatewayPlan creates a Razorpay plan that charges amount every period.
+// A tax treatment, when given, is added to the plan's name.
+func (s *DefaultRazorpayService) createGatewayPlan(ctx context.Context, planID string, treatment string, amount money.Money, paymentType string) (string, error) {
+	plan, err := s.subscriptionRepo.GetPlanWithAttributes(ctx, planID)
+	if err != nil {
+		return "", err
+	}
+	if plan == nil {
+		return "", fmt.Errorf("unknown plan ID: %s", planID)
+	}
+
+	name := plan.Plan.Name
+	if treatment != "" {
+		name = fmt.Sprintf("%s (incl. %s)", name, treatment)
+	}
+
+	razorpayPlan, err := s.razorpayClient.CreatePlan(ctx, name, int(amount.Minor), amount.Currency, paymentType)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrRazorpayOperationFailed, err)
+	}
+
+	razorpayPlanID, _ := razorpayPlan["id"].(string)
+	return razorpayPlanID, nil
+}
+
 func (s *DefaultRazorpayService) CreatePayment(
 	ctx context.Context, 
-	amount float64, 
-	currency string, 
+	amount money.Money, 
 	receiptID string,
 ) (map[string]interface{}, error) {
-	amountInPaise := int(amount * 100)
-	
-	log.Printf("Creating Razorpay payment: Amount %.2f %s (%d paise), Receipt ID: %s", 
-		amount, currency, amountInPaise, receiptID)
+	log.Printf("Creating Razorpay payment: Amount %s (%d minor units), Receipt ID: %s", 
+		amount, amount.Minor, receiptID)
 	
-	order, err := s.razorpayClient.CreateOrder(ctx, amountInPaise, currency, receiptID)
+	order, err := s.razorpayClient.CreateOrder(ctx, int(amount.Minor), amount.Currency, receiptID)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrRazorpayOperationFailed, err)
 	}
@@ -121,6 +183,34 @@ func (s *DefaultRazorpayService) CreatePayment(
 	return order, nil
 }
 
+// customerFromPayment reads the contact details captured on the Razorpay
+// payment, used when the customer profile is incomplete.
+func customerFromPayment(userID string, paymentEntity map[string]interface{}) *model.UserInfo {
+	customer := &model.UserInfo{ID: userID}
+	if paymentEntity != nil {
+		customer.Email, _ = paymentEntity["email"].(string)
+		customer.Phone, _ = paymentEntity["contact"].(string)
+	}
+	return customer
+}
+
+// paymentCardFromEntity reads the saved-card token and card details of a
+// Razorpay payment entity. It returns nil for payments not made by card.
+func paymentCardFromEntity(paymentEntity map[string]interface{}) *model.PaymentCard {
+	if paymentEntity == nil {
+		return nil
+	}
+	if method, _ := paymentEntity["method"].(string); method != "card" {
+		return nil
+	}
+	paid := &model.PaymentCard{}
+	paid.TokenID, _ = paymentEntity["token_id"].(string)
+	if card, _ := paymentEntity["card"].(map[string]interface{}); card != nil {
+		paid.LastFour, _ = card["last4"].(string)
+	}
+	return paid
+}
+
 func (s *DefaultRazorpayService) CreateSubscription(
 	ctx context.Context, 
 	subscription *model.SubscriptionTransaction,
@@ -130,13 +220,11 @@ func (s *DefaultRazorpayService) CreateSubscription(
 		subscription.UserID, subscription.PlanID, subscription.PaymentType)
 
 	if userInfo == nil {
-		log.Println("Warning: No user info provided for subscription")
-		userInfo = &model.UserInfo{
-			ID: subscription.UserID,
-			Name: "User " + subscription.UserID,
-			Email: subscription.UserID + "@example.com",
-			Phone: "",
-		}
+		userInfo = &model.UserInfo{ID: subscription.UserID}
+	}
+	if userInfo.RazorpayCustomerID == "" && userInfo.Email == "" {
+		log.Printf("No email on file for user %s, cannot create Razorpay customer", subscription.UserID)
+		return nil, ErrCustomerEmailRequired
 	}
 	
 	customer, err := s.razorpayClient.GetOrCreateCustomer(
@@ -154,14 +242,21 @@ func (s *DefaultRazorpayService) CreateSubscription(
 	customerID, _ := customer["id"].(string)
 	log.Printf("Using Razorpay customer ID: %s", customerID)
 
-	planInfo, err := s.GetPlanInfo(ctx, subscription.PlanID, subscription.PaymentType)
+	if customerID != "" && customerID != userInfo.RazorpayCustomerID {
+		if err := s.customerRepo.SetRazorpayCustomerID(ctx, subscription.UserID, customerID); err != nil {
+			log.Printf("Failed to store Razorpay customer ID for user %s: %v", subscription.UserID, err)
+			return nil, err
+		}
+		userInfo.RazorpayCustomerID = customerID
+	}
+
+	planInfo, err := s.GetPlanInfo(ctx, subscription)
 	if err != nil {
 		log.Printf("Failed to get Razorpay plan: %v", err)
 		return nil, fmt.Errorf("failed to get plan: %v", err)
 	}
 	
 	razorpayPlanID := planInfo["razorpay_plan_id"].(string)
-	razorpayPlanID = "plan_QIbDj6gHdpgbDl"
 	log.Printf("Using Razorpay plan ID: %s", razorpayPlanID)
 	
 	
@@ -176,6 +271,10 @@ func (s *DefaultRazorpayService) CreateSubscription(
 		customerID,
 		totalCount,
 		true, 
+		map[string]interface{}{
+			"subscription_id": subscription.ID,
+			"user_id":         subscription.UserID,
+		},
 	)
 	
 	if err != nil {
@@ -199,6 +298,78 @@ func (s *DefaultRazorpayService) CancelSubscription(
 	return nil
 }
 
+func (s *DefaultRazorpayService) RefundPayment(
+	ctx context.Context, 
+	razorpayPaymentID string, 
+	amount money.Money, 
+	notes map[string]interface{},
+) (map[string]interface{}, error) {
+	refund, err := s.razorpayClient.CreateRefund(ctx, razorpayPaymentID, int(amount.Minor), notes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRazorpayOperationFailed, err)
+	}
+	
+	return refund, nil
+}
+
+func (s *DefaultRazorpayService) PauseSubscription(
+	ctx context.Context, 
+	razorpaySubscriptionID string,
+) error {
+	_, err := s.razorpayClient.PauseSubscription(ctx, razorpaySubscriptionID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRazorpayOperationFailed, err)
+	}
+	
+	return nil
+}
+
+func (s *DefaultRazorpayService) ResumeSubscription(
+	ctx context.Context, 
+	razorpaySubscriptionID string,
+) error {
+	_, err := s.razorpayClient.ResumeSubscription(ctx, razorpaySubscriptionID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRazorpayOperationFailed, err)
+	}
+	
+	return nil
+}
+
+// cardChangeStatuses are the Razorpay subscription states in which the
+// customer can authenticate a new card.
+var cardChangeStatuses = map[string]bool{
+	"authenticated": true,
+	"active":        true,
+	"pending":       true,
+	"halted":        true,
+}
+
+// PrepareCardChange checks that the Razorpay subscription can move to a new
+// card and returns the Checkout options that start the card-change flow. The
+// customer authenticates the new card in Checkout; Razorpay charges future
+// renewals to it once that succeeds.
+func (s *DefaultRazorpayService) PrepareCardChange(
+	ctx context.Context,
+	razorpaySubscriptionID string,
+) (map[string]interface{}, error) {
+	subscription, err := s.razorpayClient.FetchSubscription(ctx, razorpaySubscriptionID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRazorpayOperationFailed, err)
+	}
+
+	status, _ := subscription["status"].(string)
+	if !cardChangeStatuses[status] {
+		log.Printf("Razorpay subscription %s is %s, card change not allowed", razorpaySubscriptionID, status)
+		return nil, ErrCardChangeNotAllowed
+	}
+
+	return map[string]interface{}{
+		"subscription_id":          razorpaySubscriptionID,
+		"subscription_card_change": 1,
+	}, nil
+}
+
 func (s *DefaultRazorpayService) HandleWebhook(
 	ctx context.Context, 
 	payload []byte, 
@@ -211,9 +382,7 @@ func (s *DefaultRazorpayService) HandleWebhook(
 	testMode := ctx.Value("testMode") != nil
 
 	if !testMode {
-		if !s.razorpayClient.VerifyPaymentSignature(map[string]interface{}{
-			"payload": string(payload),
-		}, signature) {
+		if !razorpay.VerifyWebhookSignature(payload, signature, s.webhookSecret) {
 			log.Println("Webhook signature verification failed")
 			return ErrInvalidWebhookSignature
 		}
@@ -244,6 +413,12 @@ func (s *DefaultRazorpayService) HandleWebhook(
 		return s.handleSubscriptionCancelled(ctx, event)
 	case "payment.failed":
 		return s.handlePaymentFailed(ctx, event)
+	case "subscription.paused":
+		return s.handleSubscriptionPaused(ctx, event)
+	case "subscription.resumed":
+		return s.handleSubscriptionResumed(ctx, event)
+	case "refund.processed", "refund.failed":
+		return s.handleRefundUpdated(ctx, event)
 	default:
 		log.Printf("Unhandled webhook event type: %s", eventType)
 		return nil
@@ -271,6 +446,15 @@ func (s *DefaultRazorpayService) handlePaymentAuthorized(ctx context.Context, ev
 	paymentID, _ := entity["id"].(string)
 	orderID, _ := entity["order_id"].(string)
 	
+	// Card-change authorizations carry the notes ChangeCard put in Checkout.
+	if notes, _ := entity["notes"].(map[string]interface{}); notes != nil {
+		subscriptionID, _ := notes["subscription_id"].(string)
+		cardID, _ := notes["card_id"].(string)
+		if subscriptionID != "" && cardID != "" {
+			return s.confirmCardChange(ctx, subscriptionID, cardID, paymentID)
+		}
+	}
+	
 	if paymentID == "" || orderID == "" {
 		return fmt.Errorf("missing payment or order ID in webhook")
 	}
@@ -294,11 +478,46 @@ func (s *DefaultRazorpayService) handlePaymentAuthorized(ctx context.Context, ev
 		log.Printf("Failed to update subscription with payment ID: %v", err)
 		return fmt.Errorf("failed to update subscription with payment ID: %v", err)
 	}
+
+	if err := s.dunningService.RecordPaymentRecovered(ctx, subscription, paymentID, paymentCardFromEntity(entity)); err != nil {
+		log.Printf("Failed to clear past_due state: %v", err)
+		return fmt.Errorf("failed to clear past_due state: %v", err)
+	}
+
+	if _, err := s.invoiceService.IssueInvoice(ctx, subscription.ID, customerFromPayment(subscription.UserID, entity)); err != nil {
+		log.Printf("Failed to issue invoice for subscription %s: %v", subscription.ID, err)
+	}
 	
 	log.Printf("Subscription payment authorized: Order ID %s, Payment ID %s", orderID, paymentID)
 	return nil
 }
 
+// confirmCardChange moves a subscription to the card the customer has just
+// authenticated in Checkout, if that is still its pending card change.
+func (s *DefaultRazorpayService) confirmCardChange(ctx context.Context, subscriptionID string, cardID string, paymentID string) error {
+	subscription, err := s.subscriptionRepo.GetSubscriptionByID(ctx, subscriptionID)
+	if err != nil {
+		return err
+	}
+	if subscription == nil || !subscription.PendingCardID.Valid || subscription.PendingCardID.String != cardID {
+		log.Printf("Ignoring card change authorization %s: subscription %s has no pending change to card %s",
+			paymentID, subscriptionID, cardID)
+		return nil
+	}
+
+	if err := s.subscriptionRepo.SetCard(ctx, subscription.ID, cardID); err != nil {
+		if errors.Is(err, repository.ErrCardNotFound) {
+			log.Printf("Card %s was removed before its change was confirmed, keeping subscription %s on card %s",
+				cardID, subscription.ID, subscription.CardID)
+			return s.subscriptionRepo.SetPendingCard(ctx, subscription.ID, "")
+		}
+		return err
+	}
+
+	log.Printf("Subscription %s moved to card %s, confirmed by payment %s", subscription.ID, cardID, paymentID)
+	return nil
+}
+
 func (s *DefaultRazorpayService) handleSubscriptionCharged(ctx context.Context, event map[string]interface{}) error {
 	log.Println("Processing subscription.charged webhook")
 
@@ -335,6 +554,19 @@ func (s *DefaultRazorpayService) handleSubscriptionCharged(ctx context.Context,
 		return fmt.Errorf("no subscription found with Razorpay subscription ID: %s", subscriptionID)
 	}
 
+	paymentID := ""
+	var paymentEntity map[string]interface{}
+	if paymentObj, _ := payloadObj["payment"].(map[string]interface{}); paymentObj != nil {
+		if paymentEntity, _ = paymentObj["entity"].(map[string]interface{}); paymentEntity != nil {
+			paymentID, _ = paymentEntity["id"].(string)
+		}
+	}
+
+	if err := s.dunningService.RecordPaymentRecovered(ctx, subscription, paymentID, paymentCardFromEntity(paymentEntity)); err != nil {
+		log.Printf("Failed to clear past_due state: %v", err)
+		return fmt.Errorf("failed to clear past_due state: %v", err)
+	}
+
 	startDate := time.Now()
 	var endDate time.Time
 	
@@ -352,17 +584,38 @@ func (s *DefaultRazorpayService) handleSubscriptionCharged(ctx context.Context,
 		IsRenewal:              true,
 		IsActive:               true,
 		PaymentType:            subscription.PaymentType,
+		Currency:               subscription.Currency,
 		Amount:                 subscription.Amount,
+		AmountExclusive:        subscription.AmountExclusive,
+		TaxAmount:              subscription.TaxAmount,
+		TaxBreakdown:           subscription.TaxBreakdown,
+		BillingCountry:         subscription.BillingCountry,
+		BillingState:           subscription.BillingState,
 		StartDate:              startDate,
 		EndDate:                endDate,
 		NextRenewalDate:        endDate,
+		AutoRenewal:            subscription.AutoRenewal,
+		RazorpayPaymentID:      toNullString(paymentID),
 		RazorpaySubscriptionID: toNullString(subscriptionID),
 	}
 
-	if err := s.subscriptionRepo.CreateSubscription(ctx, renewalSubscription); err != nil {
+	err = s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.subscriptionRepo.CreateSubscription(ctx, renewalSubscription); err != nil {
+			return err
+		}
+		return recordSubscriptionEvent(ctx, s.outboxRepo, model.EventSubscriptionRenewed, renewalSubscription, map[string]interface{}{
+			"previousSubscriptionId": subscription.ID,
+			"paymentId":              paymentID,
+		})
+	})
+	if err != nil {
 		log.Printf("Failed to create renewal subscription: %v", err)
 		return fmt.Errorf("failed to create renewal subscription: %v", err)
 	}
+
+	if _, err := s.invoiceService.IssueInvoice(ctx, renewalSubscription.ID, customerFromPayment(subscription.UserID, paymentEntity)); err != nil {
+		log.Printf("Failed to issue invoice for renewal %s: %v", renewalSubscription.ID, err)
+	}
 	
 	log.Printf("Subscription charged and renewed: Subscription ID %s", subscriptionID)
 	return nil
@@ -404,7 +657,17 @@ func (s *DefaultRazorpayService) handleSubscriptionCancelled(ctx context.Context
 		return fmt.Errorf("no subscription found with Razorpay subscription ID: %s", subscriptionID)
 	}
 
-	if err := s.subscriptionRepo.StopSubscription(ctx, subscription.ID, subscription.UserID); err != nil {
+	if !subscription.IsActive {
+		log.Printf("Subscription %s already inactive, nothing to cancel", subscription.ID)
+		return nil
+	}
+
+	if subscription.CancelAtPeriodEnd && subscription.CancelAt.Valid && subscription.CancelAt.Time.After(time.Now()) {
+		log.Printf("Subscription %s keeps access until %s", subscription.ID, subscription.CancelAt.Time)
+		return nil
+	}
+
+	if err := stopSubscription(ctx, s.transactor, s.subscriptionRepo, s.outboxRepo, subscription, CancellationReasonGateway); err != nil {
 		log.Printf("Failed to deactivate subscription: %v", err)
 		return fmt.Errorf("failed to deactivate subscription: %v", err)
 	}
@@ -431,10 +694,168 @@ func (s *DefaultRazorpayService) handlePaymentFailed(ctx context.Context, event
 		return fmt.Errorf("invalid entity in payment data")
 	}
 	
+	paymentID, _ := entity["id"].(string)
 	orderID, _ := entity["order_id"].(string)
 	subscriptionID, _ := entity["subscription_id"].(string)
+	reason, _ := entity["error_description"].(string)
 
 	log.Printf("Payment failed: Order ID %s, Subscription ID %s", orderID, subscriptionID)
 
+	var subscription *model.SubscriptionTransaction
+	var err error
+	if subscriptionID != "" {
+		subscription, err = s.subscriptionRepo.GetSubscriptionByRazorpaySubscriptionID(ctx, subscriptionID)
+	} else if orderID != "" {
+		subscription, err = s.subscriptionRepo.GetSubscriptionByRazorpayOrderID(ctx, orderID)
+	}
+	if err != nil {
+		log.Printf("Failed to find subscription for failed payment: %v", err)
+		return fmt.Errorf("failed to find subscription for failed payment: %v", err)
+	}
+
+	if subscription == nil {
+		log.Printf("No subscription found for failed payment %s", paymentID)
+		return nil
+	}
+
+	if err := s.dunningService.RecordPaymentFailure(ctx, subscription, paymentID, reason); err != nil {
+		log.Printf("Failed to record payment failure: %v", err)
+		return fmt.Errorf("failed to record payment failure: %v", err)
+	}
+
+	return nil
+}
+
+func (s *DefaultRazorpayService) subscriptionFromWebhook(ctx context.Context, event map[string]interface{}) (*model.SubscriptionTransaction, error) {
+	payloadObj, _ := event["payload"].(map[string]interface{})
+	if payloadObj == nil {
+		return nil, fmt.Errorf("invalid payload in webhook event")
+	}
+	
+	subscriptionObj, _ := payloadObj["subscription"].(map[string]interface{})
+	if subscriptionObj == nil {
+		return nil, fmt.Errorf("invalid subscription data in webhook payload")
+	}
+
+	entity, _ := subscriptionObj["entity"].(map[string]interface{})
+	if entity == nil {
+		return nil, fmt.Errorf("invalid entity in subscription data")
+	}
+	
+	subscriptionID, _ := entity["id"].(string)
+	if subscriptionID == "" {
+		return nil, fmt.Errorf("missing subscription ID in webhook")
+	}
+
+	subscription, err := s.subscriptionRepo.GetSubscriptionByRazorpaySubscriptionID(ctx, subscriptionID)
+	if err != nil {
+		log.Printf("Failed to find subscription with ID %s: %v", subscriptionID, err)
+		return nil, fmt.Errorf("failed to find subscription with ID %s: %v", subscriptionID, err)
+	}
+	
+	if subscription == nil {
+		log.Printf("No subscription found with Razorpay subscription ID: %s", subscriptionID)
+		return nil, fmt.Errorf("no subscription found with Razorpay subscription ID: %s", subscriptionID)
+	}
+
+	return subscription, nil
+}
+
+func (s *DefaultRazorpayService) handleSubscriptionPaused(ctx context.Context, event map[string]interface{}) error {
+	log.Println("Processing subscription.paused webhook")
+
+	subscription, err := s.subscriptionFromWebhook(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	if subscription.Status == model.SubscriptionStatusPaused {
+		log.Printf("Subscription %s already paused", subscription.ID)
+		return nil
+	}
+
+	markPaused(subscription, time.Now(), nil)
+	if err := s.subscriptionRepo.UpdateSubscription(ctx, subscription); err != nil {
+		log.Printf("Failed to pause subscription: %v", err)
+		return fmt.Errorf("failed to pause subscription: %v", err)
+	}
+	
+	log.Printf("Subscription paused: ID %s", subscription.ID)
+	return nil
+}
+
+func (s *DefaultRazorpayService) handleSubscriptionResumed(ctx context.Context, event map[string]interface{}) error {
+	log.Println("Processing subscription.resumed webhook")
+
+	subscription, err := s.subscriptionFromWebhook(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	if subscription.Status != model.SubscriptionStatusPaused {
+		log.Printf("Subscription %s is not paused, nothing to resume", subscription.ID)
+		return nil
+	}
+
+	markResumed(subscription, time.Now())
+	if err := s.subscriptionRepo.UpdateSubscription(ctx, subscription); err != nil {
+		log.Printf("Failed to resume subscription: %v", err)
+		return fmt.Errorf("failed to resume subscription: %v", err)
+	}
+	
+	log.Printf("Subscription resumed: ID %s", subscription.ID)
+	return nil
+}
+
+func (s *DefaultRazorpayService) handleRefundUpdated(ctx context.Context, event map[string]interface{}) error {
+	eventType, _ := event["event"].(string)
+	log.Printf("Processing %s webhook", eventType)
+
+	payloadObj, _ := event["payload"].(map[string]interface{})
+	if payloadObj == nil {
+		return fmt.Errorf("invalid payload in webhook event")
+	}
+	
+	refundObj, _ := payloadObj["refund"].(map[string]interface{})
+	if refundObj == nil {
+		return fmt.Errorf("invalid refund data in webhook payload")
+	}
+
+	entity, _ := refundObj["entity"].(map[string]interface{})
+	if entity == nil {
+		return fmt.Errorf("invalid entity in refund data")
+	}
+	
+	razorpayRefundID, _ := entity["id"].(string)
+	if razorpayRefundID == "" {
+		return fmt.Errorf("missing refund ID in webhook")
+	}
+
+	refund, err := s.refundRepo.GetByRazorpayRefundID(ctx, razorpayRefundID)
+	if err != nil {
+		log.Printf("Failed to find refund with ID %s: %v", razorpayRefundID, err)
+		return fmt.Errorf("failed to find refund with ID %s: %v", razorpayRefundID, err)
+	}
+	
+	if refund == nil {
+		log.Printf("No refund found with Razorpay refund ID: %s", razorpayRefundID)
+		return nil
+	}
+
+	if eventType == "refund.processed" {
+		refund.Status = model.RefundStatusProcessed
+	} else {
+		refund.Status = model.RefundStatusFailed
+		if reason, ok := entity["error_description"].(string); ok {
+			refund.FailureReason = toNullString(reason)
+		}
+	}
+
+	if err := s.refundRepo.Update(ctx, refund); err != nil {
+		log.Printf("Failed to update refund: %v", err)
+		return fmt.Errorf("failed to update refund: %v", err)
+	}
+	
+	log.Printf("Refund %s marked %s", refund.ID, refund.Status)
 	return nil
 }
\ No newline at end of file
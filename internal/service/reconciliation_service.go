@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"subscription-management/internal/config"
+	"subscription-management/internal/razorpay"
+	"subscription-management/internal/repository"
+)
+
+const reconcilePageSize = 100
+
+// ReconciliationService repairs what compensation could not. Creating a
+// subscription creates its Razorpay subscription first; when saving then
+// fails and cancelling the Razorpay subscription fails too, the customer would
+// be billed for a subscription that does not exist here.
+type ReconciliationService interface {
+	ReconcileGatewaySubscriptions(ctx context.Context) error
+}
+
+type DefaultReconciliationService struct {
+	subscriptionRepo repository.SubscriptionRepository
+	razorpayClient   *razorpay.Client
+	config           config.ReconcilerConfig
+}
+
+func NewReconciliationService(
+	subscriptionRepo repository.SubscriptionRepository,
+	razorpayClient *razorpay.Client,
+	config config.ReconcilerConfig,
+) ReconciliationService {
+	return &DefaultReconciliationService{
+		subscriptionRepo: subscriptionRepo,
+		razorpayClient:   razorpayClient,
+		config:           config,
+	}
+}
+
+// ReconcileGatewaySubscriptions cancels the Razorpay subscriptions created by
+// this service within the configured window that no saved subscription
+// refers to. Subscriptions created elsewhere, without our subscription_id
+// note, are never touched.
+func (s *DefaultReconciliationService) ReconcileGatewaySubscriptions(ctx context.Context) error {
+	now := time.Now()
+	settled := now.Add(-s.config.Grace)
+
+	cancelled := 0
+	for skip := 0; ; skip += reconcilePageSize {
+		page, err := s.razorpayClient.ListSubscriptions(ctx, now.Add(-s.config.Window), reconcilePageSize, skip)
+		if err != nil {
+			return err
+		}
+
+		for _, gatewaySub := range page {
+			orphaned, err := s.isOrphaned(ctx, gatewaySub, settled)
+			if err != nil {
+				return err
+			}
+			if !orphaned {
+				continue
+			}
+
+			razorpaySubID, _ := gatewaySub["id"].(string)
+			if _, err := s.razorpayClient.CancelSubscription(ctx, razorpaySubID, false); err != nil {
+				log.Printf("Failed to cancel orphaned Razorpay subscription %s: %v", razorpaySubID, err)
+				continue
+			}
+			log.Printf("Cancelled orphaned Razorpay subscription %s", razorpaySubID)
+			cancelled++
+		}
+
+		if len(page) < reconcilePageSize {
+			break
+		}
+	}
+
+	if cancelled > 0 {
+		log.Printf("Reconciliation cancelled %d orphaned Razorpay subscriptions", cancelled)
+	}
+	return nil
+}
+
+// isOrphaned reports whether gatewaySub was created by this service before
+// settled, can still bill, and is not referred to by any subscription.
+func (s *DefaultReconciliationService) isOrphaned(ctx context.Context, gatewaySub map[string]interface{}, settled time.Time) (bool, error) {
+	razorpaySubID, _ := gatewaySub["id"].(string)
+	notes, _ := gatewaySub["notes"].(map[string]interface{})
+	subscriptionID, _ := notes["subscription_id"].(string)
+	if razorpaySubID == "" || subscriptionID == "" {
+		return false, nil
+	}
+
+	switch status, _ := gatewaySub["status"].(string); status {
+	case "cancelled", "completed", "expired":
+		return false, nil
+	}
+
+	createdAt, _ := gatewaySub["created_at"].(float64)
+	if time.Unix(int64(createdAt), 0).After(settled) {
+		return false, nil
+	}
+
+	subscription, err := s.subscriptionRepo.GetSubscriptionByRazorpaySubscriptionID(ctx, razorpaySubID)
+	if err != nil {
+		return false, err
+	}
+	if subscription != nil {
+		return false, nil
+	}
+
+	log.Printf("Razorpay subscription %s of subscription %s has no saved subscription", razorpaySubID, subscriptionID)
+	return true, nil
+}
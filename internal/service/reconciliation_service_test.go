@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"subscription-management/internal/config"
+	"subscription-management/internal/model"
+	"subscription-management/internal/repository"
+)
+
+// memSubscriptionRepository serves saved subscriptions by their Razorpay
+// subscription ID. Only that lookup is implemented; the embedded interface
+// panics on any other method.
+type memSubscriptionRepository struct {
+	repository.SubscriptionRepository
+	byRazorpayID map[string]*model.SubscriptionTransaction
+	err          error
+}
+
+func (r *memSubscriptionRepository) GetSubscriptionByRazorpaySubscriptionID(ctx context.Context, subscriptionID string) (*model.SubscriptionTransaction, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.byRazorpayID[subscriptionID], nil
+}
+
+// gatewaySubscription builds a Razorpay subscription as ListSubscriptions
+// returns it, with JSON numbers decoded as float64.
+func gatewaySubscription(id string, notes map[string]interface{}, status string, createdAt time.Time) map[string]interface{} {
+	sub := map[string]interface{}{
+		"id":         id,
+		"status":     status,
+		"created_at": float64(createdAt.Unix()),
+	}
+	if notes != nil {
+		sub["notes"] = notes
+	}
+	return sub
+}
+
+func TestIsOrphaned(t *testing.T) {
+	now := time.Now()
+	settled := now.Add(-time.Hour)
+	ours := map[string]interface{}{"subscription_id": "sub-1"}
+	repo := &memSubscriptionRepository{byRazorpayID: map[string]*model.SubscriptionTransaction{
+		"sub_saved": {ID: "sub-1"},
+	}}
+	s := NewReconciliationService(repo, nil, config.ReconcilerConfig{Grace: time.Hour}).(*DefaultReconciliationService)
+
+	tests := []struct {
+		name       string
+		gatewaySub map[string]interface{}
+		want       bool
+	}{
+		{"active and never saved", gatewaySubscription("sub_lost", ours, "active", now.Add(-2*time.Hour)), true},
+		{"created and never saved", gatewaySubscription("sub_lost", ours, "created", now.Add(-2*time.Hour)), true},
+		{"saved", gatewaySubscription("sub_saved", ours, "active", now.Add(-2*time.Hour)), false},
+		{"created within the grace period", gatewaySubscription("sub_lost", ours, "active", now.Add(-time.Minute)), false},
+		{"cancelled", gatewaySubscription("sub_lost", ours, "cancelled", now.Add(-2*time.Hour)), false},
+		{"completed", gatewaySubscription("sub_lost", ours, "completed", now.Add(-2*time.Hour)), false},
+		{"expired", gatewaySubscription("sub_lost", ours, "expired", now.Add(-2*time.Hour)), false},
+		{"created elsewhere without notes", gatewaySubscription("sub_other", nil, "active", now.Add(-2*time.Hour)), false},
+		{"created elsewhere with other notes", gatewaySubscription("sub_other", map[string]interface{}{"order": "42"}, "active", now.Add(-2*time.Hour)), false},
+		{"missing id", gatewaySubscription("", ours, "active", now.Add(-2*time.Hour)), false},
+	}
+
+	for _, tt := range tests {
+		got, err := s.isOrphaned(context.Background(), tt.gatewaySub, settled)
+		if err != nil {
+			t.Errorf("%s: isOrphaned: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: isOrphaned = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIsOrphanedLookupFails(t *testing.T) {
+	lookupErr := errors.New("connection refused")
+	repo := &memSubscriptionRepository{err: lookupErr}
+	s := NewReconciliationService(repo, nil, config.ReconcilerConfig{Grace: time.Hour}).(*DefaultReconciliationService)
+
+	gatewaySub := gatewaySubscription("sub_lost", map[string]interface{}{"subscription_id": "sub-1"}, "active", time.Now().Add(-2*time.Hour))
+	orphaned, err := s.isOrphaned(context.Background(), gatewaySub, time.Now().Add(-time.Hour))
+	if !errors.Is(err, lookupErr) || orphaned {
+		t.Errorf("isOrphaned = %v, %v; want false and the lookup error, so nothing is cancelled", orphaned, err)
+	}
+}
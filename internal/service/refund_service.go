@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"log"
+
+	"github.com/google/uuid"
+
+	"subscription-management/internal/apperr"
+	"subscription-management/internal/model"
+	"subscription-management/internal/money"
+	"subscription-management/internal/repository"
+)
+
+var (
+	ErrInvalidRefundAmount  = apperr.New(apperr.Invalid, "invalid_refund_amount", "refund amount must be greater than zero")
+	ErrRefundExceedsPayment = apperr.New(apperr.Invalid, "refund_exceeds_payment", "refund amount exceeds the refundable balance")
+	ErrRefundReasonRequired = apperr.New(apperr.Invalid, "refund_reason_required", "refund reason is required")
+)
+
+type RefundService interface {
+	CreateRefund(ctx context.Context, subscriptionID string, userID string, request *model.RefundRequest) (*model.Refund, error)
+	GetRefunds(ctx context.Context, subscriptionID string, userID string) ([]model.Refund, error)
+	IssueRefund(ctx context.Context, subscription *model.SubscriptionTransaction, amount money.Money, reason string) (*model.Refund, error)
+	GetRefundableAmount(ctx context.Context, subscription *model.SubscriptionTransaction) (money.Money, error)
+}
+
+type DefaultRefundService struct {
+	refundRepo       repository.RefundRepository
+	subscriptionRepo repository.SubscriptionRepository
+	razorpayService  RazorpayService
+}
+
+func NewRefundService(
+	refundRepo repository.RefundRepository,
+	subscriptionRepo repository.SubscriptionRepository,
+	razorpayService RazorpayService,
+) RefundService {
+	return &DefaultRefundService{
+		refundRepo:       refundRepo,
+		subscriptionRepo: subscriptionRepo,
+		razorpayService:  razorpayService,
+	}
+}
+
+func (s *DefaultRefundService) CreateRefund(ctx context.Context, subscriptionID string, userID string, request *model.RefundRequest) (*model.Refund, error) {
+	if request.Reason == "" {
+		return nil, ErrRefundReasonRequired
+	}
+
+	subscription, err := s.subscriptionRepo.GetSubscriptionByID(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if subscription == nil {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	if subscription.UserID != userID {
+		return nil, ErrUnauthorized
+	}
+
+	if !subscription.RazorpayPaymentID.Valid || subscription.RazorpayPaymentID.String == "" {
+		return nil, ErrNoPaymentToRefund
+	}
+
+	refundable, err := s.GetRefundableAmount(ctx, subscription)
+	if err != nil {
+		return nil, err
+	}
+
+	amount := refundable
+	if request.Amount != nil {
+		amount = money.New(*request.Amount, subscription.Currency)
+	}
+
+	if !amount.IsPositive() {
+		return nil, ErrInvalidRefundAmount
+	}
+
+	if amount.Cmp(refundable) > 0 {
+		return nil, ErrRefundExceedsPayment
+	}
+
+	return s.IssueRefund(ctx, subscription, amount, request.Reason)
+}
+
+// GetRefundableAmount returns what is left of the subscription's captured
+// payment after the refunds already issued against it.
+func (s *DefaultRefundService) GetRefundableAmount(ctx context.Context, subscription *model.SubscriptionTransaction) (money.Money, error) {
+	refunded, err := s.refundRepo.GetRefundedAmount(ctx, subscription.RazorpayPaymentID.String, subscription.Currency)
+	if err != nil {
+		return money.Money{}, err
+	}
+	return subscription.Amount.Sub(refunded), nil
+}
+
+// IssueRefund records a refund against the subscription's captured payment and
+// submits it to Razorpay. Callers are responsible for ownership and amount checks.
+func (s *DefaultRefundService) IssueRefund(ctx context.Context, subscription *model.SubscriptionTransaction, amount money.Money, reason string) (*model.Refund, error) {
+	refund := &model.Refund{
+		ID:                uuid.New().String(),
+		SubscriptionID:    subscription.ID,
+		UserID:            subscription.UserID,
+		RazorpayPaymentID: subscription.RazorpayPaymentID.String,
+		Amount:            amount,
+		Currency:          amount.Currency,
+		Reason:            reason,
+		Status:            model.RefundStatusPending,
+	}
+
+	if err := s.refundRepo.Create(ctx, refund); err != nil {
+		return nil, err
+	}
+
+	razorpayRefund, err := s.razorpayService.RefundPayment(ctx, refund.RazorpayPaymentID, amount, map[string]interface{}{
+		"refund_id":       refund.ID,
+		"subscription_id": subscription.ID,
+		"reason":          reason,
+	})
+	if err != nil {
+		refund.Status = model.RefundStatusFailed
+		refund.FailureReason = toNullString(err.Error())
+		if updateErr := s.refundRepo.Update(ctx, refund); updateErr != nil {
+			log.Printf("Failed to mark refund %s as failed: %v", refund.ID, updateErr)
+		}
+		return nil, err
+	}
+
+	if razorpayRefundID, ok := razorpayRefund["id"].(string); ok {
+		refund.RazorpayRefundID = toNullString(razorpayRefundID)
+	}
+	if status, ok := razorpayRefund["status"].(string); ok && status == model.RefundStatusProcessed {
+		refund.Status = model.RefundStatusProcessed
+	}
+
+	if err := s.refundRepo.Update(ctx, refund); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Refund %s of %s issued for subscription %s", refund.ID, amount, subscription.ID)
+	return refund, nil
+}
+
+func (s *DefaultRefundService) GetRefunds(ctx context.Context, subscriptionID string, userID string) ([]model.Refund, error) {
+	subscription, err := s.subscriptionRepo.GetSubscriptionByID(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if subscription == nil {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	if subscription.UserID != userID {
+		return nil, ErrUnauthorized
+	}
+
+	return s.refundRepo.GetBySubscriptionID(ctx, subscriptionID)
+}
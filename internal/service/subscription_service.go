@@ -3,49 +3,86 @@ package service
 import (
 	"context"
 	"database/sql"
-	"errors"
+	"strings"
 	"time"
 	"log"
 	"github.com/google/uuid"
 
+	"subscription-management/internal/apperr"
 	"subscription-management/internal/model"
+	"subscription-management/internal/money"
 	"subscription-management/internal/repository"
 	"subscription-management/internal/config"
+	"subscription-management/internal/tax"
 )
 
 var (
-    ErrInvalidPlan          = errors.New("invalid subscription plan")
-    ErrInvalidCard          = errors.New("invalid card")
-    ErrInvalidPaymentType   = errors.New("payment type must be 'monthly' or 'yearly'")
-    ErrSubscriptionNotFound = errors.New("subscription not found")
+    ErrInvalidPlan               = apperr.New(apperr.Invalid, "invalid_plan", "invalid subscription plan")
+    ErrInvalidCard               = apperr.New(apperr.Invalid, "invalid_card", "invalid card")
+    ErrInvalidPaymentType        = apperr.New(apperr.Invalid, "invalid_payment_type", "payment type must be 'monthly' or 'yearly'")
+    ErrSubscriptionNotFound      = apperr.New(apperr.NotFound, "subscription_not_found", "subscription not found")
+    ErrSubscriptionNotActive     = apperr.New(apperr.Conflict, "subscription_not_active", "subscription is not active")
+    ErrSubscriptionNotPaused     = apperr.New(apperr.Conflict, "subscription_not_paused", "subscription is not paused")
+    ErrInvalidResumeDate         = apperr.New(apperr.Invalid, "invalid_resume_date", "resume date must be in the future")
+    ErrInvalidCancelMode         = apperr.New(apperr.Invalid, "invalid_cancel_mode", "cancel mode must be 'immediate' or 'period_end'")
+    ErrRefundNotAllowed          = apperr.New(apperr.Invalid, "refund_not_allowed", "refunds are only issued for immediate cancellation")
+    ErrNoPaymentToRefund         = apperr.New(apperr.Conflict, "no_payment_to_refund", "subscription has no captured payment to refund")
+    ErrCancellationNotScheduled  = apperr.New(apperr.Conflict, "cancellation_not_scheduled", "subscription has no scheduled cancellation")
+    ErrCancellationNotReversible = apperr.New(apperr.Conflict, "cancellation_not_reversible", "cancellation has already been sent to the payment gateway")
+    ErrCurrencyNotSupported      = apperr.New(apperr.Invalid, "currency_not_supported", "plan is not available in the requested currency")
+    ErrFundingTypeNotAllowed     = apperr.New(apperr.Invalid, "funding_type_not_allowed", "plan does not accept this type of card")
+    ErrCardExpired               = apperr.New(apperr.Invalid, "card_expired", "card has expired")
+    ErrPlanProductMismatch       = apperr.New(apperr.Invalid, "plan_product_mismatch", "plan does not belong to the requested product")
 )
 
 type DefaultSubscriptionService struct {
 	subscriptionRepo repository.SubscriptionRepository
 	cardRepo         repository.CardRepository
 	razorpayService  RazorpayService
+	refundService    RefundService
+	customerService  CustomerService
+	outboxRepo       repository.OutboxRepository
+	transactor       repository.Transactor
+	taxCalculator    *tax.Calculator
 	config           *config.Config
 }
 
 type SubscriptionService interface {
 	GetAvailablePlans(ctx context.Context) ([]model.SubscriptionPlan, error)
+	GetPlan(ctx context.Context, planID string) (*model.SubscriptionPlan, error)
 	GetActiveSubscription(ctx context.Context, userID string) (*model.SubscriptionTransaction, error)
 	GetSubscriptionHistory(ctx context.Context, userID string) ([]model.SubscriptionTransaction, error)
 	CreateSubscription(ctx context.Context, request *model.SubscriptionRequest, userInfo *model.UserInfo) (*model.SubscriptionTransaction, error)
 	RenewSubscription(ctx context.Context, subscriptionID string, userID string) (*model.SubscriptionTransaction, error)
-	StopSubscription(ctx context.Context, subscriptionID string, userID string) error
+	StopSubscription(ctx context.Context, subscriptionID string, userID string, options model.CancelOptions) (*model.CancellationResult, error)
+	UndoCancellation(ctx context.Context, subscriptionID string, userID string) (*model.SubscriptionTransaction, error)
+	ProcessScheduledCancellations(ctx context.Context) error
+	PauseSubscription(ctx context.Context, subscriptionID string, userID string, resumeAt *time.Time) (*model.SubscriptionTransaction, error)
+	ResumeSubscription(ctx context.Context, subscriptionID string, userID string) (*model.SubscriptionTransaction, error)
+	ChangeCard(ctx context.Context, subscriptionID string, userID string, cardID string) (*model.CardChangeResult, error)
+	ProcessScheduledResumes(ctx context.Context) error
 }
 
 func NewSubscriptionService(
 	subscriptionRepo repository.SubscriptionRepository,
 	cardRepo repository.CardRepository,
 	razorpayService RazorpayService,
+	refundService RefundService,
+	customerService CustomerService,
+	outboxRepo repository.OutboxRepository,
+	transactor repository.Transactor,
+	taxCalculator *tax.Calculator,
 	config *config.Config,
 ) SubscriptionService {
 	return &DefaultSubscriptionService{
 		subscriptionRepo: subscriptionRepo,
 		cardRepo:         cardRepo,
 		razorpayService:  razorpayService,
+		refundService:    refundService,
+		customerService:  customerService,
+		outboxRepo:       outboxRepo,
+		transactor:       transactor,
+		taxCalculator:    taxCalculator,
 		config:           config,
 	}
 }
@@ -54,6 +91,19 @@ func (s *DefaultSubscriptionService) GetAvailablePlans(ctx context.Context) ([]m
     return s.subscriptionRepo.GetPlans(ctx, "")
 }
 
+// GetPlan returns the plan with the given ID, or ErrInvalidPlan when there is
+// no such plan.
+func (s *DefaultSubscriptionService) GetPlan(ctx context.Context, planID string) (*model.SubscriptionPlan, error) {
+	planWithAttrs, err := s.subscriptionRepo.GetPlanWithAttributes(ctx, planID)
+	if err != nil {
+		return nil, err
+	}
+	if planWithAttrs == nil {
+		return nil, ErrInvalidPlan
+	}
+	return &planWithAttrs.Plan, nil
+}
+
 func (s *DefaultSubscriptionService) GetActiveSubscription(ctx context.Context, userID string) (*model.SubscriptionTransaction, error) {
 	return s.subscriptionRepo.GetActiveSubscription(ctx, userID)
 }
@@ -75,7 +125,7 @@ func (s *DefaultSubscriptionService) CreateSubscription(ctx context.Context, req
         log.Println("Error getting card:", err)
         return nil, err
     }
-    if card == nil {
+    if card == nil || card.DeletedAt.Valid {
         log.Println("Card not found:", request.CardID)
         return nil, ErrInvalidCard
     }
@@ -83,6 +133,10 @@ func (s *DefaultSubscriptionService) CreateSubscription(ctx context.Context, req
         log.Println("Card doesn't belong to user. CardUserID:", card.UserID, "RequestUserID:", request.UserID)
         return nil, ErrInvalidCard
     }
+    if card.IsExpired || !card.ExpiresAt().After(time.Now()) {
+        log.Println("Card has expired:", request.CardID)
+        return nil, ErrCardExpired
+    }
     log.Println("Card validation successful")
 
     planWithAttrs, err := s.subscriptionRepo.GetPlanWithAttributes(ctx, request.PlanID)
@@ -94,24 +148,65 @@ func (s *DefaultSubscriptionService) CreateSubscription(ctx context.Context, req
         log.Println("Plan not found:", request.PlanID)
         return nil, ErrInvalidPlan
     }
+    // The plan decides the product: a subscription must never record a product
+    // its plan is not sold under.
+    if request.ProductID == "" {
+        request.ProductID = planWithAttrs.Plan.ProductID
+    } else if request.ProductID != planWithAttrs.Plan.ProductID {
+        log.Println("Plan", request.PlanID, "belongs to product", planWithAttrs.Plan.ProductID, "not", request.ProductID)
+        return nil, ErrPlanProductMismatch
+    }
+    if !planWithAttrs.Plan.AllowedFundingTypes.Allows(card.FundingType) {
+        log.Println("Card funding type not accepted by plan:", card.FundingType, planWithAttrs.Plan.AllowedFundingTypes)
+        return nil, ErrFundingTypeNotAllowed
+    }
     log.Println("Plan validation successful")
 
-    var amount float64
+    if userInfo == nil {
+        userInfo = &model.UserInfo{}
+    }
+    userInfo.ID = request.UserID
+    customer, err := s.customerService.ResolveCustomer(ctx, userInfo)
+    if err != nil {
+        log.Println("Error resolving customer:", err)
+        return nil, err
+    }
+
+    currency := resolveCurrency(request, customer)
+    if !money.Supported(currency) {
+        return nil, ErrCurrencyNotSupported
+    }
+    price, err := s.subscriptionRepo.GetPlanPrice(ctx, request.PlanID, currency, request.PaymentType)
+    if err != nil {
+        log.Println("Error getting plan price:", err)
+        return nil, err
+    }
+    if price == nil {
+        log.Println("Plan", request.PlanID, "has no", request.PaymentType, "price in", currency)
+        return nil, ErrCurrencyNotSupported
+    }
+
+    amount := price.Amount
     var startDate, endDate, nextRenewalDate time.Time
     
     startDate = time.Now()
     
     if request.PaymentType == "monthly" {
-        amount = planWithAttrs.Plan.PriceMonthly
         endDate = startDate.AddDate(0, 1, 0)
     } else { 
-        amount = planWithAttrs.Plan.PriceYearly
         endDate = startDate.AddDate(1, 0, 0)
     }
 
     nextRenewalDate = endDate
     log.Println("Calculated dates - Start:", startDate, "End:", endDate, "Next Renewal:", nextRenewalDate)
 
+    taxResult := s.taxCalculator.Calculate(amount, tax.Address{
+        Country: request.BillingCountry,
+        State:   request.BillingState,
+    })
+    log.Printf("Calculated tax (%s): exclusive %s, tax %s, inclusive %s",
+        taxResult.Regime, taxResult.ExclusiveAmount, taxResult.TaxAmount, taxResult.InclusiveAmount)
+
     subscription := &model.SubscriptionTransaction{
         ID:              uuid.New().String(), 
         UserID:          request.UserID,
@@ -121,7 +216,13 @@ func (s *DefaultSubscriptionService) CreateSubscription(ctx context.Context, req
         IsRenewal:       false,
         IsActive:        true,
         PaymentType:     request.PaymentType,
-        Amount:          amount,
+        Currency:        taxResult.InclusiveAmount.Currency,
+        Amount:          taxResult.InclusiveAmount,
+        AmountExclusive: taxResult.ExclusiveAmount,
+        TaxAmount:       taxResult.TaxAmount,
+        TaxBreakdown:    taxResult.Breakdown,
+        BillingCountry:  toNullString(taxResult.Billing.Country),
+        BillingState:    toNullString(taxResult.Billing.State),
         StartDate:       startDate,
         EndDate:         endDate,
         NextRenewalDate: nextRenewalDate,
@@ -147,7 +248,7 @@ func (s *DefaultSubscriptionService) CreateSubscription(ctx context.Context, req
     } else {
         if request.AutoRenewal {
             log.Println("Setting up auto-renewal with Razorpay")
-            razorpaySub, err := s.razorpayService.CreateSubscription(ctx, subscription, userInfo)
+            razorpaySub, err := s.razorpayService.CreateSubscription(ctx, subscription, customer)
             if err != nil {
                 log.Println("Error creating Razorpay subscription:", err)
                 return nil, err
@@ -165,7 +266,6 @@ func (s *DefaultSubscriptionService) CreateSubscription(ctx context.Context, req
             order, err := s.razorpayService.CreatePayment(
                 ctx, 
                 subscription.Amount, 
-                "INR", 
                 subscription.ID, 
             )
             
@@ -184,8 +284,15 @@ func (s *DefaultSubscriptionService) CreateSubscription(ctx context.Context, req
     }
     
     log.Println("Saving subscription to database")
-    if err := s.subscriptionRepo.CreateSubscription(ctx, subscription); err != nil {
+    err = s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+        if err := s.subscriptionRepo.CreateSubscription(ctx, subscription); err != nil {
+            return err
+        }
+        return recordSubscriptionEvent(ctx, s.outboxRepo, model.EventSubscriptionCreated, subscription, nil)
+    })
+    if err != nil {
         log.Println("Error saving subscription:", err)
+        s.releaseGatewaySubscription(ctx, subscription)
         return nil, err
     }
     
@@ -193,6 +300,37 @@ func (s *DefaultSubscriptionService) CreateSubscription(ctx context.Context, req
     return s.subscriptionRepo.GetSubscriptionByID(ctx, subscription.ID)
 }
 
+// releaseGatewaySubscription cancels the Razorpay subscription created for a
+// subscription that could not be saved, so the customer is never billed for
+// it. If the cancellation fails too, the reconciler cancels it later. Orders
+// need no compensation: they bill nothing unless paid, and expire unpaid.
+func (s *DefaultSubscriptionService) releaseGatewaySubscription(ctx context.Context, subscription *model.SubscriptionTransaction) {
+    if !subscription.RazorpaySubscriptionID.Valid || subscription.RazorpaySubscriptionID.String == "" {
+        return
+    }
+
+    razorpaySubID := subscription.RazorpaySubscriptionID.String
+    if err := s.razorpayService.CancelSubscription(context.WithoutCancel(ctx), razorpaySubID); err != nil {
+        log.Printf("Failed to cancel Razorpay subscription %s of unsaved subscription %s, leaving it to the reconciler: %v",
+            razorpaySubID, subscription.ID, err)
+        return
+    }
+    log.Printf("Cancelled Razorpay subscription %s of unsaved subscription %s", razorpaySubID, subscription.ID)
+}
+
+// resolveCurrency picks the billing currency: the request wins, then the
+// customer's profile, then the default.
+func resolveCurrency(request *model.SubscriptionRequest, userInfo *model.UserInfo) string {
+    currency := request.Currency
+    if currency == "" && userInfo != nil {
+        currency = userInfo.Currency
+    }
+    if currency == "" {
+        currency = money.DefaultCurrency
+    }
+    return strings.ToUpper(strings.TrimSpace(currency))
+}
+
 func (s *DefaultSubscriptionService) RenewSubscription(ctx context.Context, subscriptionID string, userID string) (*model.SubscriptionTransaction, error) {
     subscription, err := s.subscriptionRepo.GetSubscriptionByID(ctx, subscriptionID)
     if err != nil {
@@ -216,7 +354,13 @@ func (s *DefaultSubscriptionService) RenewSubscription(ctx context.Context, subs
         IsRenewal:       true,
         IsActive:        true,
         PaymentType:     subscription.PaymentType,
+        Currency:        subscription.Currency,
         Amount:          subscription.Amount,
+        AmountExclusive: subscription.AmountExclusive,
+        TaxAmount:       subscription.TaxAmount,
+        TaxBreakdown:    subscription.TaxBreakdown,
+        BillingCountry:  subscription.BillingCountry,
+        BillingState:    subscription.BillingState,
         StartDate:       time.Now(),
         EndDate:         time.Now().AddDate(0, 1, 0), 
         NextRenewalDate: time.Now().AddDate(0, 1, 0),
@@ -227,7 +371,14 @@ func (s *DefaultSubscriptionService) RenewSubscription(ctx context.Context, subs
     }
     
     
-    err = s.subscriptionRepo.CreateSubscription(ctx, newSubscription)
+    err = s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+        if err := s.subscriptionRepo.CreateSubscription(ctx, newSubscription); err != nil {
+            return err
+        }
+        return recordSubscriptionEvent(ctx, s.outboxRepo, model.EventSubscriptionRenewed, newSubscription, map[string]interface{}{
+            "previousSubscriptionId": subscription.ID,
+        })
+    })
     if err != nil {
         return nil, err
     }
@@ -235,26 +386,385 @@ func (s *DefaultSubscriptionService) RenewSubscription(ctx context.Context, subs
     return s.subscriptionRepo.GetSubscriptionByID(ctx, newSubscription.ID)
 }
 
-func (s *DefaultSubscriptionService) StopSubscription(ctx context.Context, subscriptionID string, userID string) error {
+func (s *DefaultSubscriptionService) StopSubscription(ctx context.Context, subscriptionID string, userID string, options model.CancelOptions) (*model.CancellationResult, error) {
+	
+	subscription, err := s.subscriptionRepo.GetSubscriptionByID(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	
+	if subscription == nil {
+		return nil, ErrSubscriptionNotFound
+	}
+	
+	if subscription.UserID != userID {
+		return nil, ErrUnauthorized
+	}
+	
+	if !subscription.IsActive {
+		return nil, ErrSubscriptionNotActive
+	}
+	
+	switch options.Mode {
+	case model.CancelModePeriodEnd:
+		if options.Refund {
+			return nil, ErrRefundNotAllowed
+		}
+		return s.scheduleCancellation(ctx, subscription)
+	case model.CancelModeImmediate, "":
+		return s.cancelImmediately(ctx, subscription, options.Refund)
+	default:
+		return nil, ErrInvalidCancelMode
+	}
+}
+
+func (s *DefaultSubscriptionService) scheduleCancellation(ctx context.Context, subscription *model.SubscriptionTransaction) (*model.CancellationResult, error) {
+	if !subscription.CancelAtPeriodEnd {
+		subscription.CancelAtPeriodEnd = true
+		subscription.CancelAt = sql.NullTime{Time: subscription.EndDate, Valid: true}
+		if err := s.subscriptionRepo.UpdateSubscription(ctx, subscription); err != nil {
+			return nil, err
+		}
+		log.Printf("Subscription %s scheduled for cancellation at %s", subscription.ID, subscription.EndDate)
+	}
+	
+	return &model.CancellationResult{Subscription: subscription}, nil
+}
+
+func (s *DefaultSubscriptionService) cancelImmediately(ctx context.Context, subscription *model.SubscriptionTransaction, refund bool) (*model.CancellationResult, error) {
+	refundAmount := money.Zero(subscription.Currency)
+	if refund {
+		if !subscription.RazorpayPaymentID.Valid || subscription.RazorpayPaymentID.String == "" {
+			return nil, ErrNoPaymentToRefund
+		}
+		refundable, err := s.refundService.GetRefundableAmount(ctx, subscription)
+		if err != nil {
+			return nil, err
+		}
+		refundAmount = proratedRefundAmount(subscription, time.Now())
+		if refundAmount.Cmp(refundable) > 0 {
+			refundAmount = refundable
+		}
+	}
+	
+	if hasGatewayRenewal(subscription) {
+		if err := s.razorpayService.CancelSubscription(ctx, subscription.RazorpaySubscriptionID.String); err != nil {
+			return nil, err
+		}
+	}
+	
+	if err := stopSubscription(ctx, s.transactor, s.subscriptionRepo, s.outboxRepo, subscription, CancellationReasonCustomer); err != nil {
+		return nil, err
+	}
+	
+	// The cancellation is committed, so a failed refund is reported in the
+	// result rather than as an error; the refund endpoint can retry it.
+	result := &model.CancellationResult{}
+	if refundAmount.IsPositive() {
+		result.RefundAmount = &refundAmount
+		refund, err := s.refundService.IssueRefund(ctx, subscription, refundAmount, "prorated cancellation refund")
+		if err != nil {
+			log.Printf("Subscription %s cancelled but prorated refund failed: %v", subscription.ID, err)
+			result.RefundFailed = true
+		} else {
+			result.RefundID = refund.ID
+		}
+	}
+	
+	updated, err := s.subscriptionRepo.GetSubscriptionByID(ctx, subscription.ID)
+	if err != nil {
+		return nil, err
+	}
+	result.Subscription = updated
 	
+	return result, nil
+}
+
+func (s *DefaultSubscriptionService) UndoCancellation(ctx context.Context, subscriptionID string, userID string) (*model.SubscriptionTransaction, error) {
 	subscription, err := s.subscriptionRepo.GetSubscriptionByID(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	
+	if subscription == nil {
+		return nil, ErrSubscriptionNotFound
+	}
+	
+	if subscription.UserID != userID {
+		return nil, ErrUnauthorized
+	}
+	
+	if !subscription.IsActive || !subscription.CancelAtPeriodEnd {
+		return nil, ErrCancellationNotScheduled
+	}
+	
+	if subscription.RazorpaySubscriptionID.Valid && subscription.RazorpaySubscriptionID.String != "" && !subscription.AutoRenewal {
+		return nil, ErrCancellationNotReversible
+	}
+	
+	subscription.CancelAtPeriodEnd = false
+	subscription.CancelAt = sql.NullTime{}
+	if err := s.subscriptionRepo.UpdateSubscription(ctx, subscription); err != nil {
+		return nil, err
+	}
+	
+	log.Printf("Scheduled cancellation undone for subscription %s", subscription.ID)
+	return subscription, nil
+}
+
+// ProcessScheduledCancellations stops Razorpay renewals shortly before the
+// period ends and deactivates subscriptions once their paid period is over.
+// Gateway cancellation is deferred until then so it can still be undone.
+func (s *DefaultSubscriptionService) ProcessScheduledCancellations(ctx context.Context) error {
+	now := time.Now()
+	subscriptions, err := s.subscriptionRepo.GetScheduledCancellations(ctx, now.Add(s.config.Scheduler.CancellationLead))
 	if err != nil {
 		return err
 	}
 	
+	for i := range subscriptions {
+		subscription := &subscriptions[i]
+		
+		if hasGatewayRenewal(subscription) {
+			if err := s.razorpayService.CancelSubscription(ctx, subscription.RazorpaySubscriptionID.String); err != nil {
+				log.Printf("Failed to cancel Razorpay renewal for subscription %s: %v", subscription.ID, err)
+				continue
+			}
+			subscription.AutoRenewal = false
+			if err := s.subscriptionRepo.UpdateSubscription(ctx, subscription); err != nil {
+				log.Printf("Failed to update subscription %s: %v", subscription.ID, err)
+				continue
+			}
+		}
+		
+		if subscription.CancelAt.Time.After(now) {
+			continue
+		}
+		
+		if err := stopSubscription(ctx, s.transactor, s.subscriptionRepo, s.outboxRepo, subscription, CancellationReasonPeriodEnd); err != nil {
+			log.Printf("Failed to stop subscription %s at period end: %v", subscription.ID, err)
+			continue
+		}
+		log.Printf("Subscription %s cancelled at period end", subscription.ID)
+	}
+	
+	return nil
+}
+
+func hasGatewayRenewal(subscription *model.SubscriptionTransaction) bool {
+	return subscription.RazorpaySubscriptionID.Valid &&
+		subscription.RazorpaySubscriptionID.String != "" &&
+		subscription.AutoRenewal
+}
+
+// proratedRefundAmount returns the unused share of the amount paid for the
+// current period, rounded down to the minor unit.
+func proratedRefundAmount(subscription *model.SubscriptionTransaction, now time.Time) money.Money {
+	total := subscription.EndDate.Sub(subscription.StartDate)
+	remaining := subscription.EndDate.Sub(now)
+	if total <= 0 || remaining <= 0 {
+		return money.Zero(subscription.Amount.Currency)
+	}
+	if remaining > total {
+		remaining = total
+	}
+	
+	return subscription.Amount.Prorate(int64(remaining/time.Second), int64(total/time.Second), money.RoundDown)
+}
+
+func (s *DefaultSubscriptionService) PauseSubscription(ctx context.Context, subscriptionID string, userID string, resumeAt *time.Time) (*model.SubscriptionTransaction, error) {
+	subscription, err := s.subscriptionRepo.GetSubscriptionByID(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	
 	if subscription == nil {
-		return ErrSubscriptionNotFound
+		return nil, ErrSubscriptionNotFound
 	}
 	
 	if subscription.UserID != userID {
-		return ErrUnauthorized
+		return nil, ErrUnauthorized
+	}
+	
+	if !subscription.IsActive || subscription.Status != model.SubscriptionStatusActive {
+		return nil, ErrSubscriptionNotActive
+	}
+	
+	now := time.Now()
+	if resumeAt != nil && !resumeAt.After(now) {
+		return nil, ErrInvalidResumeDate
 	}
 	
 	if subscription.RazorpaySubscriptionID.Valid && subscription.RazorpaySubscriptionID.String != "" {
-		if err := s.razorpayService.CancelSubscription(ctx, subscription.RazorpaySubscriptionID.String); err != nil {
+		if err := s.razorpayService.PauseSubscription(ctx, subscription.RazorpaySubscriptionID.String); err != nil {
+			return nil, err
+		}
+	}
+	
+	markPaused(subscription, now, resumeAt)
+	if err := s.subscriptionRepo.UpdateSubscription(ctx, subscription); err != nil {
+		return nil, err
+	}
+	
+	log.Printf("Subscription %s paused until %v", subscription.ID, subscription.ResumeAt.Time)
+	return subscription, nil
+}
+
+func (s *DefaultSubscriptionService) ResumeSubscription(ctx context.Context, subscriptionID string, userID string) (*model.SubscriptionTransaction, error) {
+	subscription, err := s.subscriptionRepo.GetSubscriptionByID(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	
+	if subscription == nil {
+		return nil, ErrSubscriptionNotFound
+	}
+	
+	if subscription.UserID != userID {
+		return nil, ErrUnauthorized
+	}
+	
+	if err := s.resume(ctx, subscription); err != nil {
+		return nil, err
+	}
+	
+	return subscription, nil
+}
+
+// ChangeCard moves a live subscription to another of the user's cards. When
+// Razorpay manages the renewals, the result carries the Checkout options the
+// customer uses to authenticate the new card with the gateway.
+func (s *DefaultSubscriptionService) ChangeCard(ctx context.Context, subscriptionID string, userID string, cardID string) (*model.CardChangeResult, error) {
+	subscription, err := s.subscriptionRepo.GetSubscriptionByID(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	
+	if subscription == nil {
+		return nil, ErrSubscriptionNotFound
+	}
+	
+	if subscription.UserID != userID {
+		return nil, ErrUnauthorized
+	}
+	
+	switch subscription.Status {
+	case model.SubscriptionStatusActive, model.SubscriptionStatusPastDue, model.SubscriptionStatusPaused:
+	default:
+		return nil, ErrSubscriptionNotActive
+	}
+	
+	card, err := s.cardRepo.GetByID(ctx, cardID)
+	if err != nil {
+		return nil, err
+	}
+	if card == nil || card.DeletedAt.Valid || card.UserID != userID {
+		return nil, ErrInvalidCard
+	}
+	if card.IsExpired || !card.ExpiresAt().After(time.Now()) {
+		return nil, ErrCardExpired
+	}
+	
+	planWithAttrs, err := s.subscriptionRepo.GetPlanWithAttributes(ctx, subscription.PlanID)
+	if err != nil {
+		return nil, err
+	}
+	if planWithAttrs != nil && !planWithAttrs.Plan.AllowedFundingTypes.Allows(card.FundingType) {
+		return nil, ErrFundingTypeNotAllowed
+	}
+	
+	result := &model.CardChangeResult{}
+	if subscription.RazorpaySubscriptionID.Valid && subscription.RazorpaySubscriptionID.String != "" {
+		checkout, err := s.razorpayService.PrepareCardChange(ctx, subscription.RazorpaySubscriptionID.String)
+		if err != nil {
+			return nil, err
+		}
+		checkout["key_id"] = s.config.Razorpay.KeyID
+		checkout["notes"] = map[string]string{
+			"subscription_id": subscription.ID,
+			"card_id":         card.ID,
+		}
+		result.Checkout = checkout
+		
+		// Razorpay keeps charging the old card until the customer has
+		// authenticated the new one, so the change waits for its webhook.
+		if err := s.subscriptionRepo.SetPendingCard(ctx, subscription.ID, card.ID); err != nil {
+			return nil, err
+		}
+		log.Printf("Subscription %s will move to card %s once Razorpay confirms it", subscription.ID, card.ID)
+	} else {
+		if err := s.subscriptionRepo.SetCard(ctx, subscription.ID, card.ID); err != nil {
+			return nil, err
+		}
+		log.Printf("Subscription %s moved to card %s", subscription.ID, card.ID)
+	}
+	result.Subscription, err = s.subscriptionRepo.GetSubscriptionByID(ctx, subscription.ID)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *DefaultSubscriptionService) ProcessScheduledResumes(ctx context.Context) error {
+	subscriptions, err := s.subscriptionRepo.GetSubscriptionsByStatus(ctx, model.SubscriptionStatusPaused)
+	if err != nil {
+		return err
+	}
+	
+	now := time.Now()
+	for i := range subscriptions {
+		subscription := &subscriptions[i]
+		if !subscription.ResumeAt.Valid || subscription.ResumeAt.Time.After(now) {
+			continue
+		}
+		
+		if err := s.resume(ctx, subscription); err != nil {
+			log.Printf("Failed to resume subscription %s: %v", subscription.ID, err)
+		}
+	}
+	
+	return nil
+}
+
+func (s *DefaultSubscriptionService) resume(ctx context.Context, subscription *model.SubscriptionTransaction) error {
+	if subscription.Status != model.SubscriptionStatusPaused {
+		return ErrSubscriptionNotPaused
+	}
+	
+	if subscription.RazorpaySubscriptionID.Valid && subscription.RazorpaySubscriptionID.String != "" {
+		if err := s.razorpayService.ResumeSubscription(ctx, subscription.RazorpaySubscriptionID.String); err != nil {
 			return err
 		}
 	}
 	
-	return s.subscriptionRepo.StopSubscription(ctx, subscriptionID, userID)
+	markResumed(subscription, time.Now())
+	if err := s.subscriptionRepo.UpdateSubscription(ctx, subscription); err != nil {
+		return err
+	}
+	
+	log.Printf("Subscription %s resumed, new end date %s", subscription.ID, subscription.EndDate)
+	return nil
+}
+
+func markPaused(subscription *model.SubscriptionTransaction, pausedAt time.Time, resumeAt *time.Time) {
+	subscription.Status = model.SubscriptionStatusPaused
+	subscription.PausedAt = sql.NullTime{Time: pausedAt, Valid: true}
+	subscription.ResumeAt = sql.NullTime{}
+	if resumeAt != nil {
+		subscription.ResumeAt = sql.NullTime{Time: *resumeAt, Valid: true}
+	}
+}
+
+// markResumed reactivates a paused subscription and pushes its billing dates
+// forward by the time spent paused, so the customer keeps the days they paid for.
+func markResumed(subscription *model.SubscriptionTransaction, resumedAt time.Time) {
+	if subscription.PausedAt.Valid {
+		pausedFor := resumedAt.Sub(subscription.PausedAt.Time)
+		subscription.EndDate = subscription.EndDate.Add(pausedFor)
+		subscription.NextRenewalDate = subscription.NextRenewalDate.Add(pausedFor)
+	}
+	
+	subscription.Status = model.SubscriptionStatusActive
+	subscription.PausedAt = sql.NullTime{}
+	subscription.ResumeAt = sql.NullTime{}
 }
\ No newline at end of file
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"testing"
+
+	"subscription-management/internal/model"
+)
+
+func TestResolveCurrency(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  string
+		customer *model.UserInfo
+		want     string
+	}{
+		{"request wins", "usd", &model.UserInfo{Currency: "EUR"}, "USD"},
+		{"profile when the request has none", "", &model.UserInfo{Currency: "EUR"}, "EUR"},
+		{"default without a profile", "", nil, "INR"},
+		{"default when the profile has none", "", &model.UserInfo{}, "INR"},
+		{"whitespace is trimmed", " jpy ", nil, "JPY"},
+	}
+
+	for _, tt := range tests {
+		got := resolveCurrency(&model.SubscriptionRequest{Currency: tt.request}, tt.customer)
+		if got != tt.want {
+			t.Errorf("%s: resolveCurrency(%q) = %q, want %q", tt.name, tt.request, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package tax
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"subscription-management/internal/config"
+	"subscription-management/internal/model"
+	"subscription-management/internal/money"
+)
+
+const (
+	RegimeGSTIntraState = "gst_intra_state"
+	RegimeGSTInterState = "gst_inter_state"
+	RegimeVAT           = "vat"
+	RegimeNone          = "none"
+)
+
+type Address struct {
+	Country string
+	State   string
+}
+
+type Result struct {
+	Billing         Address
+	Regime          string
+	ExclusiveAmount money.Money
+	TaxAmount       money.Money
+	InclusiveAmount money.Money
+	Breakdown       model.TaxBreakdown
+}
+
+type component struct {
+	name string
+	rate float64
+}
+
+type Calculator struct {
+	config config.TaxConfig
+}
+
+func NewCalculator(cfg config.TaxConfig) *Calculator {
+	return &Calculator{
+		config: cfg,
+	}
+}
+
+// Normalize fills in the seller's country and state when the billing address
+// omits them. Under GST the place of supply defaults to the supplier's location
+// when the recipient's address is not on record.
+func (c *Calculator) Normalize(billing Address) Address {
+	billing.Country = strings.ToUpper(strings.TrimSpace(billing.Country))
+	billing.State = strings.ToUpper(strings.TrimSpace(billing.State))
+
+	if billing.Country == "" {
+		billing.Country = c.config.SellerCountry
+	}
+	if billing.State == "" && billing.Country == c.config.SellerCountry {
+		billing.State = c.config.SellerState
+	}
+	return billing
+}
+
+// Calculate applies the tax regime for the billing address to a catalog price.
+// Each component is computed on the taxable value and rounded half up to the
+// minor unit; for tax-inclusive prices the last component absorbs any rounding
+// difference so the inclusive amount always equals the catalog price.
+func (c *Calculator) Calculate(price money.Money, billing Address) Result {
+	billing = c.Normalize(billing)
+	regime, components := c.components(billing)
+
+	var totalRate float64
+	for _, comp := range components {
+		totalRate += comp.rate
+	}
+
+	result := Result{
+		Billing:         billing,
+		Regime:          regime,
+		ExclusiveAmount: price,
+		TaxAmount:       money.Zero(price.Currency),
+	}
+	if c.config.PricesIncludeTax {
+		result.ExclusiveAmount = price.ExcludePercent(totalRate, money.RoundHalfUp)
+	}
+
+	for _, comp := range components {
+		line := model.TaxLine{
+			Name:   fmt.Sprintf("%s %s%%", comp.name, strconv.FormatFloat(comp.rate, 'f', -1, 64)),
+			Rate:   comp.rate,
+			Amount: result.ExclusiveAmount.Percent(comp.rate, money.RoundHalfUp),
+		}
+		result.Breakdown = append(result.Breakdown, line)
+		result.TaxAmount = result.TaxAmount.Add(line.Amount)
+	}
+
+	if c.config.PricesIncludeTax {
+		diff := price.Sub(result.ExclusiveAmount).Sub(result.TaxAmount)
+		if !diff.IsZero() && len(result.Breakdown) > 0 {
+			last := &result.Breakdown[len(result.Breakdown)-1]
+			last.Amount = last.Amount.Add(diff)
+			result.TaxAmount = result.TaxAmount.Add(diff)
+		}
+	}
+	result.InclusiveAmount = result.ExclusiveAmount.Add(result.TaxAmount)
+
+	return result
+}
+
+func (c *Calculator) components(billing Address) (string, []component) {
+	if billing.Country == "IN" && c.config.SellerCountry == "IN" {
+		if billing.State == c.config.SellerState {
+			half := c.config.GSTRate / 2
+			return RegimeGSTIntraState, []component{{"CGST", half}, {"SGST", half}}
+		}
+		return RegimeGSTInterState, []component{{"IGST", c.config.GSTRate}}
+	}
+
+	if rate, ok := c.config.VATRates[billing.Country]; ok && rate > 0 {
+		return RegimeVAT, []component{{"VAT", rate}}
+	}
+
+	return RegimeNone, nil
+}
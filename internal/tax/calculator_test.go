@@ -0,0 +1,187 @@
+package tax
+
+import (
+	"testing"
+
+	"subscription-management/internal/config"
+	"subscription-management/internal/money"
+)
+
+func testConfig(pricesIncludeTax bool) config.TaxConfig {
+	return config.TaxConfig{
+		SellerCountry:    "IN",
+		SellerState:      "KA",
+		GSTRate:          18,
+		PricesIncludeTax: pricesIncludeTax,
+		VATRates:         map[string]float64{"GB": 20, "DE": 19},
+	}
+}
+
+type wantLine struct {
+	name   string
+	amount int64
+}
+
+func TestCalculate(t *testing.T) {
+	tests := []struct {
+		name          string
+		inclusive     bool
+		price         money.Money
+		billing       Address
+		wantRegime    string
+		wantExclusive int64
+		wantLines     []wantLine
+		wantTax       int64
+		wantInclusive int64
+	}{
+		{
+			name:          "intra-state splits GST into CGST and SGST",
+			price:         money.New(99900, "INR"),
+			billing:       Address{Country: "IN", State: "KA"},
+			wantRegime:    RegimeGSTIntraState,
+			wantExclusive: 99900,
+			wantLines:     []wantLine{{"CGST 9%", 8991}, {"SGST 9%", 8991}},
+			wantTax:       17982,
+			wantInclusive: 117882,
+		},
+		{
+			name:          "inter-state charges IGST",
+			price:         money.New(99900, "INR"),
+			billing:       Address{Country: "IN", State: "MH"},
+			wantRegime:    RegimeGSTInterState,
+			wantExclusive: 99900,
+			wantLines:     []wantLine{{"IGST 18%", 17982}},
+			wantTax:       17982,
+			wantInclusive: 117882,
+		},
+		{
+			name:          "missing address defaults to the seller's state",
+			price:         money.New(99900, "INR"),
+			billing:       Address{},
+			wantRegime:    RegimeGSTIntraState,
+			wantExclusive: 99900,
+			wantLines:     []wantLine{{"CGST 9%", 8991}, {"SGST 9%", 8991}},
+			wantTax:       17982,
+			wantInclusive: 117882,
+		},
+		{
+			name:          "address is trimmed and upper-cased",
+			price:         money.New(99900, "INR"),
+			billing:       Address{Country: " in ", State: "ka"},
+			wantRegime:    RegimeGSTIntraState,
+			wantExclusive: 99900,
+			wantLines:     []wantLine{{"CGST 9%", 8991}, {"SGST 9%", 8991}},
+			wantTax:       17982,
+			wantInclusive: 117882,
+		},
+		{
+			name:          "each component rounds half up",
+			price:         money.New(1999, "INR"),
+			billing:       Address{Country: "IN", State: "KA"},
+			wantRegime:    RegimeGSTIntraState,
+			wantExclusive: 1999,
+			wantLines:     []wantLine{{"CGST 9%", 180}, {"SGST 9%", 180}},
+			wantTax:       360,
+			wantInclusive: 2359,
+		},
+		{
+			name:          "VAT country",
+			price:         money.New(1000, "EUR"),
+			billing:       Address{Country: "GB"},
+			wantRegime:    RegimeVAT,
+			wantExclusive: 1000,
+			wantLines:     []wantLine{{"VAT 20%", 200}},
+			wantTax:       200,
+			wantInclusive: 1200,
+		},
+		{
+			name:          "no tax outside GST and VAT countries",
+			price:         money.New(1000, "USD"),
+			billing:       Address{Country: "US", State: "CA"},
+			wantRegime:    RegimeNone,
+			wantExclusive: 1000,
+			wantTax:       0,
+			wantInclusive: 1000,
+		},
+		{
+			name:          "inclusive price puts the rounding difference on the last component",
+			inclusive:     true,
+			price:         money.New(99900, "INR"),
+			billing:       Address{Country: "IN", State: "KA"},
+			wantRegime:    RegimeGSTIntraState,
+			wantExclusive: 84661,
+			wantLines:     []wantLine{{"CGST 9%", 7619}, {"SGST 9%", 7620}},
+			wantTax:       15239,
+			wantInclusive: 99900,
+		},
+		{
+			name:          "inclusive inter-state price",
+			inclusive:     true,
+			price:         money.New(99900, "INR"),
+			billing:       Address{Country: "IN", State: "MH"},
+			wantRegime:    RegimeGSTInterState,
+			wantExclusive: 84661,
+			wantLines:     []wantLine{{"IGST 18%", 15239}},
+			wantTax:       15239,
+			wantInclusive: 99900,
+		},
+		{
+			name:          "inclusive price without tax",
+			inclusive:     true,
+			price:         money.New(1000, "USD"),
+			billing:       Address{Country: "US"},
+			wantRegime:    RegimeNone,
+			wantExclusive: 1000,
+			wantTax:       0,
+			wantInclusive: 1000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewCalculator(testConfig(tt.inclusive)).Calculate(tt.price, tt.billing)
+
+			if got.Regime != tt.wantRegime {
+				t.Errorf("Regime = %q, want %q", got.Regime, tt.wantRegime)
+			}
+			if got.ExclusiveAmount != money.New(tt.wantExclusive, tt.price.Currency) {
+				t.Errorf("ExclusiveAmount = %v, want %d", got.ExclusiveAmount, tt.wantExclusive)
+			}
+			if got.TaxAmount != money.New(tt.wantTax, tt.price.Currency) {
+				t.Errorf("TaxAmount = %v, want %d", got.TaxAmount, tt.wantTax)
+			}
+			if got.InclusiveAmount != money.New(tt.wantInclusive, tt.price.Currency) {
+				t.Errorf("InclusiveAmount = %v, want %d", got.InclusiveAmount, tt.wantInclusive)
+			}
+			if len(got.Breakdown) != len(tt.wantLines) {
+				t.Fatalf("Breakdown = %+v, want %d lines", got.Breakdown, len(tt.wantLines))
+			}
+			for i, want := range tt.wantLines {
+				line := got.Breakdown[i]
+				if line.Name != want.name || line.Amount != money.New(want.amount, tt.price.Currency) {
+					t.Errorf("Breakdown[%d] = %s %v, want %s %d", i, line.Name, line.Amount, want.name, want.amount)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		billing Address
+		want    Address
+	}{
+		{Address{}, Address{Country: "IN", State: "KA"}},
+		{Address{Country: "IN"}, Address{Country: "IN", State: "KA"}},
+		{Address{Country: "in", State: " mh "}, Address{Country: "IN", State: "MH"}},
+		{Address{Country: "US"}, Address{Country: "US"}},
+		{Address{State: "MH"}, Address{Country: "IN", State: "MH"}},
+	}
+
+	calc := NewCalculator(testConfig(false))
+	for _, tt := range tests {
+		if got := calc.Normalize(tt.billing); got != tt.want {
+			t.Errorf("Normalize(%+v) = %+v, want %+v", tt.billing, got, tt.want)
+		}
+	}
+}
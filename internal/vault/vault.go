@@ -0,0 +1,181 @@
+package vault
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"subscription-management/internal/config"
+	"subscription-management/internal/model"
+	"subscription-management/internal/repository"
+)
+
+var (
+	ErrTokenNotFound = errors.New("vault token not found")
+	ErrUnknownKey    = errors.New("vault entry is sealed with an unknown master key")
+	ErrNoActiveKey   = errors.New("vault active master key is not configured")
+)
+
+const tokenPrefix = "vt_"
+
+// Vault exchanges card numbers for opaque tokens. The card tables only ever
+// hold the token; a gateway token service can replace LocalVault behind this
+// interface.
+type Vault interface {
+	Tokenize(ctx context.Context, pan string) (string, error)
+	Detokenize(ctx context.Context, token string) (string, error)
+	Delete(ctx context.Context, token string) error
+}
+
+// LocalVault stores card numbers with envelope encryption: each PAN is sealed
+// with its own random data key, and the data key is sealed with a master key.
+// Rotating the master key only requires re-wrapping data keys, never touching
+// the card data itself.
+type LocalVault struct {
+	vaultRepo   repository.VaultRepository
+	masterKeys  map[string]cipher.AEAD
+	activeKeyID string
+}
+
+func NewLocalVault(vaultRepo repository.VaultRepository, cfg config.VaultConfig) (*LocalVault, error) {
+	masterKeys := make(map[string]cipher.AEAD)
+	for id, encoded := range cfg.MasterKeys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("vault master key %q is not valid base64", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("vault master key %q must be 32 bytes, got %d", id, len(key))
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		masterKeys[id] = aead
+	}
+
+	if _, ok := masterKeys[cfg.ActiveKeyID]; !ok {
+		return nil, ErrNoActiveKey
+	}
+
+	return &LocalVault{
+		vaultRepo:   vaultRepo,
+		masterKeys:  masterKeys,
+		activeKeyID: cfg.ActiveKeyID,
+	}, nil
+}
+
+func (v *LocalVault) Tokenize(ctx context.Context, pan string) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	// The token is the associated data of both layers, so an entry's
+	// ciphertext cannot be swapped onto another token.
+	encryptedKey, err := seal(v.masterKeys[v.activeKeyID], dataKey, []byte(token))
+	if err != nil {
+		return "", err
+	}
+	encryptedPAN, err := seal(dataAEAD, []byte(pan), []byte(token))
+	if err != nil {
+		return "", err
+	}
+
+	entry := &model.VaultEntry{
+		Token:        token,
+		KeyID:        v.activeKeyID,
+		EncryptedKey: encryptedKey,
+		EncryptedPAN: encryptedPAN,
+	}
+	if err := v.vaultRepo.Save(ctx, entry); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (v *LocalVault) Detokenize(ctx context.Context, token string) (string, error) {
+	entry, err := v.vaultRepo.Get(ctx, token)
+	if err != nil {
+		return "", err
+	}
+	if entry == nil {
+		return "", ErrTokenNotFound
+	}
+
+	masterKey, ok := v.masterKeys[entry.KeyID]
+	if !ok {
+		return "", ErrUnknownKey
+	}
+
+	dataKey, err := open(masterKey, entry.EncryptedKey, []byte(token))
+	if err != nil {
+		return "", err
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	pan, err := open(dataAEAD, entry.EncryptedPAN, []byte(token))
+	if err != nil {
+		return "", err
+	}
+	return string(pan), nil
+}
+
+func (v *LocalVault) Delete(ctx context.Context, token string) error {
+	return v.vaultRepo.Delete(ctx, token)
+}
+
+func newToken() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return tokenPrefix + hex.EncodeToString(raw), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal returns nonce || ciphertext.
+func seal(aead cipher.AEAD, plaintext []byte, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(aead cipher.AEAD, sealed []byte, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("vault ciphertext is truncated")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt vault entry: %w", err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,233 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"subscription-management/internal/config"
+	"subscription-management/internal/model"
+)
+
+// memVaultRepository keeps vault entries in memory for tests.
+type memVaultRepository struct {
+	entries map[string]*model.VaultEntry
+}
+
+func newMemVaultRepository() *memVaultRepository {
+	return &memVaultRepository{entries: map[string]*model.VaultEntry{}}
+}
+
+func (r *memVaultRepository) Save(ctx context.Context, entry *model.VaultEntry) error {
+	stored := *entry
+	r.entries[entry.Token] = &stored
+	return nil
+}
+
+func (r *memVaultRepository) Get(ctx context.Context, token string) (*model.VaultEntry, error) {
+	if entry, ok := r.entries[token]; ok {
+		found := *entry
+		return &found, nil
+	}
+	return nil, nil
+}
+
+func (r *memVaultRepository) Delete(ctx context.Context, token string) error {
+	delete(r.entries, token)
+	return nil
+}
+
+func masterKey(fill byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{fill}, 32))
+}
+
+func newTestVault(t *testing.T, repo *memVaultRepository, active string, keys map[string]string) *LocalVault {
+	t.Helper()
+	v, err := NewLocalVault(repo, config.VaultConfig{MasterKeys: keys, ActiveKeyID: active})
+	if err != nil {
+		t.Fatalf("NewLocalVault: %v", err)
+	}
+	return v
+}
+
+func TestNewLocalVault(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    map[string]string
+		active  string
+		wantErr string
+	}{
+		{"valid", map[string]string{"v1": masterKey(1)}, "v1", ""},
+		{"several keys", map[string]string{"v1": masterKey(1), "v2": masterKey(2)}, "v2", ""},
+		{"not base64", map[string]string{"v1": "not base64!"}, "v1", "not valid base64"},
+		{"short key", map[string]string{"v1": base64.StdEncoding.EncodeToString(make([]byte, 16))}, "v1", "must be 32 bytes"},
+		{"active key missing", map[string]string{"v1": masterKey(1)}, "v2", ErrNoActiveKey.Error()},
+		{"no keys", nil, "v1", ErrNoActiveKey.Error()},
+	}
+
+	for _, tt := range tests {
+		_, err := NewLocalVault(newMemVaultRepository(), config.VaultConfig{MasterKeys: tt.keys, ActiveKeyID: tt.active})
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: error = %v, want one containing %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestTokenizeRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemVaultRepository()
+	v := newTestVault(t, repo, "v1", map[string]string{"v1": masterKey(1)})
+
+	for _, pan := range []string{"4111111111111111", "5500005555555559", "378282246310005", ""} {
+		token, err := v.Tokenize(ctx, pan)
+		if err != nil {
+			t.Fatalf("Tokenize(%q): %v", pan, err)
+		}
+		if !strings.HasPrefix(token, tokenPrefix) || (pan != "" && strings.Contains(token, pan)) {
+			t.Errorf("token %q does not look opaque", token)
+		}
+
+		entry := repo.entries[token]
+		if entry.KeyID != "v1" {
+			t.Errorf("entry sealed with %q, want v1", entry.KeyID)
+		}
+		if pan != "" && bytes.Contains(entry.EncryptedPAN, []byte(pan)) {
+			t.Errorf("stored ciphertext contains the card number")
+		}
+
+		got, err := v.Detokenize(ctx, token)
+		if err != nil {
+			t.Fatalf("Detokenize(%q): %v", token, err)
+		}
+		if got != pan {
+			t.Errorf("Detokenize(Tokenize(%q)) = %q", pan, got)
+		}
+	}
+
+	first, _ := v.Tokenize(ctx, "4111111111111111")
+	second, _ := v.Tokenize(ctx, "4111111111111111")
+	if first == second {
+		t.Error("the same card number got the same token twice")
+	}
+	if bytes.Equal(repo.entries[first].EncryptedKey, repo.entries[second].EncryptedKey) {
+		t.Error("two entries share a data key")
+	}
+}
+
+func TestMasterKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemVaultRepository()
+
+	old := newTestVault(t, repo, "v1", map[string]string{"v1": masterKey(1)})
+	token, err := old.Tokenize(ctx, "4111111111111111")
+	if err != nil {
+		t.Fatalf("Tokenize: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		active  string
+		keys    map[string]string
+		wantErr error
+	}{
+		{"old key still configured", "v2", map[string]string{"v1": masterKey(1), "v2": masterKey(2)}, nil},
+		{"old key removed", "v2", map[string]string{"v2": masterKey(2)}, ErrUnknownKey},
+	}
+
+	for _, tt := range tests {
+		v := newTestVault(t, repo, tt.active, tt.keys)
+		got, err := v.Detokenize(ctx, token)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Detokenize error = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr == nil && got != "4111111111111111" {
+			t.Errorf("%s: Detokenize = %q", tt.name, got)
+		}
+	}
+
+	rotated := newTestVault(t, repo, "v2", map[string]string{"v1": masterKey(1), "v2": masterKey(2)})
+	newToken, err := rotated.Tokenize(ctx, "5500005555555559")
+	if err != nil {
+		t.Fatalf("Tokenize: %v", err)
+	}
+	if repo.entries[newToken].KeyID != "v2" {
+		t.Errorf("new entry sealed with %q, want the active key v2", repo.entries[newToken].KeyID)
+	}
+}
+
+func TestDetokenizeRejectsTamperedEntries(t *testing.T) {
+	ctx := context.Background()
+	keys := map[string]string{"v1": masterKey(1), "v2": masterKey(2)}
+
+	tests := []struct {
+		name   string
+		tamper func(entry, other *model.VaultEntry)
+	}{
+		{"card ciphertext from another token", func(entry, other *model.VaultEntry) {
+			entry.EncryptedPAN = other.EncryptedPAN
+		}},
+		{"whole envelope from another token", func(entry, other *model.VaultEntry) {
+			entry.EncryptedKey, entry.EncryptedPAN = other.EncryptedKey, other.EncryptedPAN
+		}},
+		{"flipped bit in the data key", func(entry, other *model.VaultEntry) {
+			entry.EncryptedKey[len(entry.EncryptedKey)-1] ^= 1
+		}},
+		{"flipped bit in the card ciphertext", func(entry, other *model.VaultEntry) {
+			entry.EncryptedPAN[len(entry.EncryptedPAN)-1] ^= 1
+		}},
+		{"truncated ciphertext", func(entry, other *model.VaultEntry) {
+			entry.EncryptedPAN = entry.EncryptedPAN[:4]
+		}},
+		{"wrong master key id", func(entry, other *model.VaultEntry) {
+			entry.KeyID = "v2"
+		}},
+	}
+
+	for _, tt := range tests {
+		repo := newMemVaultRepository()
+		v := newTestVault(t, repo, "v1", keys)
+
+		token, err := v.Tokenize(ctx, "4111111111111111")
+		if err != nil {
+			t.Fatalf("Tokenize: %v", err)
+		}
+		otherToken, err := v.Tokenize(ctx, "5500005555555559")
+		if err != nil {
+			t.Fatalf("Tokenize: %v", err)
+		}
+		tt.tamper(repo.entries[token], repo.entries[otherToken])
+
+		if got, err := v.Detokenize(ctx, token); err == nil {
+			t.Errorf("%s: Detokenize = %q, want an error", tt.name, got)
+		}
+	}
+}
+
+func TestDetokenizeMissingToken(t *testing.T) {
+	ctx := context.Background()
+	v := newTestVault(t, newMemVaultRepository(), "v1", map[string]string{"v1": masterKey(1)})
+
+	token, err := v.Tokenize(ctx, "4111111111111111")
+	if err != nil {
+		t.Fatalf("Tokenize: %v", err)
+	}
+	if err := v.Delete(ctx, token); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	for _, token := range []string{token, tokenPrefix + "unknown"} {
+		if _, err := v.Detokenize(ctx, token); !errors.Is(err, ErrTokenNotFound) {
+			t.Errorf("Detokenize(%q) error = %v, want %v", token, err, ErrTokenNotFound)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+ALTER TABLE subscription_transactions
+ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'active',
+ADD COLUMN grace_period_ends_at TIMESTAMP NULL;
+
+
+UPDATE subscription_transactions SET status = 'expired' WHERE is_active = false;
+
+
+CREATE TABLE IF NOT EXISTS payment_attempts (
+    id VARCHAR(36) PRIMARY KEY,
+    subscription_id VARCHAR(36) NOT NULL,
+    user_id VARCHAR(36) NOT NULL,
+    card_id VARCHAR(36) NOT NULL,
+    attempt_number INT NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    failure_reason VARCHAR(255) NULL,
+    razorpay_payment_id VARCHAR(100) NULL,
+    razorpay_order_id VARCHAR(100) NULL,
+    next_retry_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (subscription_id) REFERENCES subscription_transactions(id),
+    FOREIGN KEY (card_id) REFERENCES cards(id),
+    INDEX idx_payment_attempts_subscription (subscription_id)
+);
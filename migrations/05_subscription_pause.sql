@@ -0,0 +1,3 @@
+ALTER TABLE subscription_transactions
+ADD COLUMN paused_at TIMESTAMP NULL,
+ADD COLUMN resume_at TIMESTAMP NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE subscription_transactions
+ADD COLUMN cancel_at_period_end BOOLEAN DEFAULT false,
+ADD COLUMN cancel_at TIMESTAMP NULL;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS refunds (
+    id VARCHAR(36) PRIMARY KEY,
+    subscription_id VARCHAR(36) NOT NULL,
+    user_id VARCHAR(36) NOT NULL,
+    razorpay_payment_id VARCHAR(100) NOT NULL,
+    razorpay_refund_id VARCHAR(100) NULL,
+    amount DECIMAL(10, 2) NOT NULL,
+    reason VARCHAR(255) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    failure_reason VARCHAR(255) NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (subscription_id) REFERENCES subscription_transactions(id),
+    UNIQUE KEY refund_razorpay_unique (razorpay_refund_id),
+    INDEX idx_refunds_payment (razorpay_payment_id)
+);
@@ -0,0 +1,60 @@
+CREATE TABLE IF NOT EXISTS invoice_sequences (
+    prefix VARCHAR(20) PRIMARY KEY,
+    last_value BIGINT NOT NULL DEFAULT 0
+);
+
+
+CREATE TABLE IF NOT EXISTS invoices (
+    id VARCHAR(36) PRIMARY KEY,
+    invoice_number VARCHAR(30) NOT NULL,
+    transaction_id VARCHAR(36) NOT NULL,
+    user_id VARCHAR(36) NOT NULL,
+    customer_name VARCHAR(100) NOT NULL,
+    customer_email VARCHAR(255) NOT NULL,
+    customer_phone VARCHAR(20) NOT NULL,
+    product_name VARCHAR(100) NOT NULL,
+    plan_name VARCHAR(100) NOT NULL,
+    plan_attributes TEXT NOT NULL,
+    payment_type VARCHAR(20) NOT NULL,
+    period_start TIMESTAMP NOT NULL,
+    period_end TIMESTAMP NOT NULL,
+    currency VARCHAR(3) NOT NULL DEFAULT 'INR',
+    subtotal DECIMAL(10, 2) NOT NULL,
+    discount_total DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    tax_total DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    total DECIMAL(10, 2) NOT NULL,
+    razorpay_payment_id VARCHAR(100) NULL,
+    issued_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY invoice_number_unique (invoice_number),
+    UNIQUE KEY invoice_transaction_unique (transaction_id),
+    INDEX idx_invoices_user (user_id),
+    FOREIGN KEY (transaction_id) REFERENCES subscription_transactions(id)
+);
+
+
+CREATE TABLE IF NOT EXISTS invoice_line_items (
+    id VARCHAR(36) PRIMARY KEY,
+    invoice_id VARCHAR(36) NOT NULL,
+    position INT NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    description VARCHAR(255) NOT NULL,
+    quantity INT NOT NULL DEFAULT 1,
+    unit_amount DECIMAL(10, 2) NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (invoice_id) REFERENCES invoices(id)
+);
+
+
+CREATE TRIGGER invoices_no_update BEFORE UPDATE ON invoices
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'invoices are immutable once issued';
+
+CREATE TRIGGER invoices_no_delete BEFORE DELETE ON invoices
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'invoices are immutable once issued';
+
+CREATE TRIGGER invoice_line_items_no_update BEFORE UPDATE ON invoice_line_items
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'invoices are immutable once issued';
+
+CREATE TRIGGER invoice_line_items_no_delete BEFORE DELETE ON invoice_line_items
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'invoices are immutable once issued';
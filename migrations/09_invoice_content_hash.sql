@@ -0,0 +1,4 @@
+-- Invoices issued before this migration have no stored hash; the immutability
+-- triggers stay in place, so they are not backfilled.
+ALTER TABLE invoices
+ADD COLUMN content_hash CHAR(64) NULL;
@@ -0,0 +1,15 @@
+ALTER TABLE subscription_transactions
+ADD COLUMN amount_exclusive DECIMAL(10, 2) NOT NULL DEFAULT 0,
+ADD COLUMN tax_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+ADD COLUMN tax_breakdown TEXT NULL,
+ADD COLUMN billing_country CHAR(2) NULL,
+ADD COLUMN billing_state VARCHAR(10) NULL;
+
+
+-- Existing transactions were charged gross with no tax component.
+UPDATE subscription_transactions SET amount_exclusive = amount;
+
+
+ALTER TABLE invoices
+ADD COLUMN billing_country CHAR(2) NULL,
+ADD COLUMN billing_state VARCHAR(10) NULL;
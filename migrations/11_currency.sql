@@ -0,0 +1,6 @@
+ALTER TABLE subscription_transactions
+ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'INR';
+
+
+ALTER TABLE refunds
+ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'INR';
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS plan_prices (
+    id VARCHAR(36) PRIMARY KEY,
+    plan_id VARCHAR(36) NOT NULL,
+    currency CHAR(3) NOT NULL,
+    payment_type VARCHAR(20) NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL,
+    razorpay_plan_id VARCHAR(100) NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY plan_price_unique (plan_id, currency, payment_type),
+    FOREIGN KEY (plan_id) REFERENCES subscription_plans(id)
+);
+
+
+-- The existing catalog prices are INR.
+INSERT INTO plan_prices (id, plan_id, currency, payment_type, amount)
+SELECT CONCAT(id, '-inr-monthly'), id, 'INR', 'monthly', price_monthly FROM subscription_plans;
+
+INSERT INTO plan_prices (id, plan_id, currency, payment_type, amount)
+SELECT CONCAT(id, '-inr-yearly'), id, 'INR', 'yearly', price_yearly FROM subscription_plans;
+
+
+-- Razorpay plans that were previously hardcoded in the service.
+UPDATE plan_prices SET razorpay_plan_id = 'plan_QIbEUICtejuBUQ' WHERE id = 'plan-001-inr-monthly';
+UPDATE plan_prices SET razorpay_plan_id = 'plan_QIbFBU9kxYoEhg' WHERE id = 'plan-001-inr-yearly';
+UPDATE plan_prices SET razorpay_plan_id = 'plan_LgWAqFqsESLnhb' WHERE id = 'plan-002-inr-monthly';
+UPDATE plan_prices SET razorpay_plan_id = 'plan_LgWAtVDXJI4Nzu' WHERE id = 'plan-002-inr-yearly';
+UPDATE plan_prices SET razorpay_plan_id = 'plan_LgWB3F9fPBzPRV' WHERE id = 'plan-003-inr-monthly';
+UPDATE plan_prices SET razorpay_plan_id = 'plan_LgWB7dBSP7iUf7' WHERE id = 'plan-003-inr-yearly';
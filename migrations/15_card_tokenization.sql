@@ -0,0 +1,16 @@
+-- Cards are stored as vault tokens. card_number stays nullable until
+-- `go run ./cmd/tokenize-cards` has tokenized the existing rows; it can be
+-- dropped afterwards.
+ALTER TABLE cards
+    MODIFY COLUMN card_number VARCHAR(16) NULL,
+    ADD COLUMN card_token VARCHAR(64) NULL AFTER card_number,
+    ADD COLUMN bin VARCHAR(8) NOT NULL DEFAULT '' AFTER card_token;
+
+CREATE TABLE IF NOT EXISTS card_vault (
+    token VARCHAR(64) PRIMARY KEY,
+    key_id VARCHAR(32) NOT NULL,
+    encrypted_key VARBINARY(128) NOT NULL,
+    encrypted_pan VARBINARY(128) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_card_vault_key (key_id)
+);
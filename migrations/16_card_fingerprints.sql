@@ -0,0 +1,8 @@
+-- Duplicate cards are detected by a keyed fingerprint of the card number
+-- instead of the last four digits. Existing cards are fingerprinted by
+-- `go run ./cmd/tokenize-cards`.
+ALTER TABLE cards
+    ADD COLUMN fingerprint CHAR(64) NULL AFTER bin,
+    DROP INDEX user_card_unique,
+    ADD UNIQUE KEY uq_cards_user_fingerprint (user_id, fingerprint),
+    ADD INDEX idx_cards_fingerprint (fingerprint);
@@ -0,0 +1,9 @@
+ALTER TABLE cards
+    ADD COLUMN issuer VARCHAR(100) NOT NULL DEFAULT '' AFTER card_type,
+    ADD COLUMN issuer_country CHAR(2) NOT NULL DEFAULT '' AFTER issuer,
+    ADD COLUMN funding_type VARCHAR(10) NOT NULL DEFAULT '' AFTER issuer_country;
+
+-- Comma-separated funding types (credit, debit, prepaid) a plan accepts.
+-- Empty accepts every card.
+ALTER TABLE subscription_plans
+    ADD COLUMN allowed_funding_types VARCHAR(50) NOT NULL DEFAULT '' AFTER price_yearly;
@@ -0,0 +1,4 @@
+ALTER TABLE cards
+    ADD COLUMN is_expired BOOLEAN NOT NULL DEFAULT false AFTER is_default,
+    ADD COLUMN expiry_notified_at TIMESTAMP NULL AFTER is_expired,
+    ADD INDEX idx_cards_expiry (expiry_year, expiry_month);
@@ -0,0 +1,7 @@
+-- Removed cards are kept, without their vault token, so subscription history
+-- and payment attempts that reference them still render. Only cards that are
+-- not removed take part in the per-user duplicate check.
+ALTER TABLE cards
+    ADD COLUMN deleted_at TIMESTAMP NULL AFTER expiry_notified_at,
+    DROP INDEX uq_cards_user_fingerprint,
+    ADD UNIQUE KEY uq_cards_user_active_fingerprint (user_id, (IF(deleted_at IS NULL, fingerprint, NULL)));
@@ -0,0 +1,18 @@
+-- Mutating requests sent with an Idempotency-Key header. The response is
+-- stored once the request completes so that a retry with the same key is
+-- answered from it. Rows older than IDEMPOTENCY_KEY_TTL are purged.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    id VARCHAR(36) PRIMARY KEY,
+    owner VARCHAR(100) NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    method VARCHAR(10) NOT NULL,
+    path VARCHAR(255) NOT NULL,
+    status_code INT NULL,
+    content_type VARCHAR(100) NULL,
+    response_body MEDIUMBLOB NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP NULL,
+    UNIQUE KEY uq_idempotency_keys_owner_key (owner, idempotency_key),
+    INDEX idx_idempotency_keys_created_at (created_at)
+);
@@ -0,0 +1,13 @@
+-- Razorpay plans for tax-inclusive amounts that differ from the catalog price,
+-- one per price, tax treatment and amount. Renewals must charge what the
+-- transaction and its invoice say, tax included.
+CREATE TABLE IF NOT EXISTS gateway_plans (
+    id VARCHAR(36) PRIMARY KEY,
+    plan_price_id VARCHAR(36) NOT NULL,
+    tax_treatment VARCHAR(100) NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL,
+    razorpay_plan_id VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY gateway_plan_unique (plan_price_id, tax_treatment, amount),
+    FOREIGN KEY (plan_price_id) REFERENCES plan_prices(id)
+);
@@ -0,0 +1,4 @@
+-- A card change on a Razorpay-managed subscription waits here until the
+-- customer has authenticated the new card in Checkout and Razorpay confirms it.
+ALTER TABLE subscription_transactions
+ADD COLUMN pending_card_id VARCHAR(36) NULL;
@@ -0,0 +1,6 @@
+-- The Razorpay token a card was saved under when the customer paid with it in
+-- Checkout. Dunning retries charge the card through this token; a card
+-- without one can only be retried by the customer.
+ALTER TABLE cards
+    ADD COLUMN razorpay_token_id VARCHAR(100) NULL AFTER card_token,
+    ADD INDEX idx_cards_razorpay_token (user_id, razorpay_token_id);
@@ -0,0 +1,7 @@
+-- The relay claims a batch of events for claimed_until and publishes them after
+-- the claim has committed, so no row lock is held while it waits on the
+-- network. An event that still fails after OUTBOX_MAX_ATTEMPTS is set aside in
+-- dead_lettered_at and no longer holds back the events after it.
+ALTER TABLE outbox_events
+    ADD COLUMN claimed_until TIMESTAMP NULL AFTER published_at,
+    ADD COLUMN dead_lettered_at TIMESTAMP NULL AFTER claimed_until;
@@ -0,0 +1,5 @@
+-- A request holding an Idempotency-Key refreshes heartbeat_at while it runs.
+-- Only a key whose heartbeat stopped for IDEMPOTENCY_LOCK_TIMEOUT, because
+-- the server running it went away, can be taken by a retry.
+ALTER TABLE idempotency_keys
+    ADD COLUMN heartbeat_at TIMESTAMP NULL AFTER created_at;